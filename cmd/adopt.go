@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	adoptPID  int
+	adoptName string
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt <unit> | --pid <pid> [flags]",
+	Short: "Record an existing service or process as a job",
+	Long: `Record work that was started without jr so that list, status, logs and
+stop can manage it.
+
+With a unit argument, an existing user service (for example one started
+with plain systemd-run) is recorded with the command line, working
+directory and environment systemd reports for it.
+
+With --pid, a running process and its children are moved into a new
+jr-named transient scope, as 'systemd-run --scope' would have done. The
+process keeps its original stdout and stderr, so 'jr logs' only shows what
+it sends to the journal. Processes belonging to a login session, such as
+those in a tmux started over SSH, usually cannot be moved by the user
+manager.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if adoptPID > 0 && len(args) > 0 {
+			return fmt.Errorf("give either a unit or --pid, not both")
+		}
+		if adoptPID == 0 && len(args) != 1 {
+			return fmt.Errorf("requires a unit or --pid")
+		}
+		return nil
+	},
+	RunE: runAdopt,
+}
+
+func init() {
+	adoptCmd.Flags().IntVar(&adoptPID, "pid", 0, "adopt a running process by moving it into a new scope")
+	adoptCmd.Flags().StringVarP(&adoptName, "name", "n", "", "logical name for the job (default: derived from the unit or command)")
+}
+
+func runAdopt(cmd *cobra.Command, args []string) error {
+	var job *db.Job
+	var err error
+
+	if adoptPID > 0 {
+		job, err = adoptProcess(adoptPID)
+	} else {
+		job, err = adoptService(args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Adopted %d %s (%s)\n", job.ID, job.Unit, job.Name)
+	return nil
+}
+
+func adoptService(unit string) (*db.Job, error) {
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+
+	existing, err := db.GetJobByUnit(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up unit: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%s is already job %d", unit, existing.ID)
+	}
+
+	info, err := systemd.ShowUnit(unit)
+	if err != nil || info.Gone() {
+		return nil, fmt.Errorf("unit not found: %s", unit)
+	}
+
+	details, err := systemd.ShowUnitDetails(unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unit: %w", err)
+	}
+
+	name := adoptName
+	if name == "" {
+		if parsed, _, ok := systemd.ParseUnitName(unit); ok {
+			name = parsed
+		} else {
+			name = strings.TrimSuffix(unit, filepath.Ext(unit))
+		}
+	}
+
+	started, _ := systemd.ParseTimestamp(info.ExecMainStartTimestamp)
+	return recordUnit(unit, name, started, details)
+}
+
+func adoptProcess(pid int) (*db.Job, error) {
+	proc, err := systemd.ReadProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	if len(proc.Argv) == 0 {
+		return nil, fmt.Errorf("process %d has no command line (kernel thread or zombie)", pid)
+	}
+
+	// Adopting moves the process into a new scope, so adopting it again
+	// would record a second job for the same work
+	current, err := systemd.ProcessUnit(pid)
+	if err != nil {
+		return nil, err
+	}
+	if current != "" {
+		existing, err := db.GetJobByUnit(current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up unit: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("process %d is already job %d (%s)", pid, existing.ID, current)
+		}
+	}
+
+	pids, err := systemd.ProcessTree(pid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list child processes: %w", err)
+	}
+
+	name := adoptName
+	if name == "" {
+		name = filepath.Base(proc.Argv[0])
+	}
+
+	unit := systemd.GenerateScopeName(name)
+	if err := systemd.StartScope(unit, pids, "jr job: "+name); err != nil {
+		return nil, fmt.Errorf("failed to move process %d into %s: %w", pid, unit, err)
+	}
+
+	host, _ := os.Hostname()
+	id, err := db.CreateJob(name, unit, proc.Cwd, proc.Argv, cfg.Env.Redact(proc.Env), nil, host, os.Getenv("USER"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record job: %w", err)
+	}
+
+	return db.GetJobByID(id)
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+)
+
+var (
+	artifactsJSON     bool
+	artifactsSelector jobSelector
+)
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts <job|range>... [flags]",
+	Short: "List the files jobs produced",
+	Long: `List the files matched by a job's 'jr run --artifact' patterns, as they
+were when the job finished: path, size, modification time and, with
+--artifact-sha256, checksum.
+
+Files that have since been deleted or modified are marked as such. See
+'jr rm --artifacts' to delete them together with the job.`,
+	RunE: runArtifacts,
+}
+
+func init() {
+	artifactsCmd.Flags().BoolVar(&artifactsJSON, "json", false, "output as JSON")
+	addSelectorFlags(artifactsCmd, &artifactsSelector)
+	registerSelectorCompletions(artifactsCmd, anyState)
+}
+
+// ArtifactOutput is an artifact as jr artifacts --json prints it.
+type ArtifactOutput struct {
+	JobID    int64  `json:"jobId"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+	SHA256   string `json:"sha256,omitempty"`
+	// Status is "ok", "missing" or "modified" since the snapshot.
+	Status string `json:"status"`
+}
+
+func runArtifacts(cmd *cobra.Command, args []string) error {
+	jobs, _, err := artifactsSelector.selectJobs(args)
+	if err != nil {
+		return err
+	}
+
+	var output []ArtifactOutput
+	for _, job := range jobs {
+		artifacts, err := db.ListJobArtifacts(job.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list artifacts: %w", err)
+		}
+		if len(artifacts) == 0 && !artifactsJSON {
+			fmt.Fprintf(os.Stderr, "%d %s: %s\n", job.ID, job.Name, noArtifactsReason(job))
+		}
+		for _, a := range artifacts {
+			output = append(output, ArtifactOutput{
+				JobID:    job.ID,
+				Path:     a.Path,
+				Size:     a.Size,
+				Modified: a.ModTime,
+				SHA256:   a.Checksum.String,
+				Status:   artifactStatus(a),
+			})
+		}
+	}
+
+	if artifactsJSON {
+		if output == nil {
+			output = []ArtifactOutput{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(output)
+	}
+	if len(output) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSIZE\tMODIFIED\tSTATUS\tSHA256\tPATH")
+	for _, a := range output {
+		modified, _ := time.Parse(time.RFC3339, a.Modified)
+		checksum := "-"
+		if a.SHA256 != "" {
+			checksum = a.SHA256[:12]
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			a.JobID, formatSize(a.Size), modified.Local().Format("Jan 02 15:04"), a.Status, checksum, a.Path)
+	}
+	return w.Flush()
+}
+
+// noArtifactsReason explains why a job has no artifacts to list.
+func noArtifactsReason(job *db.Job) string {
+	switch {
+	case !job.ArtifactsJSON.Valid:
+		return "no artifact patterns (see jr run --artifact)"
+	case !job.ArtifactsAtUTC.Valid:
+		return "artifacts are recorded when the job finishes"
+	}
+	return "no file matched the artifact patterns"
+}
+
+// jobArtifactRules returns the artifact rules job was run with, nil if
+// none.
+func jobArtifactRules(job *db.Job) *db.ArtifactRules {
+	if !job.ArtifactsJSON.Valid {
+		return nil
+	}
+	var rules db.ArtifactRules
+	if err := json.Unmarshal([]byte(job.ArtifactsJSON.String), &rules); err != nil {
+		return nil
+	}
+	return &rules
+}
+
+// snapshotArtifacts returns the files matching rules, relative to cwd,
+// ordered by path. A matching directory contributes the regular files
+// under it.
+func snapshotArtifacts(rules *db.ArtifactRules, cwd string) ([]*db.Artifact, error) {
+	seen := make(map[string]bool)
+	var artifacts []*db.Artifact
+	add := func(path string, info fs.FileInfo) error {
+		if seen[path] || !info.Mode().IsRegular() {
+			return nil
+		}
+		seen[path] = true
+		a := &db.Artifact{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC().Format(time.RFC3339Nano),
+		}
+		if rules.SHA256 {
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return err
+			}
+			a.Checksum = sql.NullString{String: sum, Valid: true}
+		}
+		artifacts = append(artifacts, a)
+		return nil
+	}
+
+	for _, pattern := range rules.Patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(cwd, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return add(path, info)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return artifacts, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// artifactStatus reports whether the file of an artifact is still as the
+// snapshot recorded it: "ok", "missing" or "modified". Size and mtime are
+// compared, not checksums.
+func artifactStatus(a *db.Artifact) string {
+	info, err := os.Stat(a.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "missing"
+	}
+	if err != nil {
+		return "unknown"
+	}
+	modified, _ := time.Parse(time.RFC3339Nano, a.ModTime)
+	if info.Size() != a.Size || !info.ModTime().Equal(modified) {
+		return "modified"
+	}
+	return "ok"
+}
+
+// settleArtifacts snapshots the artifacts of a finished job that has
+// patterns but no snapshot yet, because its ExecStopPost= hook did not run.
+func settleArtifacts(job *db.Job) {
+	rules := jobArtifactRules(job)
+	if rules == nil || job.ArtifactsAtUTC.Valid {
+		return
+	}
+	artifacts, err := snapshotArtifacts(rules, job.Cwd)
+	if err == nil {
+		err = db.RecordJobArtifacts(job.ID, artifacts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record artifacts of %d %s: %v\n", job.ID, job.Unit, err)
+	}
+}
+
+// removeArtifacts deletes the artifact files of job, keeping any that
+// were modified since the snapshot, say by a later run writing the same
+// path.
+func removeArtifacts(job *db.Job) error {
+	artifacts, err := db.ListJobArtifacts(job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list artifacts: %w", err)
+	}
+	return removeArtifactFiles(job, artifacts)
+}
+
+func removeArtifactFiles(job *db.Job, artifacts []*db.Artifact) error {
+	for _, a := range artifacts {
+		switch artifactStatus(a) {
+		case "missing":
+			continue
+		case "ok":
+			if err := os.Remove(a.Path); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", a.Path, err)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: keeping %s, modified since job %d finished\n", a.Path, job.ID)
+		}
+	}
+	return nil
+}
+
+// formatArtifacts describes the artifacts of job for jr status.
+func formatArtifacts(job *db.Job, rules *db.ArtifactRules) string {
+	patterns := strings.Join(rules.Patterns, ", ")
+	if !job.ArtifactsAtUTC.Valid {
+		return patterns + " (recorded when the job finishes)"
+	}
+	artifacts, err := db.ListJobArtifacts(job.ID)
+	if err != nil {
+		return patterns
+	}
+	var total int64
+	for _, a := range artifacts {
+		total += a.Size
+	}
+	return fmt.Sprintf("%d files, %s (%s)", len(artifacts), formatSize(total), patterns)
+}
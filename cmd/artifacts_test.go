@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/user/jr/db"
+)
+
+func TestSnapshotArtifacts(t *testing.T) {
+	cwd := t.TempDir()
+	for _, name := range []string{"out/a.pt", "out/b.pt", "out/log.txt", "ckpt/step-1/model.bin"} {
+		path := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules := &db.ArtifactRules{Patterns: []string{"out/*.pt", "ckpt", "out/a.pt", "missing/*"}, SHA256: true}
+	artifacts, err := snapshotArtifacts(rules, cwd)
+	if err != nil {
+		t.Fatalf("snapshotArtifacts: %v", err)
+	}
+
+	want := []string{"ckpt/step-1/model.bin", "out/a.pt", "out/b.pt"}
+	if len(artifacts) != len(want) {
+		t.Fatalf("Expected %d artifacts, got %+v", len(want), artifacts)
+	}
+	for i, a := range artifacts {
+		if a.Path != filepath.Join(cwd, want[i]) {
+			t.Errorf("artifact %d: got %s, expected %s", i, a.Path, want[i])
+		}
+		// sha256("data")
+		if a.Size != 4 || a.Checksum.String != "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7" {
+			t.Errorf("artifact %d: unexpected size or checksum: %+v", i, a)
+		}
+	}
+
+	if got := artifactStatus(artifacts[0]); got != "ok" {
+		t.Errorf("Expected an unchanged artifact to be ok, got %s", got)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(artifacts[1].Path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := artifactStatus(artifacts[1]); got != "modified" {
+		t.Errorf("Expected a touched artifact to be modified, got %s", got)
+	}
+	os.Remove(artifacts[2].Path)
+	if got := artifactStatus(artifacts[2]); got != "missing" {
+		t.Errorf("Expected a deleted artifact to be missing, got %s", got)
+	}
+
+	// Only unmodified files are removed
+	job := &db.Job{}
+	if err := removeArtifactFiles(job, artifacts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(artifacts[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", artifacts[0].Path)
+	}
+	if _, err := os.Stat(artifacts[1].Path); err != nil {
+		t.Errorf("Expected modified %s to be kept: %v", artifacts[1].Path, err)
+	}
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	ckptSignal   string
+	ckptPath     string
+	ckptTimeout  string
+	ckptSelector jobSelector
+)
+
+const (
+	defaultCheckpointSignal  = "SIGUSR1"
+	defaultCheckpointTimeout = 10 * time.Minute
+	checkpointPollInterval   = time.Second
+)
+
+var checkpointCmd = &cobra.Command{
+	Use:   "checkpoint <job|range>... [flags]",
+	Short: "Ask jobs to save a checkpoint and wait for it",
+	Long: `Send each job the checkpoint signal it declared with 'jr run
+--checkpoint-signal' (only to its main process), then wait until its
+checkpoint path has been written and stopped changing.
+
+Without a checkpoint path the signal is sent and jr returns immediately.
+The time of the last checkpoint is shown by 'jr status'. See also
+'jr stop --checkpoint'.`,
+	RunE: runCheckpoint,
+}
+
+func init() {
+	checkpointCmd.Flags().StringVarP(&ckptSignal, "signal", "s", "", "signal to send (default: the job's checkpoint signal)")
+	checkpointCmd.Flags().StringVar(&ckptPath, "path", "", "file or directory to watch (default: the job's checkpoint path)")
+	checkpointCmd.Flags().StringVarP(&ckptTimeout, "timeout", "t", "10min", "how long to wait for the checkpoint, e.g. 30s, 5min, infinity")
+	addSelectorFlags(checkpointCmd, &ckptSelector)
+	registerSelectorCompletions(checkpointCmd, canCheckpoint)
+	checkpointCmd.RegisterFlagCompletionFunc("signal", fixedCompletions(signalNames))
+}
+
+// canCheckpoint reports whether a job in state can react to its checkpoint
+// signal: it is running and not frozen.
+func canCheckpoint(state string) bool {
+	return isActiveState(state) && state != "paused"
+}
+
+func runCheckpoint(cmd *cobra.Command, args []string) error {
+	timeout, err := systemd.ParseTimespan(ckptTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout: %w", err)
+	}
+
+	jobs, infos, err := ckptSelector.selectJobs(args)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, job := range jobs {
+		if state := jobState(job, infos); !canCheckpoint(state) {
+			fmt.Fprintf(os.Stderr, "Error: %d %s is %s, not running\n", job.ID, job.Unit, state)
+			failed++
+			continue
+		}
+
+		if err := checkpointJob(job, ckptSignal, ckptPath, timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to checkpoint %d of %d jobs", failed, len(jobs))
+	}
+	return nil
+}
+
+// checkpointJob sends job its checkpoint signal and waits up to timeout for
+// the checkpoint path to be written (indefinitely if zero), recording the
+// time it was. Empty signal and path fall back to what the job declared.
+func checkpointJob(job *db.Job, signal, path string, timeout time.Duration) error {
+	if signal == "" {
+		signal = job.CkptSignal.String
+	}
+	if signal == "" {
+		return fmt.Errorf("no checkpoint signal declared (use --signal, or jr run --checkpoint-signal)")
+	}
+
+	if path == "" {
+		path = job.CkptPath.String
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(job.Cwd, path)
+	}
+
+	before := latestModTime(path)
+
+	if err := systemd.KillMainProcess(job.Unit, signal); err != nil {
+		return fmt.Errorf("failed to send %s: %w", signal, err)
+	}
+
+	if path == "" {
+		fmt.Printf("Sent %s to %d %s (no checkpoint path to watch)\n", signal, job.ID, job.Unit)
+		return nil
+	}
+	fmt.Printf("Sent %s to %d %s, waiting for %s\n", signal, job.ID, job.Unit, path)
+
+	written, err := waitForCheckpoint(job, path, before, timeout)
+	if err != nil {
+		return err
+	}
+
+	if err := db.SetJobCheckpointed(job.ID, written); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record checkpoint: %v\n", err)
+	}
+	fmt.Printf("Checkpointed %d %s at %s\n", job.ID, job.Unit, written.Local().Format(time.RFC3339))
+	return nil
+}
+
+// waitForCheckpoint polls path until its modification time moves past
+// before and then holds still for one poll, so a checkpoint still being
+// written is not mistaken for a finished one.
+func waitForCheckpoint(job *db.Job, path string, before time.Time, timeout time.Duration) (time.Time, error) {
+	deadline := time.Now().Add(timeout)
+	var last time.Time
+
+	for timeout == 0 || time.Now().Before(deadline) {
+		time.Sleep(checkpointPollInterval)
+
+		current := latestModTime(path)
+		if current.After(before) {
+			if current.Equal(last) {
+				return current, nil
+			}
+			last = current
+			continue
+		}
+
+		if info, err := systemd.ShowUnit(job.Unit); err == nil && !isActiveState(unitState(job, info)) {
+			return time.Time{}, fmt.Errorf("job exited before writing a checkpoint")
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("no checkpoint written to %s within %s", path, timeout)
+}
+
+// latestModTime returns the modification time of path or, for a
+// directory, of its most recently modified entry. It is zero when path
+// does not exist.
+func latestModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	latest := info.ModTime()
+	if !info.IsDir() {
+		return latest
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return latest
+	}
+	for _, e := range entries {
+		if ei, err := e.Info(); err == nil && ei.ModTime().After(latest) {
+			latest = ei.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLatestModTime(t *testing.T) {
+	dir := t.TempDir()
+
+	if !latestModTime(filepath.Join(dir, "missing")).IsZero() {
+		t.Error("Expected zero time for a missing path")
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	newer := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	for name, mtime := range map[string]time.Time{"a.pt": old, "b.pt": newer} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := latestModTime(dir); !got.Equal(newer) {
+		t.Errorf("latestModTime(dir) = %v, want newest entry %v", got, newer)
+	}
+	if got := latestModTime(filepath.Join(dir, "a.pt")); !got.Equal(old) {
+		t.Errorf("latestModTime(file) = %v, want %v", got, old)
+	}
+}
+
+func TestCanCheckpoint(t *testing.T) {
+	for state, want := range map[string]bool{
+		"active": true, "activating": true, "stalled": true,
+		"paused": false, "exited": false, "failed": false,
+	} {
+		if got := canCheckpoint(state); got != want {
+			t.Errorf("canCheckpoint(%q) = %v, want %v", state, got, want)
+		}
+	}
+}
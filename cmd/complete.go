@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+)
+
+// completionJobLimit caps how many recent jobs are offered as completions.
+const completionJobLimit = 50
+
+// jobStates are the values accepted by --state selectors.
+var jobStates = []string{"active", "paused", "stalled", "failed", "exited", "activating", "deactivating", "unknown"}
+
+var signalNames = []string{"SIGTERM", "SIGINT", "SIGHUP", "SIGQUIT", "SIGKILL", "SIGUSR1", "SIGUSR2", "SIGSTOP", "SIGCONT"}
+
+// propertyNames are commonly used systemd-run properties, completed as
+// "Name=" for --property.
+var propertyNames = []string{
+	"AllowedCPUs", "CPUQuota", "CPUWeight", "Environment", "EnvironmentFile",
+	"IOWeight", "KillSignal", "LogRateLimitBurst", "LogRateLimitIntervalSec",
+	"MemoryHigh", "MemoryMax", "MemorySwapMax", "Nice", "OOMPolicy",
+	"RuntimeMaxSec", "Slice", "StandardError", "StandardOutput",
+	"SuccessExitStatus", "TasksMax", "TimeoutStopSec",
+}
+
+func isActiveState(state string) bool {
+	return state == "active" || state == "activating" || state == "paused" || state == "stalled"
+}
+
+func anyState(string) bool {
+	return true
+}
+
+// completeJobs returns a ValidArgsFunction suggesting recent job ids, with
+// name, state and age as descriptions, limited to states accepted by keep.
+func completeJobs(keep func(state string) bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		jobs, err := db.ListJobs(completionJobLimit, false)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		given := make(map[string]bool)
+		for _, arg := range args {
+			given[arg] = true
+		}
+
+		infos := showJobUnits(jobs)
+		now := time.Now()
+
+		var completions []string
+		for _, job := range jobs {
+			id := fmt.Sprintf("%d", job.ID)
+			if given[id] || !strings.HasPrefix(id, toComplete) {
+				continue
+			}
+
+			state := jobState(job, infos)
+			if !keep(state) {
+				continue
+			}
+
+			desc := fmt.Sprintf("%s, %s", job.Name, state)
+			if created, err := time.Parse(time.RFC3339, job.CreatedAtUTC); err == nil {
+				desc += ", " + formatAge(now.Sub(created)) + " ago"
+			}
+			completions = append(completions, id+"\t"+desc)
+		}
+
+		return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+	}
+}
+
+// formatAge renders d in its largest whole unit, e.g. "3h" or "2d".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func fixedCompletions(values []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return cobra.FixedCompletions(values, cobra.ShellCompDirectiveNoFileComp)
+}
+
+func completeGroups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	groups, err := db.ListGroups()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return groups, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+func completeNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names, err := db.ListNames()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	tags, err := db.ListTags()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return tags, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return cfg.ProfileNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	templates, err := db.ListTemplates()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	names := make([]string, len(templates))
+	for i, t := range templates {
+		names[i] = t.Name
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProperties completes "Name=" for --property; values are left to
+// the user.
+func completeProperties(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.Contains(toComplete, "=") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := make([]string, len(propertyNames))
+	for i, name := range propertyNames {
+		completions[i] = name + "="
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// registerSelectorCompletions wires completion for the positional job
+// arguments and the flags added by addSelectorFlags.
+func registerSelectorCompletions(cmd *cobra.Command, keep func(state string) bool) {
+	cmd.ValidArgsFunction = completeJobs(keep)
+	cmd.RegisterFlagCompletionFunc("state", fixedCompletions(jobStates))
+	cmd.RegisterFlagCompletionFunc("group", completeGroups)
+	cmd.RegisterFlagCompletionFunc("name", completeNames)
+	cmd.RegisterFlagCompletionFunc("tag", completeTags)
+}
+
+func completeSweepGroup(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeGroups(cmd, args, toComplete)
+}
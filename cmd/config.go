@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/config"
+)
+
+// cfg holds the effective configuration; it is replaced by initConfig once
+// the config file has been read.
+var cfg = config.Default()
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect jr configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigShow,
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+}
+
+func initConfig() {
+	loaded, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	cfg = loaded
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	path, err := config.Path()
+	if err != nil {
+		return fmt.Errorf("failed to locate config: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		fmt.Printf("# %s\n", path)
+	} else {
+		fmt.Printf("# %s (not found, using built-in defaults)\n", path)
+	}
+
+	return cfg.Write(os.Stdout)
+}
+
+// useColor reports whether output should be colorized according to the
+// configured color mode.
+func useColor() bool {
+	switch cfg.Defaults.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return isTerminal()
+}
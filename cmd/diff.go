@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	diffJSON bool
+	diffAll  bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <job> <job> [flags]",
+	Short: "Compare two jobs",
+	Long: `Compare how two jobs were run and how they ended, side by side: command,
+working directory, environment, resource limits and other properties,
+parameters, git snapshot (see 'jr run --snapshot'), exit status, duration
+and resource usage.
+
+Only the differences are shown unless --all is given. Secret values are
+redacted, and properties jr generates for each unit are left out.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeJobs(anyState),
+	RunE:              runDiff,
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffJSON, "json", false, "output as JSON")
+	diffCmd.Flags().BoolVar(&diffAll, "all", false, "also show what is the same")
+}
+
+// Groups of compared facts, in display order.
+const (
+	diffGroupJob = iota
+	diffGroupEnv
+	diffGroupLimits
+	diffGroupProps
+	diffGroupParams
+	diffGroupGit
+	diffGroupOutcome
+)
+
+// jobFact is one compared value of a job.
+type jobFact struct {
+	Group int
+	// Order sorts facts of the fixed groups; facts from maps such as the
+	// environment sort by label.
+	Order int
+	Label string
+	Value string
+}
+
+// DiffRow is a compared fact as jr diff --json prints it. A value is empty
+// if the job has none.
+type DiffRow struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Same  bool   `json:"same"`
+}
+
+// DiffJob identifies a compared job in jr diff --json.
+type DiffJob struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+}
+
+// DiffOutput is what jr diff --json prints.
+type DiffOutput struct {
+	A    DiffJob   `json:"a"`
+	B    DiffJob   `json:"b"`
+	Rows []DiffRow `json:"rows"`
+}
+
+// resourceLimitProps are the properties shown as resource limits rather
+// than as other properties, besides the Limit*= rlimits.
+var resourceLimitProps = map[string]bool{
+	"MemoryMax": true, "MemoryHigh": true, "MemorySwapMax": true,
+	"CPUQuota": true, "CPUWeight": true, "AllowedCPUs": true,
+	"IOWeight": true, "TasksMax": true, "RuntimeMaxSec": true, "Nice": true,
+}
+
+func isResourceLimit(prop string) bool {
+	return resourceLimitProps[prop] || strings.HasPrefix(prop, "Limit")
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	var jobs []*db.Job
+	for _, arg := range args {
+		job, err := db.ResolveJob(arg)
+		var ambiguous *db.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find job: %w", err)
+		}
+		if job == nil {
+			return fmt.Errorf("job not found: %s", arg)
+		}
+		jobs = append(jobs, job)
+	}
+
+	infos := showJobUnits(jobs)
+	a, b := jobs[0], jobs[1]
+	rows := diffFacts(jobFacts(a, unitInfoOrEmpty(a, infos)), jobFacts(b, unitInfoOrEmpty(b, infos)))
+	if !diffAll {
+		var different []DiffRow
+		for _, row := range rows {
+			if !row.Same {
+				different = append(different, row)
+			}
+		}
+		rows = different
+	}
+
+	if diffJSON {
+		if rows == nil {
+			rows = []DiffRow{}
+		}
+		output := DiffOutput{
+			A:    DiffJob{ID: a.ID, Name: a.Name, Unit: a.Unit},
+			B:    DiffJob{ID: b.ID, Name: b.Name, Unit: b.Unit},
+			Rows: rows,
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(output)
+	}
+
+	if len(rows) == 0 {
+		fmt.Printf("Jobs %d and %d do not differ\n", a.ID, b.ID)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\t%s\t%s\n",
+		diffColor("01", fmt.Sprintf("%d %s", a.ID, a.Name)), diffColor("01", fmt.Sprintf("%d %s", b.ID, b.Name)))
+	for _, row := range rows {
+		left, right := diffColor("39", diffCell(row.A)), diffColor("39", diffCell(row.B))
+		if !row.Same {
+			left, right = diffColor("31", diffCell(row.A)), diffColor("32", diffCell(row.B))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row.Field, left, right)
+	}
+	return w.Flush()
+}
+
+// diffColor wraps s in the two-digit SGR code when color is enabled. Every
+// cell gets an escape of the same width, so tabwriter keeps the columns
+// aligned.
+func diffColor(code, s string) string {
+	if !useColor() {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// diffCell renders a value for the side-by-side table.
+func diffCell(value string) string {
+	const maxLen = 50
+	if value == "" {
+		return "-"
+	}
+	value = strings.ReplaceAll(value, "\n", " ")
+	if len(value) > maxLen {
+		value = value[:maxLen-3] + "..."
+	}
+	return value
+}
+
+// diffFacts pairs up the facts of two jobs in display order.
+func diffFacts(a, b []jobFact) []DiffRow {
+	type pair struct {
+		fact jobFact
+		a, b string
+	}
+	pairs := make(map[string]*pair)
+	var order []*pair
+	for i, facts := range [][]jobFact{a, b} {
+		for _, f := range facts {
+			p := pairs[f.Label]
+			if p == nil {
+				p = &pair{fact: f}
+				pairs[f.Label] = p
+				order = append(order, p)
+			}
+			if i == 0 {
+				p.a = f.Value
+			} else {
+				p.b = f.Value
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		fi, fj := order[i].fact, order[j].fact
+		if fi.Group != fj.Group {
+			return fi.Group < fj.Group
+		}
+		if fi.Order != fj.Order {
+			return fi.Order < fj.Order
+		}
+		return fi.Label < fj.Label
+	})
+
+	rows := make([]DiffRow, len(order))
+	for i, p := range order {
+		rows[i] = DiffRow{Field: p.fact.Label, A: p.a, B: p.b, Same: p.a == p.b}
+	}
+	return rows
+}
+
+// jobFacts lists what jr diff compares about job.
+func jobFacts(job *db.Job, info *systemd.UnitInfo) []jobFact {
+	var facts []jobFact
+	add := func(group, order int, label, value string) {
+		if value != "" {
+			facts = append(facts, jobFact{Group: group, Order: order, Label: label, Value: value})
+		}
+	}
+
+	var argv []string
+	json.Unmarshal([]byte(job.ArgvJSON), &argv)
+	add(diffGroupJob, 0, "Name", job.Name)
+	add(diffGroupJob, 1, "Command", formatArgv(argv))
+	add(diffGroupJob, 2, "Working Dir", job.Cwd)
+	add(diffGroupJob, 3, "Group", job.GroupName.String)
+	add(diffGroupJob, 4, "Tags", strings.Join(jobTags(job), ", "))
+	add(diffGroupJob, 5, "Host", job.Host.String)
+	if rules := jobSuccessRules(job); rules != nil {
+		add(diffGroupJob, 6, "Success if", formatSuccessRules(rules))
+	}
+
+	var env map[string]string
+	json.Unmarshal([]byte(job.EnvJSON), &env)
+	for k, v := range cfg.Env.Redact(env) {
+		add(diffGroupEnv, 0, "Env "+k, v)
+	}
+
+	var props map[string]string
+	json.Unmarshal([]byte(job.PropertiesJSON), &props)
+	for k, v := range userProperties(job, props) {
+		if isResourceLimit(k) {
+			add(diffGroupLimits, 0, "Limit "+k, v)
+		} else {
+			add(diffGroupProps, 0, "Property "+k, v)
+		}
+	}
+
+	var params map[string]string
+	if job.ParamsJSON.Valid {
+		json.Unmarshal([]byte(job.ParamsJSON.String), &params)
+	}
+	for k, v := range params {
+		add(diffGroupParams, 0, "Param "+k, v)
+	}
+
+	if snapshot := jobSnapshot(job); snapshot != nil {
+		add(diffGroupGit, 0, "Git commit", snapshot.GitCommit)
+		add(diffGroupGit, 1, "Git branch", snapshot.GitBranch)
+		if snapshot.GitCommit != "" {
+			uncommitted := "none"
+			if snapshot.GitDiffSHA256 != "" {
+				uncommitted = "sha256 " + snapshot.GitDiffSHA256[:12]
+			}
+			add(diffGroupGit, 2, "Uncommitted", uncommitted)
+			add(diffGroupGit, 3, "Untracked", fmt.Sprintf("%d files", snapshot.GitUntracked))
+		}
+		add(diffGroupGit, 4, "Executable", snapshot.Executable)
+		add(diffGroupGit, 5, "Executable sha256", snapshot.ExecutableSHA256)
+	}
+
+	state := unitState(job, info)
+	add(diffGroupOutcome, 0, "State", state)
+	add(diffGroupOutcome, 1, "Verdict", jobVerdict(job, state))
+	if info.ExecMainStatus != "" && !info.Gone() && !isActiveState(state) {
+		add(diffGroupOutcome, 2, "Exit status", info.ExecMainStatus)
+	} else {
+		add(diffGroupOutcome, 2, "Exit status", job.ExitStatus.String)
+	}
+	if d, running := jobDuration(job, info); d > 0 {
+		duration := d.Round(time.Second).String()
+		if running {
+			duration += " so far"
+		}
+		add(diffGroupOutcome, 3, "Duration", duration)
+	}
+	cpuUsage, memoryPeak := jobUsage(job, info)
+	if cpuUsage > 0 {
+		add(diffGroupOutcome, 4, "CPU time", roundDuration(cpuUsage).String())
+	}
+	if memoryPeak > 0 {
+		add(diffGroupOutcome, 5, "Memory peak", formatSize(memoryPeak))
+	}
+	return facts
+}
+
+// jobDuration returns how long job ran, or has been running, from its
+// unit's timestamps while systemd has it and the recorded ones after.
+func jobDuration(job *db.Job, info *systemd.UnitInfo) (d time.Duration, running bool) {
+	started, ok := systemd.ParseTimestamp(info.ExecMainStartTimestamp)
+	if !ok {
+		if started, ok = parseUTC(job.StartedAtUTC.String); !ok {
+			return 0, false
+		}
+	}
+	finished, ok := systemd.ParseTimestamp(info.ExecMainExitTimestamp)
+	if !ok {
+		finished, ok = parseUTC(job.FinishedAtUTC.String)
+	}
+	if !ok {
+		if !isActiveState(unitState(job, info)) {
+			return 0, false
+		}
+		return time.Since(started), true
+	}
+	return finished.Sub(started), false
+}
+
+func parseUTC(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+func TestJobDiff(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	a := &db.Job{
+		ID:             1,
+		Name:           "train",
+		Unit:           "jr-train-1.service",
+		Cwd:            "/work",
+		ArgvJSON:       `["python","train.py"]`,
+		EnvJSON:        `{"LR":"0.1","API_TOKEN":"hunter2","SEED":"1"}`,
+		PropertiesJSON: `{"MemoryMax":"4G","ExecStopPost":"-\"/usr/bin/jr\" \"_finish\" \"--db\" \"/jr.db\" \"--unit\" \"jr-train-1.service\""}`,
+		LastKnownState: sql.NullString{String: "exited", Valid: true},
+		ExitStatus:     sql.NullString{String: "0", Valid: true},
+		StartedAtUTC:   sql.NullString{String: "2024-01-06T14:00:00Z", Valid: true},
+		FinishedAtUTC:  sql.NullString{String: "2024-01-06T15:30:00Z", Valid: true},
+		CPUUsageNSec:   sql.NullInt64{Int64: 5400e9, Valid: true},
+		SnapshotJSON:   sql.NullString{String: `{"gitCommit":"abc","gitBranch":"main"}`, Valid: true},
+	}
+	b := &db.Job{
+		ID:             2,
+		Name:           "train",
+		Unit:           "jr-train-2.service",
+		Cwd:            "/work",
+		ArgvJSON:       `["python","train.py"]`,
+		EnvJSON:        `{"LR":"0.2","API_TOKEN":"hunter3","SEED":"1"}`,
+		PropertiesJSON: `{"MemoryMax":"8G","Nice":"10","ExecStopPost":"-\"/usr/bin/jr\" \"_finish\" \"--db\" \"/jr.db\" \"--unit\" \"jr-train-2.service\""}`,
+		LastKnownState: sql.NullString{String: "failed", Valid: true},
+		ExitStatus:     sql.NullString{String: "1", Valid: true},
+		StartedAtUTC:   sql.NullString{String: "2024-01-07T14:00:00Z", Valid: true},
+		FinishedAtUTC:  sql.NullString{String: "2024-01-07T14:05:00Z", Valid: true},
+		SnapshotJSON:   sql.NullString{String: `{"gitCommit":"def","gitBranch":"main"}`, Valid: true},
+	}
+
+	rows := diffFacts(jobFacts(a, &systemd.UnitInfo{Unit: a.Unit}), jobFacts(b, &systemd.UnitInfo{Unit: b.Unit}))
+	got := make(map[string]DiffRow)
+	var fields []string
+	for _, row := range rows {
+		got[row.Field] = row
+		fields = append(fields, row.Field)
+	}
+
+	want := map[string][2]string{
+		"Command":         {"python train.py", "python train.py"},
+		"Env API_TOKEN":   {"<redacted>", "<redacted>"},
+		"Env LR":          {"0.1", "0.2"},
+		"Limit MemoryMax": {"4G", "8G"},
+		"Limit Nice":      {"", "10"},
+		"Git commit":      {"abc", "def"},
+		"Git branch":      {"main", "main"},
+		"State":           {"exited", "failed"},
+		"Exit status":     {"0", "1"},
+		"Duration":        {"1h30m0s", "5m0s"},
+		"CPU time":        {"1h30m0s", ""},
+		"Uncommitted":     {"none", "none"},
+	}
+	for field, values := range want {
+		row, ok := got[field]
+		if !ok || row.A != values[0] || row.B != values[1] || row.Same != (values[0] == values[1]) {
+			t.Errorf("%s: got %+v, expected %q", field, row, values)
+		}
+	}
+	// Limits are not repeated as properties, and the generated notify
+	// hook is left out
+	for _, field := range []string{"Property MemoryMax", "Property Nice", "Property ExecStopPost"} {
+		if row, ok := got[field]; ok {
+			t.Errorf("Expected no %s row, got %+v", field, row)
+		}
+	}
+
+	// Job facts come first and the outcome last
+	if fields[0] != "Name" || fields[len(fields)-1] != "CPU time" {
+		t.Errorf("Unexpected order %q", fields)
+	}
+}
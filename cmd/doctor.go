@@ -1,10 +1,16 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
 	"github.com/user/jr/systemd"
 )
 
@@ -17,114 +23,434 @@ const (
 	colorBold   = "\033[1m"
 )
 
+var (
+	doctorJSON bool
+	doctorFix  bool
+)
+
 var doctorCmd = &cobra.Command{
-	Use:   "doctor",
+	Use:   "doctor [flags]",
 	Short: "Check environment and prerequisites",
-	RunE:  runDoctor,
+	Long: `Check that the system can run jr jobs reliably: the user service
+manager and its session environment, systemd features, cgroup controller
+delegation, journal persistence, the job database and free disk space.
+
+Exits non-zero if any check fails; warnings do not. With --fix, problems
+that can be repaired without touching running jobs or needing root, such
+as disabled lingering or a missing maintenance timer, are repaired and
+checked again.`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
 }
 
-func runDoctor(cmd *cobra.Command, args []string) error {
-	useColor := isTerminal()
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "output results as JSON")
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "repair what can safely be repaired")
+}
 
-	fmt.Println("Checking environment...")
-	fmt.Println()
+// Check statuses, from best to worst.
+const (
+	checkOK   = "ok"
+	checkSkip = "skip"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
 
-	allOK := true
+// checkResult is the outcome of one doctor check.
+type checkResult struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+	Fixed       bool   `json:"fixed,omitempty"`
+	FixError    string `json:"fixError,omitempty"`
+}
 
-	fmt.Print("systemd user instance: ")
-	if err := systemd.CheckUserSystemd(); err != nil {
-		if useColor {
-			fmt.Printf("%sFAIL%s\n", colorRed, colorReset)
-		} else {
-			fmt.Println("FAIL")
-		}
-		fmt.Printf("  Error: %v\n", err)
-		allOK = false
+// doctorCheck is one thing doctor verifies.
+type doctorCheck struct {
+	ID    string
+	Title string
+	Run   func() checkResult
+	// Fix repairs a warning or failure; nil when there is no safe fix.
+	Fix func(w io.Writer) error
+}
+
+func passed(format string, a ...interface{}) checkResult {
+	return checkResult{Status: checkOK, Message: fmt.Sprintf(format, a...)}
+}
+
+func skipped(format string, a ...interface{}) checkResult {
+	return checkResult{Status: checkSkip, Message: fmt.Sprintf(format, a...)}
+}
+
+func warned(remediation, format string, a ...interface{}) checkResult {
+	return checkResult{Status: checkWarn, Message: fmt.Sprintf(format, a...), Remediation: remediation}
+}
+
+func failed(remediation, format string, a ...interface{}) checkResult {
+	return checkResult{Status: checkFail, Message: fmt.Sprintf(format, a...), Remediation: remediation}
+}
+
+var doctorChecks = []doctorCheck{
+	{ID: "session-env", Title: "session environment", Run: checkSessionEnv},
+	{ID: "user-manager", Title: "systemd user instance", Run: checkUserManager},
+	{ID: "systemd-run", Title: "systemd-run", Run: checkCommand("systemd-run", "install the systemd package")},
+	{ID: "journalctl", Title: "journalctl", Run: checkCommand("journalctl", "install the systemd package")},
+	{ID: "systemd-version", Title: "systemd version", Run: checkSystemdVersion},
+	{ID: "cgroup-v2", Title: "cgroup v2", Run: checkCgroupV2},
+	{ID: "cgroup-delegation", Title: "cgroup delegation", Run: checkDelegation},
+	{ID: "journal-persistent", Title: "persistent journal", Run: checkJournalPersistent},
+	{ID: "user-journal", Title: "user journal", Run: checkUserJournal},
+	{ID: "lingering", Title: "lingering", Run: checkLingering, Fix: fixLingering},
+	{ID: "db-integrity", Title: "database integrity", Run: checkDBIntegrity},
+	{ID: "db-schema", Title: "database schema", Run: checkDBSchema},
+	{ID: "disk-space", Title: "state dir disk space", Run: checkDiskSpace},
+	{ID: "maintenance", Title: "maintenance timer", Run: checkMaintenance, Fix: fixMaintenance},
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	// Fix progress would corrupt JSON on stdout
+	progress := io.Writer(os.Stdout)
+	if doctorJSON {
+		progress = os.Stderr
 	} else {
-		if useColor {
-			fmt.Printf("%sOK%s\n", colorGreen, colorReset)
-		} else {
-			fmt.Println("OK")
+		fmt.Println("Checking environment...")
+		fmt.Println()
+	}
+
+	results := runDoctorChecks(doctorChecks, doctorFix, progress)
+
+	var failures, warnings int
+	for _, r := range results {
+		switch r.Status {
+		case checkFail:
+			failures++
+		case checkWarn:
+			warnings++
 		}
 	}
 
-	fmt.Print("systemd-run: ")
-	if err := systemd.CheckSystemdRun(); err != nil {
-		if useColor {
-			fmt.Printf("%sFAIL%s\n", colorRed, colorReset)
-		} else {
-			fmt.Println("FAIL")
+	if doctorJSON {
+		out := struct {
+			OK     bool          `json:"ok"`
+			Checks []checkResult `json:"checks"`
+		}{failures == 0, results}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
 		}
-		fmt.Println("  systemd-run not found in PATH")
-		fmt.Println("  Install systemd package")
-		allOK = false
 	} else {
-		if useColor {
-			fmt.Printf("%sOK%s\n", colorGreen, colorReset)
-		} else {
-			fmt.Println("OK")
-		}
+		printDoctorResults(results, failures, warnings)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d checks failed", failures, len(results))
 	}
+	return nil
+}
+
+// runDoctorChecks runs checks in order. With fix, a check that warns or
+// fails and has a fix is repaired and run again.
+func runDoctorChecks(checks []doctorCheck, fix bool, progress io.Writer) []checkResult {
+	results := make([]checkResult, 0, len(checks))
+	for _, c := range checks {
+		r := c.Run()
 
-	fmt.Print("journalctl: ")
-	if err := systemd.CheckJournalctl(); err != nil {
-		if useColor {
-			fmt.Printf("%sFAIL%s\n", colorRed, colorReset)
-		} else {
-			fmt.Println("FAIL")
+		if fix && c.Fix != nil && (r.Status == checkWarn || r.Status == checkFail) {
+			fmt.Fprintf(progress, "Fixing %s...\n", c.Title)
+			if err := c.Fix(progress); err != nil {
+				r.FixError = err.Error()
+			} else {
+				r = c.Run()
+				r.Fixed = r.Status == checkOK
+			}
 		}
-		fmt.Println("  journalctl not found in PATH")
-		allOK = false
-	} else {
-		if useColor {
-			fmt.Printf("%sOK%s\n", colorGreen, colorReset)
-		} else {
-			fmt.Println("OK")
+
+		r.ID, r.Title = c.ID, c.Title
+		results = append(results, r)
+	}
+	return results
+}
+
+func printDoctorResults(results []checkResult, failures, warnings int) {
+	color := useColor()
+	paint := func(code, s string) string {
+		if !color {
+			return s
 		}
+		return code + s + colorReset
 	}
 
-	fmt.Print("lingering: ")
-	linger, err := systemd.CheckLingering()
-	if err != nil {
-		if useColor {
-			fmt.Printf("%sUNKNOWN%s\n", colorYellow, colorReset)
-		} else {
-			fmt.Println("UNKNOWN")
+	for _, r := range results {
+		var status string
+		switch r.Status {
+		case checkOK:
+			status = paint(colorGreen, "OK")
+		case checkWarn:
+			status = paint(colorYellow, "WARNING")
+		case checkFail:
+			status = paint(colorRed, "FAIL")
+		default:
+			status = "SKIPPED"
 		}
-		fmt.Printf("  Error checking: %v\n", err)
-	} else if linger {
-		if useColor {
-			fmt.Printf("%sOK (enabled)%s\n", colorGreen, colorReset)
-		} else {
-			fmt.Println("OK (enabled)")
+		if r.Fixed {
+			status += " (fixed)"
 		}
-	} else {
-		if useColor {
-			fmt.Printf("%sWARNING (not enabled)%s\n", colorYellow, colorReset)
-			fmt.Printf("  %sJobs may stop when you log out.%s\n", colorYellow, colorReset)
-			fmt.Printf("  To enable: %ssudo loginctl enable-linger %s%s\n", colorCyan, os.Getenv("USER"), colorReset)
-		} else {
-			fmt.Println("WARNING (not enabled)")
-			fmt.Printf("  Jobs may stop when you log out.\n")
-			fmt.Printf("  To enable: sudo loginctl enable-linger %s\n", os.Getenv("USER"))
+
+		fmt.Printf("%s: %s\n", r.Title, status)
+		if r.Message != "" {
+			fmt.Printf("  %s\n", r.Message)
+		}
+		if r.FixError != "" {
+			fmt.Printf("  Fix failed: %s\n", r.FixError)
+		}
+		if r.Remediation != "" && r.Status != checkOK {
+			lines := strings.Split(r.Remediation, "\n")
+			fmt.Printf("  To fix: %s\n", paint(colorCyan, lines[0]))
+			for _, line := range lines[1:] {
+				fmt.Printf("          %s\n", paint(colorCyan, line))
+			}
 		}
-		allOK = false
 	}
 
 	fmt.Println()
-	if allOK {
-		if useColor {
-			fmt.Printf("%s%sAll checks passed!%s\n", colorBold, colorGreen, colorReset)
-		} else {
-			fmt.Println("All checks passed!")
+	switch {
+	case failures > 0:
+		fmt.Println(paint(colorBold+colorRed, "Some checks failed. See above for details."))
+	case warnings > 0:
+		fmt.Println(paint(colorBold+colorYellow, fmt.Sprintf("All checks passed, with %d warnings.", warnings)))
+	default:
+		fmt.Println(paint(colorBold+colorGreen, "All checks passed!"))
+	}
+}
+
+func checkSessionEnv() checkResult {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	fallback := fmt.Sprintf("/run/user/%d", os.Getuid())
+	remedy := "export XDG_RUNTIME_DIR=" + fallback + "\n(log in through PAM, e.g. ssh or machinectl shell, rather than su or sudo)"
+
+	if runtimeDir == "" {
+		return failed(remedy, "XDG_RUNTIME_DIR is not set, so the user manager cannot be reached")
+	}
+	if info, err := os.Stat(runtimeDir); err != nil || !info.IsDir() {
+		return failed(remedy, "XDG_RUNTIME_DIR=%s does not exist", runtimeDir)
+	}
+
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return passed("XDG_RUNTIME_DIR and DBUS_SESSION_BUS_ADDRESS are set")
+	}
+	if _, err := os.Stat(filepath.Join(runtimeDir, "bus")); err == nil {
+		return passed("XDG_RUNTIME_DIR is set; session bus at %s/bus", runtimeDir)
+	}
+	return warned("export DBUS_SESSION_BUS_ADDRESS=unix:path="+runtimeDir+"/bus",
+		"DBUS_SESSION_BUS_ADDRESS is not set and %s/bus does not exist", runtimeDir)
+}
+
+func checkUserManager() checkResult {
+	if err := systemd.CheckUserSystemd(); err != nil {
+		return failed("make 'systemctl --user status' work; see the session-env check",
+			"systemctl --user status: %v", err)
+	}
+	return passed("reachable")
+}
+
+func checkCommand(name, remedy string) func() checkResult {
+	return func() checkResult {
+		if !systemd.CommandExistsInPath(name) {
+			return failed(remedy, "%s not found in PATH", name)
 		}
-	} else {
-		if useColor {
-			fmt.Printf("%s%sSome checks failed. See above for details.%s\n", colorBold, colorRed, colorReset)
-		} else {
-			fmt.Println("Some checks failed. See above for details.")
+		return passed("found in PATH")
+	}
+}
+
+func checkSystemdVersion() checkResult {
+	version, err := systemd.Version()
+	if err != nil {
+		return skipped("could not determine the systemd version: %v", err)
+	}
+
+	switch {
+	case version < systemd.VersionCollect:
+		return failed("upgrade systemd", "systemd %d is older than %d; jobs cannot be garbage-collected (--collect)",
+			version, systemd.VersionCollect)
+	case version < systemd.VersionFreeze:
+		return warned("upgrade systemd", "systemd %d is older than %d; 'jr pause' falls back to SIGSTOP",
+			version, systemd.VersionFreeze)
+	}
+	return passed("systemd %d supports --collect and freeze", version)
+}
+
+func checkCgroupV2() checkResult {
+	if !systemd.CgroupV2() {
+		return warned("boot with systemd.unified_cgroup_hierarchy=1",
+			"the unified cgroup hierarchy is not mounted; freezing and resource limits are unavailable")
+	}
+	return passed("unified hierarchy mounted")
+}
+
+// jobControllers are the cgroup controllers behind the resource limits of
+// profiles and run flags.
+var jobControllers = []string{"memory", "cpu", "io"}
+
+func checkDelegation() checkResult {
+	if !systemd.CgroupV2() {
+		return skipped("needs cgroup v2")
+	}
+
+	controllers, err := systemd.DelegatedControllers()
+	if err != nil {
+		return skipped("could not read the user manager's controllers: %v", err)
+	}
+
+	missing := missingControllers(controllers, jobControllers)
+	if len(missing) > 0 {
+		return warned("sudo mkdir -p /etc/systemd/system/user@.service.d\n"+
+			"printf '[Service]\\nDelegate=cpu cpuset io memory pids\\n' | sudo tee /etc/systemd/system/user@.service.d/delegate.conf\n"+
+			"sudo systemctl daemon-reload, then log out and back in",
+			"%s not delegated to the user manager; limits like memory_max have no effect",
+			strings.Join(missing, ", "))
+	}
+	return passed("%s delegated", strings.Join(jobControllers, ", "))
+}
+
+// missingControllers returns the entries of want absent from have.
+func missingControllers(have, want []string) []string {
+	var missing []string
+	for _, c := range want {
+		found := false
+		for _, h := range have {
+			if h == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, c)
 		}
 	}
+	return missing
+}
 
-	return nil
+func checkJournalPersistent() checkResult {
+	journald := systemd.ReadJournaldConfig()
+	switch {
+	case journald.Storage == "none":
+		return warned("set Storage=persistent in /etc/systemd/journald.conf, or run jobs with --tee",
+			"journald is configured with Storage=none; job output is discarded")
+	case !journald.Persistent():
+		return warned("sudo mkdir -p /var/log/journal && sudo systemctl restart systemd-journald\n"+
+			"(or run jobs with --tee, or set tee_logs = \"auto\")",
+			"journald keeps logs in memory only (Storage=%s); job logs are lost at reboot", journald.Storage)
+	}
+	return passed("logs are kept in /var/log/journal (Storage=%s)", journald.Storage)
+}
+
+func checkUserJournal() checkResult {
+	if !systemd.CommandExistsInPath("journalctl") {
+		return skipped("journalctl not found")
+	}
+	if !systemd.UserJournalReadable() {
+		return warned("ask an administrator to add you to the systemd-journal group, or run jobs with --tee",
+			"journalctl --user finds no journal files; jr logs cannot show job output")
+	}
+	return passed("journalctl --user can read your journal")
+}
+
+func checkLingering() checkResult {
+	linger, err := systemd.CheckLingering()
+	if err != nil {
+		return skipped("could not check: %v", err)
+	}
+	if !linger {
+		return warned("loginctl enable-linger "+os.Getenv("USER"),
+			"not enabled; jobs may stop when you log out")
+	}
+	return passed("enabled")
+}
+
+func fixLingering(io.Writer) error {
+	return systemd.EnableLingering()
+}
+
+func checkDBIntegrity() checkResult {
+	if dbErr != nil {
+		return failed("move the database aside and run 'jr sync' to re-adopt running jobs",
+			"cannot open the database: %v", dbErr)
+	}
+
+	problems, err := db.IntegrityCheck()
+	if err != nil {
+		return failed("move the database aside and run 'jr sync' to re-adopt running jobs",
+			"integrity check failed: %v", err)
+	}
+	if len(problems) > 0 {
+		return failed("restore a backup, or move the database aside and run 'jr sync'",
+			"database is corrupt: %s", strings.Join(problems, "; "))
+	}
+	return passed("ok")
+}
+
+func checkDBSchema() checkResult {
+	if dbErr != nil {
+		return skipped("database not open")
+	}
+
+	version, err := db.UserVersion()
+	if err != nil {
+		return failed("", "cannot read the schema version: %v", err)
+	}
+	if version > db.SchemaVersion {
+		return warned("upgrade jr",
+			"schema version %d is newer than this jr knows (%d); it was written by a newer jr",
+			version, db.SchemaVersion)
+	}
+	return passed("schema version %d", version)
+}
+
+// Free space below which the state dir check warns or fails.
+const (
+	diskSpaceWarn = 1 << 30
+	diskSpaceFail = 100 << 20
+)
+
+func checkDiskSpace() checkResult {
+	dir, err := db.StateDir()
+	if err != nil {
+		return skipped("could not locate the state dir: %v", err)
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return skipped("could not stat %s: %v", dir, err)
+	}
+	return diskSpaceResult(dir, int64(st.Bavail)*int64(st.Bsize))
+}
+
+func diskSpaceResult(dir string, free int64) checkResult {
+	remedy := "free up space, or remove old jobs with 'jr prune'"
+	switch {
+	case free < diskSpaceFail:
+		return failed(remedy, "only %s free for %s", formatSize(free), dir)
+	case free < diskSpaceWarn:
+		return warned(remedy, "only %s free for %s", formatSize(free), dir)
+	}
+	return passed("%s free for %s", formatSize(free), dir)
+}
+
+func checkMaintenance() checkResult {
+	info, err := systemd.ShowTimer(systemd.MaintenanceUnit + ".timer")
+	if err != nil {
+		return skipped("could not query the user manager: %v", err)
+	}
+	if info.LoadState == "not-found" || info.UnitFileState != "enabled" {
+		return warned("jr maintenance install",
+			"not installed; old jobs and logs accumulate until 'jr prune' is run")
+	}
+	return passed("installed and %s", info.ActiveState)
+}
+
+func fixMaintenance(w io.Writer) error {
+	return installMaintenance(w, cfg.Maint.Schedule)
 }
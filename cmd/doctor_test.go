@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestRunDoctorChecks(t *testing.T) {
+	broken := true
+	fixes := 0
+	checks := []doctorCheck{
+		{ID: "fine", Run: func() checkResult { return passed("ok") }},
+		{ID: "fixable", Run: func() checkResult {
+			if broken {
+				return warned("fix it", "broken")
+			}
+			return passed("ok")
+		}, Fix: func(io.Writer) error {
+			fixes++
+			broken = false
+			return nil
+		}},
+		{ID: "stubborn", Run: func() checkResult { return failed("", "broken") },
+			Fix: func(io.Writer) error { return errors.New("permission denied") }},
+	}
+
+	results := runDoctorChecks(checks, false, io.Discard)
+	if results[1].Status != checkWarn || fixes != 0 {
+		t.Fatalf("Expected no fixes without --fix, got %+v after %d fixes", results[1], fixes)
+	}
+
+	results = runDoctorChecks(checks, true, io.Discard)
+	if results[0].Fixed || results[0].ID != "fine" {
+		t.Errorf("Unexpected result for passing check: %+v", results[0])
+	}
+	if !results[1].Fixed || results[1].Status != checkOK || fixes != 1 {
+		t.Errorf("Expected fixable check to be fixed once, got %+v after %d fixes", results[1], fixes)
+	}
+	if results[2].Status != checkFail || results[2].FixError != "permission denied" {
+		t.Errorf("Expected failed fix to be reported, got %+v", results[2])
+	}
+}
+
+func TestMissingControllers(t *testing.T) {
+	got := missingControllers([]string{"cpuset", "cpu", "pids"}, jobControllers)
+	if want := []string{"memory", "io"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("missingControllers = %v, want %v", got, want)
+	}
+	if got := missingControllers([]string{"io", "memory", "cpu"}, jobControllers); got != nil {
+		t.Errorf("Expected nothing missing, got %v", got)
+	}
+}
+
+func TestDiskSpaceResult(t *testing.T) {
+	for free, want := range map[int64]string{
+		50 << 20:  checkFail,
+		500 << 20: checkWarn,
+		20 << 30:  checkOK,
+	} {
+		if got := diskSpaceResult("/state", free).Status; got != want {
+			t.Errorf("diskSpaceResult(%s) = %s, want %s", formatSize(free), got, want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+// finishCommand is the hidden first argument of the ExecStopPost= hook of
+// every job: jr _finish --db <path> --unit <unit> [--notify <command>
+// --notify-on <when>].
+const finishCommand = "_finish"
+
+// finishProperty returns the ExecStopPost= value that runs the finish hook
+// for unit, and then the notify command if the job's result matches on.
+func finishProperty(exe, dbPath, unit, notify, on string) string {
+	argv := []string{exe, finishCommand, "--db", dbPath, "--unit", unit}
+	if notify != "" {
+		argv = append(argv, "--notify", notify, "--notify-on", on)
+	}
+	// A failing hook must not fail the job
+	return "-" + systemd.ExecLine(argv)
+}
+
+// finishHook is the ExecStopPost= hook of every job. It records how the job
+// ended while systemd still has its unit, then its artifacts and verdict,
+// and runs the notify command. Like the _tee wrapper it runs inside the
+// job, so Execute calls it before any config or database is touched.
+func finishHook(args []string) error {
+	var dbPath, unit, notify, on string
+	fs := flag.NewFlagSet("jr "+finishCommand, flag.ContinueOnError)
+	fs.StringVar(&dbPath, "db", "", "")
+	fs.StringVar(&unit, "unit", "", "")
+	fs.StringVar(&notify, "notify", "", "")
+	fs.StringVar(&on, "notify-on", "", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if dbPath == "" || unit == "" {
+		return fmt.Errorf("usage: jr %s --db <path> --unit <unit>", finishCommand)
+	}
+	if err := openJobDB(dbPath); err != nil {
+		return err
+	}
+
+	job, err := db.GetJobByUnit(unit)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return fmt.Errorf("no job for unit %s", unit)
+	}
+
+	// The unit is still deactivating, so systemd has its timestamps and
+	// accounting; without them the times fall back to the hook's clock
+	info, err := systemd.ShowUnit(unit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jr: failed to query unit: %v\n", err)
+		info = &systemd.UnitInfo{Unit: unit}
+	}
+	exit := jobExit{Code: os.Getenv("EXIT_CODE"), Status: os.Getenv("EXIT_STATUS")}
+	state, started, finished := finishOutcome(os.Getenv("SERVICE_RESULT"), info, time.Now())
+	if err := db.RecordJobOutcome(job.ID, state, exit.Status, started, finished); err != nil {
+		return err
+	}
+	cpuUsage := time.Duration(systemd.ParseAccounting(info.CPUUsageNSec))
+	if err := db.SetJobUsage(job.ID, cpuUsage, systemd.ParseAccounting(info.MemoryPeak)); err != nil {
+		return err
+	}
+
+	var failed error
+	if rules := jobArtifactRules(job); rules != nil {
+		snapshot, err := snapshotArtifacts(rules, job.Cwd)
+		if err == nil {
+			err = db.RecordJobArtifacts(job.ID, snapshot)
+		}
+		if err != nil {
+			failed = fmt.Errorf("failed to record artifacts: %w", err)
+			fmt.Fprintf(os.Stderr, "jr: %v\n", failed)
+		} else {
+			fmt.Fprintf(os.Stderr, "jr: recorded %d artifacts\n", len(snapshot))
+		}
+	}
+
+	// Without success rules the job succeeded if systemd says so
+	result, reason := verdictFailure, ""
+	if state == "exited" {
+		result = verdictSuccess
+	}
+	if rules := jobSuccessRules(job); rules != nil {
+		result, reason = evaluateVerdict(rules, exit, job.Cwd, func() (io.ReadCloser, error) {
+			return jobOutput(job)
+		})
+		if err := db.SetJobVerdict(job.ID, result, reason); err != nil {
+			return err
+		}
+
+		if reason != "" {
+			fmt.Fprintf(os.Stderr, "jr: verdict: %s (%s)\n", result, reason)
+		} else {
+			fmt.Fprintf(os.Stderr, "jr: verdict: %s\n", result)
+		}
+	}
+
+	if notify == "" || (on != "" && on != "always" && on != result) {
+		return failed
+	}
+	cmd := exec.Command("/bin/sh", "-c", notify)
+	cmd.Env = append(os.Environ(), "JR_UNIT="+unit, "JR_VERDICT="+result, "JR_VERDICT_REASON="+reason)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return failed
+}
+
+// finishOutcome returns the final state of a job from the $SERVICE_RESULT
+// of its ExecStopPost= hook, and when it started and finished in UTC from
+// its unit, using now if the unit has no exit time.
+func finishOutcome(serviceResult string, info *systemd.UnitInfo, now time.Time) (state, started, finished string) {
+	state = "failed"
+	if serviceResult == "success" {
+		state = "exited"
+	}
+	started = utcTimestamp(info.ExecMainStartTimestamp)
+	finished = utcTimestamp(info.ExecMainExitTimestamp)
+	if finished == "" {
+		finished = now.UTC().Format(time.RFC3339)
+	}
+	return state, started, finished
+}
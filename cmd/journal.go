@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/jr/systemd"
+)
+
+// journalHost caches what launchJob needs to know about journald, which is
+// the same for every job of a sweep.
+var journalHost struct {
+	once     sync.Once
+	config   *systemd.JournaldConfig
+	readable bool
+	// warned is set once the risks have been printed.
+	warned bool
+}
+
+// journalRisks describes the ways the journal may lose the output of a job
+// started with props; none if its logs are safe.
+func journalRisks(props map[string]string) []string {
+	journalHost.once.Do(func() {
+		journalHost.config = systemd.ReadJournaldConfig()
+		journalHost.readable = systemd.UserJournalReadable()
+	})
+	journald := journalHost.config
+
+	var risks []string
+	switch {
+	case journald.Storage == "none":
+		risks = append(risks, "journald discards all output (Storage=none)")
+	case !journald.Persistent():
+		risks = append(risks, fmt.Sprintf("journald storage is volatile (Storage=%s), so logs will not survive a reboot", journald.Storage))
+	}
+
+	if !journalHost.readable {
+		risks = append(risks, "journalctl --user cannot read your journal, so 'jr logs' will show nothing")
+	}
+
+	interval, burst := journald.RateLimitInterval, journald.RateLimitBurst
+	if v, ok := props["LogRateLimitIntervalSec"]; ok {
+		if d, err := systemd.ParseTimespan(v); err == nil {
+			interval = d
+		}
+	}
+	if v, ok := props["LogRateLimitBurst"]; ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			burst = n
+		}
+	}
+	if strictRateLimit(interval, burst) {
+		risks = append(risks, fmt.Sprintf("journald drops output beyond %d lines per %s", burst, formatAge(interval)))
+	}
+
+	return risks
+}
+
+// strictRateLimit reports whether a journald rate limit is enabled and
+// tighter than journald's default.
+func strictRateLimit(interval time.Duration, burst int) bool {
+	if interval <= 0 || burst <= 0 {
+		return false
+	}
+	perSecond := float64(burst) / interval.Seconds()
+	return perSecond < float64(systemd.DefaultRateLimitBurst)/systemd.DefaultRateLimitInterval.Seconds()
+}
+
+// teeMode resolves a job's --tee setting ("", "always", "never" or "auto")
+// against the tee_logs config, returning whether to copy output to a file.
+// Unless copying, the journal risks are printed once per process.
+func teeMode(mode string, props map[string]string) bool {
+	if mode == "" {
+		mode = cfg.Defaults.TeeLogs
+	}
+	if mode == "always" {
+		return true
+	}
+	if mode == "never" && !cfg.Defaults.JournalCheck {
+		return false
+	}
+
+	risks := journalRisks(props)
+	if mode == "auto" && len(risks) > 0 {
+		return true
+	}
+
+	if cfg.Defaults.JournalCheck && !journalHost.warned {
+		for _, risk := range risks {
+			fmt.Fprintf(os.Stderr, "Warning: %s.\n", risk)
+		}
+		if len(risks) > 0 {
+			fmt.Fprintf(os.Stderr, "Use --tee to also copy output to a file, or set tee_logs = \"auto\".\n\n")
+		}
+		journalHost.warned = true
+	}
+	return false
+}
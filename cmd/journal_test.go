@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrictRateLimit(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		burst    int
+		want     bool
+	}{
+		{30 * time.Second, 10000, false},
+		{0, 10000, false},
+		{30 * time.Second, 0, false},
+		{30 * time.Second, 1000, true},
+		{time.Second, 1000, false},
+	}
+
+	for _, tt := range tests {
+		if got := strictRateLimit(tt.interval, tt.burst); got != tt.want {
+			t.Errorf("strictRateLimit(%s, %d) = %v, want %v", tt.interval, tt.burst, got, tt.want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ var (
 	listAll   bool
 	listState string
 	listName  string
+	listGroup string
+	listTag   string
 	listJSON  bool
 )
 
@@ -30,16 +32,35 @@ var listCmd = &cobra.Command{
 func init() {
 	listCmd.Flags().IntVar(&listLast, "last", 10, "show last N jobs")
 	listCmd.Flags().BoolVar(&listAll, "all", false, "show all jobs")
-	listCmd.Flags().StringVar(&listState, "state", "", "filter by state (active, inactive, failed, exited, unknown)")
+	listCmd.Flags().StringVar(&listState, "state", "", "filter by state (active, paused, failed, exited, unknown)")
 	listCmd.Flags().StringVar(&listName, "name", "", "filter by name prefix")
+	listCmd.Flags().StringVar(&listGroup, "group", "", "show all jobs in a group")
+	listCmd.Flags().StringVar(&listTag, "tag", "", "filter by tag")
 	listCmd.Flags().BoolVar(&listJSON, "json", false, "output as JSON")
+
+	listCmd.RegisterFlagCompletionFunc("state", fixedCompletions(jobStates))
+	listCmd.RegisterFlagCompletionFunc("group", completeGroups)
+	listCmd.RegisterFlagCompletionFunc("name", completeNames)
+	listCmd.RegisterFlagCompletionFunc("tag", completeTags)
 }
 
 func runList(cmd *cobra.Command, args []string) error {
 	var jobs []*db.Job
 	var err error
 
-	if listName != "" {
+	if !cmd.Flags().Changed("last") {
+		listLast = cfg.Defaults.ListLimit
+	}
+
+	if cfg.Defaults.AutoSync {
+		if _, err := reconcile(true, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: auto sync failed: %v\n", err)
+		}
+	}
+
+	if listGroup != "" {
+		jobs, err = db.ListJobsByGroup(listGroup)
+	} else if listName != "" {
 		jobs, err = db.ListJobsByName(listName, listLast)
 	} else if listAll {
 		jobs, err = db.ListJobs(0, true)
@@ -66,6 +87,26 @@ func runList(cmd *cobra.Command, args []string) error {
 		unitInfos = make(map[string]*systemd.UnitInfo)
 	}
 
+	if listTag != "" {
+		var tagged []*db.Job
+		for _, job := range jobs {
+			if hasTag(job, listTag) {
+				tagged = append(tagged, job)
+			}
+		}
+		jobs = tagged
+	}
+
+	if listState != "" {
+		var matched []*db.Job
+		for _, job := range jobs {
+			if jobState(job, unitInfos) == listState {
+				matched = append(matched, job)
+			}
+		}
+		jobs = matched
+	}
+
 	if listJSON {
 		return outputListJSON(jobs, unitInfos)
 	}
@@ -75,21 +116,20 @@ func runList(cmd *cobra.Command, args []string) error {
 
 func outputListJSON(jobs []*db.Job, unitInfos map[string]*systemd.UnitInfo) error {
 	type JobOutput struct {
-		ID      int64  `json:"id"`
-		Created string `json:"created"`
-		Name    string `json:"name"`
-		State   string `json:"state"`
-		Unit    string `json:"unit"`
-		Command string `json:"command"`
+		ID      int64    `json:"id"`
+		Created string   `json:"created"`
+		Name    string   `json:"name"`
+		State   string   `json:"state"`
+		Verdict string   `json:"verdict,omitempty"`
+		Unit    string   `json:"unit"`
+		Command string   `json:"command"`
+		Group   string   `json:"group,omitempty"`
+		Tags    []string `json:"tags,omitempty"`
 	}
 
 	var output []JobOutput
 	for _, job := range jobs {
-		info := unitInfos[job.Unit]
-		state := "unknown"
-		if info != nil {
-			state = systemd.GetStateString(info)
-		}
+		state := jobState(job, unitInfos)
 
 		var argv []string
 		if job.ArgvJSON != "" {
@@ -103,8 +143,11 @@ func outputListJSON(jobs []*db.Job, unitInfos map[string]*systemd.UnitInfo) erro
 			Created: job.CreatedAtUTC,
 			Name:    job.Name,
 			State:   state,
+			Verdict: jobVerdict(job, state),
 			Unit:    job.Unit,
 			Command: systemd.ShortenCommand(argv, 40),
+			Group:   job.GroupName.String,
+			Tags:    jobTags(job),
 		})
 	}
 
@@ -115,14 +158,10 @@ func outputListJSON(jobs []*db.Job, unitInfos map[string]*systemd.UnitInfo) erro
 
 func outputListTable(jobs []*db.Job, unitInfos map[string]*systemd.UnitInfo) error {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tCREATED\tNAME\tSTATE\tUNIT\tCMD")
+	fmt.Fprintln(w, "ID\tCREATED\tNAME\tSTATE\tVERDICT\tUNIT\tCMD")
 
 	for _, job := range jobs {
-		info := unitInfos[job.Unit]
-		state := "unknown"
-		if info != nil {
-			state = systemd.GetStateString(info)
-		}
+		state := jobState(job, unitInfos)
 
 		var argv []string
 		if job.ArgvJSON != "" {
@@ -134,31 +173,60 @@ func outputListTable(jobs []*db.Job, unitInfos map[string]*systemd.UnitInfo) err
 		created, _ := time.Parse(time.RFC3339, job.CreatedAtUTC)
 		createdStr := created.Format("Jan 02 15:04")
 
-		stateColored := state
-		if isTerminal() {
-			switch state {
-			case "active":
-				stateColored = "\033[32m" + state + "\033[0m"
-			case "failed":
-				stateColored = "\033[31m" + state + "\033[0m"
-			case "exited":
-				stateColored = "\033[90m" + state + "\033[0m"
-			}
-		}
-
 		cmdShort := systemd.ShortenCommand(argv, 30)
 		unitShort := job.Unit
 		if len(unitShort) > 30 {
 			unitShort = unitShort[:27] + "..."
 		}
 
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
-			job.ID, createdStr, job.Name, stateColored, unitShort, cmdShort)
+		verdict := jobVerdict(job, state)
+		if verdict == "" {
+			verdict = "-"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.ID, createdStr, job.Name, colorState(state), colorVerdict(verdict), unitShort, cmdShort)
 	}
 
 	return w.Flush()
 }
 
+// colorState wraps state in its display color when color is enabled.
+func colorState(state string) string {
+	if !useColor() {
+		return state
+	}
+
+	switch state {
+	case "active":
+		return "\033[32m" + state + "\033[0m"
+	case "failed":
+		return "\033[31m" + state + "\033[0m"
+	case "paused":
+		return "\033[33m" + state + "\033[0m"
+	case "stalled":
+		return "\033[35m" + state + "\033[0m"
+	case "exited":
+		return "\033[90m" + state + "\033[0m"
+	}
+	return state
+}
+
+// colorVerdict wraps verdict in its display color when color is enabled.
+func colorVerdict(verdict string) string {
+	if !useColor() {
+		return verdict
+	}
+
+	switch verdict {
+	case verdictSuccess:
+		return "\033[32m" + verdict + "\033[0m"
+	case verdictFailure:
+		return "\033[31m" + verdict + "\033[0m"
+	}
+	return verdict
+}
+
 func isTerminal() bool {
 	fileInfo, _ := os.Stdout.Stat()
 	return (fileInfo.Mode() & os.ModeCharDevice) != 0
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/jr/db"
+)
+
+// Values of jr run --log-file.
+const (
+	logFileCombined = "combined"
+	logFileSplit    = "split"
+)
+
+var logFileModes = []string{logFileCombined, logFileSplit}
+
+const logFollowInterval = 500 * time.Millisecond
+
+// logFilePaths returns the files a job's stdout and stderr are appended to
+// under the given --log-file mode; stderr is empty when combined. Files go
+// to the [logs] dir if configured, else to the job's directory.
+func logFilePaths(unit, mode string) (stdout, stderr string, err error) {
+	dir := expandHome(cfg.Logs.Dir)
+	base := strings.TrimSuffix(unit, ".service")
+	if dir == "" {
+		if dir, err = db.JobDir(unit); err != nil {
+			return "", "", err
+		}
+		base = ""
+	}
+
+	name := func(suffix string) string {
+		if base == "" {
+			return filepath.Join(dir, strings.TrimPrefix(suffix, "."))
+		}
+		return filepath.Join(dir, base+suffix)
+	}
+
+	switch mode {
+	case logFileCombined:
+		return name("." + teeLogName), "", nil
+	case logFileSplit:
+		return name(".stdout.log"), name(".stderr.log"), nil
+	}
+	return "", "", fmt.Errorf("invalid --log-file %q (expected %s)", mode, strings.Join(logFileModes, " or "))
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// jobWritesLogFile reports whether job was started with --log-file, so its
+// output is in its log files rather than the journal.
+func jobWritesLogFile(job *db.Job) bool {
+	if !job.LogFile.Valid {
+		return false
+	}
+	var props map[string]string
+	json.Unmarshal([]byte(job.PropertiesJSON), &props)
+	return strings.HasPrefix(props["StandardOutput"], "append:")
+}
+
+// jobLogFiles returns job's existing log files with their rotated
+// generations.
+func jobLogFiles(job *db.Job) []string {
+	var files []string
+	for _, f := range []string{job.LogFile.String, job.ErrLogFile.String} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+		rotated, _ := filepath.Glob(f + ".*.gz")
+		files = append(files, rotated...)
+	}
+	return files
+}
+
+// rotateLogFile compresses path into path.1.gz, shifting older
+// generations up and dropping those beyond keep, then truncates path. The
+// writer keeps its O_APPEND descriptor, so output written between the copy
+// and the truncation is lost, as with logrotate's copytruncate. It does
+// nothing unless path is larger than maxSize.
+func rotateLogFile(path string, maxSize int64, keep int) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() <= maxSize {
+		return false, nil
+	}
+
+	generation := func(i int) string { return fmt.Sprintf("%s.%d.gz", path, i) }
+
+	os.Remove(generation(keep))
+	for i := keep - 1; i >= 1; i-- {
+		os.Rename(generation(i), generation(i+1))
+	}
+
+	if keep > 0 {
+		if err := compressFile(path, generation(1)); err != nil {
+			return false, err
+		}
+	}
+	return true, os.Truncate(path, 0)
+}
+
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// rotateJobLogs rotates the log files of all jobs per the [logs] config,
+// returning how many it rotated.
+func rotateJobLogs() (int, error) {
+	if cfg.Logs.MaxSize == "" {
+		return 0, nil
+	}
+	maxSize, err := parseSize(cfg.Logs.MaxSize)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs, err := db.ListJobs(0, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	var rotated, failed int
+	for _, job := range jobs {
+		for _, path := range []string{job.LogFile.String, job.ErrLogFile.String} {
+			if path == "" {
+				continue
+			}
+			ok, err := rotateLogFile(path, maxSize, cfg.Logs.Keep)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, path, err)
+				failed++
+			} else if ok {
+				rotated++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return rotated, fmt.Errorf("failed to rotate %d log files", failed)
+	}
+	return rotated, nil
+}
+
+// tailLogFile writes the last lines of path to w, all of them if lines is
+// 0, then with follow keeps writing what is appended, across rotations,
+// until the process is interrupted. With follow, a file that does not exist
+// yet is waited for.
+func tailLogFile(w io.Writer, path string, lines int, follow bool) error {
+	f, err := os.Open(path)
+	for follow && errors.Is(err, fs.ErrNotExist) {
+		time.Sleep(logFollowInterval)
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	var offset int64
+	if lines > 0 {
+		if offset, err = tailOffset(f, lines); err != nil {
+			return err
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w, f)
+	if err != nil || !follow {
+		return err
+	}
+	offset += n
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			offset += int64(n)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		time.Sleep(logFollowInterval)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if current, err := f.Stat(); err == nil && !os.SameFile(info, current) {
+			// Replaced: read the new file from its start
+			f.Close()
+			if f, err = os.Open(path); err != nil {
+				return err
+			}
+			offset = 0
+		} else if info.Size() < offset {
+			// Truncated by rotation
+			f.Seek(0, io.SeekStart)
+			offset = 0
+		}
+	}
+}
+
+// tailOffset returns the offset in f at which its last n lines start,
+// reading backwards from the end.
+func tailOffset(f *os.File, n int) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := info.Size()
+
+	// A final newline ends the last line rather than starting another
+	pos := end
+	if pos > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, pos-1); err == nil && last[0] == '\n' {
+			pos--
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	for pos > 0 {
+		size := int64(len(buf))
+		if pos < size {
+			size = pos
+		}
+		pos -= size
+		if _, err := f.ReadAt(buf[:size], pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := size - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				continue
+			}
+			n--
+			if n == 0 {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/jr/db"
+)
+
+func TestLogFilePaths(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	saved := cfg.Logs.Dir
+	defer func() { cfg.Logs.Dir = saved }()
+
+	cfg.Logs.Dir = ""
+	jobDir, err := db.JobDir("jr-train-1.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, errPath, err := logFilePaths("jr-train-1.service", logFileCombined)
+	if err != nil || out != filepath.Join(jobDir, "output.log") || errPath != "" {
+		t.Errorf("Expected output.log in the job directory, got %q, %q, %v", out, errPath, err)
+	}
+
+	cfg.Logs.Dir = "/var/tmp/logs"
+	out, errPath, err = logFilePaths("jr-train-1.service", logFileSplit)
+	if err != nil || out != "/var/tmp/logs/jr-train-1.stdout.log" || errPath != "/var/tmp/logs/jr-train-1.stderr.log" {
+		t.Errorf("Expected split files in the log directory, got %q, %q, %v", out, errPath, err)
+	}
+
+	if _, _, err := logFilePaths("jr-train-1.service", "both"); err == nil {
+		t.Error("Expected an error for an invalid mode")
+	}
+}
+
+func TestJobWritesLogFile(t *testing.T) {
+	job := &db.Job{
+		LogFile:        sql.NullString{String: "/tmp/out.log", Valid: true},
+		PropertiesJSON: `{"StandardOutput":"append:/tmp/out.log"}`,
+	}
+	if !jobWritesLogFile(job) {
+		t.Error("Expected a --log-file job to write its log file")
+	}
+
+	// --tee keeps the journal as well
+	job.PropertiesJSON = `{}`
+	if jobWritesLogFile(job) {
+		t.Error("Expected a --tee job to read from the journal")
+	}
+}
+
+func TestRotateLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.log")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("small\n")
+	if rotated, err := rotateLogFile(path, 100, 2); rotated || err != nil {
+		t.Fatalf("Expected no rotation below max size, got %v, %v", rotated, err)
+	}
+
+	for _, content := range []string{"first\n", "second\n", "third\n"} {
+		write(content)
+		if rotated, err := rotateLogFile(path, 1, 2); !rotated || err != nil {
+			t.Fatalf("Expected rotation, got %v, %v", rotated, err)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("Expected the log file to be truncated, got %v", err)
+	}
+	for gen, want := range map[string]string{".1.gz": "third", ".2.gz": "second"} {
+		var out strings.Builder
+		if err := printLogFile(&out, path+gen, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(out.String()) != want {
+			t.Errorf("Expected %s to hold %q, got %q", gen, want, out.String())
+		}
+	}
+	if _, err := os.Stat(path + ".3.gz"); err == nil {
+		t.Error("Expected generations beyond keep to be dropped")
+	}
+}
+
+func TestTailLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.log")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		lines int
+		want  string
+	}{
+		{0, "one\ntwo\nthree\n"},
+		{2, "two\nthree\n"},
+		{10, "one\ntwo\nthree\n"},
+	} {
+		var out strings.Builder
+		if err := tailLogFile(&out, path, tt.lines, false); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("lines=%d: expected %q, got %q", tt.lines, tt.want, out.String())
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+// Values of jr run --log-limit-action.
+const (
+	logLimitWarn = "warn"
+	logLimitStop = "stop"
+)
+
+var logLimitActions = []string{logLimitWarn, logLimitStop}
+
+// Kinds of the events recorded when a job exceeds a log limit.
+const (
+	eventLogRate  = "log-rate"
+	eventLogBytes = "log-bytes"
+)
+
+// logLimits caps how much output a job may write. Output beyond a limit
+// is dropped, and with the stop action the job is stopped as well.
+type logLimits struct {
+	// Lines may be written per Interval; 0 for no rate limit.
+	Lines    int
+	Interval time.Duration
+	// Bytes may be written in total; 0 for no limit.
+	Bytes  int64
+	Action string
+}
+
+func (l logLimits) set() bool {
+	return l.Lines > 0 || l.Bytes > 0
+}
+
+// rate formats the rate limit as --max-log-rate takes it.
+func (l logLimits) rate() string {
+	return fmt.Sprintf("%d/%gs", l.Lines, l.Interval.Seconds())
+}
+
+// parseLogRate parses a --max-log-rate value: a number of lines, optionally
+// per interval, as in "1000", "1000/s" or "5000/30s". The default interval
+// is a second.
+func parseLogRate(s string) (int, time.Duration, error) {
+	count, per, _ := strings.Cut(s, "/")
+	lines, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || lines <= 0 {
+		return 0, 0, fmt.Errorf("invalid log rate %q (expected LINES[/INTERVAL], e.g. 1000/30s)", s)
+	}
+
+	interval := time.Second
+	if per = strings.TrimSpace(per); per != "" {
+		if c := per[0]; c >= 'a' && c <= 'z' {
+			per = "1" + per
+		}
+		if interval, err = systemd.ParseTimespan(per); err != nil || interval <= 0 {
+			return 0, 0, fmt.Errorf("invalid log rate %q (expected LINES[/INTERVAL], e.g. 1000/30s)", s)
+		}
+	}
+	return lines, interval, nil
+}
+
+// journaldRateLimit reports whether journald can enforce a job's rate
+// limit itself through LogRateLimit*= properties.
+var journaldRateLimit = sync.OnceValue(func() bool {
+	version, err := systemd.Version()
+	return err == nil && version >= systemd.VersionLogRateLimit
+})
+
+// logWatchdog enforces logLimits on the output a job writes through the
+// _tee wrapper. trip is called once per kind of limit exceeded, in its own
+// goroutine; wait waits for those calls to finish.
+type logWatchdog struct {
+	limits logLimits
+	now    func() time.Time
+	trip   func(kind, message string)
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowLines int
+	total       int64
+	stopped     bool
+	tripped     map[string]bool
+	trips       sync.WaitGroup
+}
+
+func newLogWatchdog(limits logLimits, trip func(kind, message string)) *logWatchdog {
+	return &logWatchdog{limits: limits, now: time.Now, trip: trip, tripped: make(map[string]bool)}
+}
+
+// admit accounts for output p and returns the length of its prefix that
+// is within the limits and may be written.
+func (w *logWatchdog) admit(p []byte) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return 0
+	}
+
+	keep := len(p)
+	if w.limits.Bytes > 0 && w.total+int64(keep) > w.limits.Bytes {
+		keep = int(w.limits.Bytes - w.total)
+		w.exceeded(eventLogBytes, fmt.Sprintf("wrote more than %s of output, the --max-log-bytes limit", formatSize(w.limits.Bytes)))
+		// Nothing more fits, whatever the action
+		w.stopped = true
+	}
+
+	if w.limits.Lines > 0 {
+		if now := w.now(); now.Sub(w.windowStart) >= w.limits.Interval {
+			w.windowStart, w.windowLines = now, 0
+		}
+		if w.windowLines >= w.limits.Lines {
+			keep = 0
+		}
+		for i := 0; i < keep; i++ {
+			if p[i] != '\n' {
+				continue
+			}
+			w.windowLines++
+			if w.windowLines == w.limits.Lines {
+				keep = i + 1
+			}
+		}
+		if keep < len(p) && !w.stopped {
+			w.exceeded(eventLogRate, fmt.Sprintf("wrote more than %d lines in %s, the --max-log-rate limit", w.limits.Lines, formatAge(w.limits.Interval)))
+		}
+	}
+
+	w.total += int64(keep)
+	return keep
+}
+
+// exceeded trips the watchdog for kind, the first time only. Called with
+// w.mu held.
+func (w *logWatchdog) exceeded(kind, message string) {
+	if w.limits.Action == logLimitStop {
+		w.stopped = true
+	}
+	if w.tripped[kind] {
+		return
+	}
+	w.tripped[kind] = true
+
+	w.trips.Add(1)
+	go func() {
+		defer w.trips.Done()
+		w.trip(kind, message)
+	}()
+}
+
+func (w *logWatchdog) wait() {
+	w.trips.Wait()
+}
+
+// logLimitTrip returns the watchdog's trip function for the job of unit:
+// it notes the event in the job's output, stops the job if the action is
+// stop, and records the event in the database at dbPath.
+func logLimitTrip(unit, dbPath, action string) func(kind, message string) {
+	var mu sync.Mutex
+	return func(kind, message string) {
+		outcome := "further output is dropped"
+		if action == logLimitStop {
+			outcome = "stopping the job"
+		}
+		// Straight to stderr, past the limits
+		fmt.Fprintf(os.Stderr, "jr: job %s; %s\n", message, outcome)
+
+		if action == logLimitStop && unit != "" {
+			if err := systemd.StopUnitNoBlock(unit); err != nil {
+				fmt.Fprintf(os.Stderr, "jr: failed to stop %s: %v\n", unit, err)
+			}
+		}
+
+		if unit == "" || dbPath == "" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := recordJobEvent(dbPath, unit, kind, message+"; "+outcome); err != nil {
+			fmt.Fprintf(os.Stderr, "jr: failed to record %s event: %v\n", kind, err)
+		}
+	}
+}
+
+var jobDB struct {
+	sync.Mutex
+	err error
+}
+
+// openJobDB opens the database at dbPath for code running inside a job,
+// once.
+func openJobDB(dbPath string) error {
+	jobDB.Lock()
+	defer jobDB.Unlock()
+	if db.DB == nil && jobDB.err == nil {
+		jobDB.err = db.Open(dbPath)
+	}
+	return jobDB.err
+}
+
+// recordJobEvent adds an event to the job of unit from inside the job.
+func recordJobEvent(dbPath, unit, kind, message string) error {
+	if err := openJobDB(dbPath); err != nil {
+		return err
+	}
+
+	ok, err := db.AddJobEvent(unit, kind, message)
+	if err == nil && !ok {
+		err = fmt.Errorf("no job for unit %s", unit)
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogRate(t *testing.T) {
+	tests := []struct {
+		in       string
+		lines    int
+		interval time.Duration
+		ok       bool
+	}{
+		{"1000", 1000, time.Second, true},
+		{"1000/s", 1000, time.Second, true},
+		{"5000/30s", 5000, 30 * time.Second, true},
+		{"100/min", 100, time.Minute, true},
+		{"0/s", 0, 0, false},
+		{"many", 0, 0, false},
+		{"10/fortnight", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		lines, interval, err := parseLogRate(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseLogRate(%q): unexpected error %v", tt.in, err)
+			continue
+		}
+		if lines != tt.lines || interval != tt.interval {
+			t.Errorf("parseLogRate(%q) = %d, %s; expected %d, %s", tt.in, lines, interval, tt.lines, tt.interval)
+		}
+	}
+}
+
+// testWatchdog returns a watchdog on a fake clock and the kinds it trips.
+func testWatchdog(limits logLimits) (*logWatchdog, *time.Time, *[]string) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var kinds []string
+	w := newLogWatchdog(limits, func(kind, message string) { kinds = append(kinds, kind) })
+	w.now = func() time.Time { return now }
+	return w, &now, &kinds
+}
+
+func TestLogWatchdogRate(t *testing.T) {
+	w, now, kinds := testWatchdog(logLimits{Lines: 3, Interval: 10 * time.Second, Action: logLimitWarn})
+
+	out := []byte("a\nb\nc\nd\n")
+	if n := w.admit(out); string(out[:n]) != "a\nb\nc\n" {
+		t.Errorf("Expected the first 3 lines, got %q", out[:n])
+	}
+	if n := w.admit([]byte("e\n")); n != 0 {
+		t.Errorf("Expected output dropped for the rest of the window, got %d bytes", n)
+	}
+
+	// A new window admits output again
+	*now = now.Add(10 * time.Second)
+	if n := w.admit([]byte("f\n")); n != 2 {
+		t.Errorf("Expected output admitted in a new window, got %d bytes", n)
+	}
+
+	w.wait()
+	if !reflect.DeepEqual(*kinds, []string{eventLogRate}) {
+		t.Errorf("Expected one log-rate trip, got %v", *kinds)
+	}
+}
+
+func TestLogWatchdogBytes(t *testing.T) {
+	w, _, kinds := testWatchdog(logLimits{Bytes: 5, Action: logLimitWarn})
+
+	if n := w.admit([]byte("abc")); n != 3 {
+		t.Errorf("Expected 3 bytes admitted, got %d", n)
+	}
+	if n := w.admit([]byte("defg")); n != 2 {
+		t.Errorf("Expected 2 bytes admitted up to the limit, got %d", n)
+	}
+	if n := w.admit([]byte("h")); n != 0 {
+		t.Errorf("Expected nothing admitted past the limit, got %d", n)
+	}
+
+	w.wait()
+	if !reflect.DeepEqual(*kinds, []string{eventLogBytes}) {
+		t.Errorf("Expected one log-bytes trip, got %v", *kinds)
+	}
+}
+
+func TestLogWatchdogStop(t *testing.T) {
+	w, now, _ := testWatchdog(logLimits{Lines: 1, Interval: time.Second, Action: logLimitStop})
+
+	w.admit([]byte("a\nb\n"))
+	*now = now.Add(time.Minute)
+	if n := w.admit([]byte("c\n")); n != 0 {
+		t.Errorf("Expected nothing admitted once stopping, got %d bytes", n)
+	}
+	w.wait()
+}
+
+func TestParseTeeArgs(t *testing.T) {
+	opts := &teeOptions{
+		File:   "/tmp/out.log",
+		Unit:   "jr-spam-1.service",
+		DB:     "/tmp/jr.db",
+		Limits: logLimits{Lines: 100, Interval: 30 * time.Second, Bytes: 1 << 20, Action: logLimitStop},
+
+		StallTimeout: 30 * time.Minute,
+		StallAction:  stallStop,
+		Notify:       "notify-send done",
+		NotifyOn:     "failure",
+	}
+	args := append(opts.args(), "--", "echo", "--file", "x")
+
+	got, copier, argv, err := parseTeeArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copier || !reflect.DeepEqual(got, opts) {
+		t.Errorf("Expected %+v, got %+v", opts, got)
+	}
+	if strings.Join(argv, " ") != "echo --file x" {
+		t.Errorf("Expected the command after --, got %v", argv)
+	}
+
+	// Limits alone, without a file
+	got, _, argv, err = parseTeeArgs([]string{"--max-log-bytes", "10", "--", "yes"})
+	if err != nil || got.File != "" || got.Limits.Bytes != 10 || strings.Join(argv, " ") != "yes" {
+		t.Errorf("Expected limits without a file, got %+v, %v, %v", got, argv, err)
+	}
+}
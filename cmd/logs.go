@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"bufio"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/user/jr/db"
@@ -9,19 +16,29 @@ import (
 )
 
 var (
-	logsFollow  bool
-	logsLines   int
-	logsSince   string
-	logsUntil   string
-	logsNoColor bool
-	logsRaw     bool
+	logsFollow   bool
+	logsLines    int
+	logsSince    string
+	logsUntil    string
+	logsNoColor  bool
+	logsRaw      bool
+	logsSelector jobSelector
 )
 
 var logsCmd = &cobra.Command{
-	Use:     "logs <id|unit>",
-	Short:   "Stream or print logs for a job",
+	Use:   "logs <job|range>... [flags]",
+	Short: "Stream or print logs for jobs",
+	Long: `Stream or print logs for jobs. Logs of several jobs are interleaved by time.
+
+Jobs started with 'jr run --log-file' are read from their log files,
+with stderr on stderr when split; --follow keeps reading them across
+rotations, and --since and --until do not apply.
+
+Once the journal no longer has a job's output, for example after a
+reboot with volatile journal storage, it is read from the copy kept with
+'jr run --tee' or else the archive saved by 'jr maintenance', if there is
+one; --since and --until do not apply to these.`,
 	Aliases: []string{"tail", "attach"},
-	Args:    cobra.ExactArgs(1),
 	RunE:    runLogs,
 }
 
@@ -32,16 +49,146 @@ func init() {
 	logsCmd.Flags().StringVar(&logsUntil, "until", "", "show logs until timestamp")
 	logsCmd.Flags().BoolVar(&logsNoColor, "no-color", false, "disable colored output")
 	logsCmd.Flags().BoolVar(&logsRaw, "raw", false, "show raw output without timestamp/hostname prefix")
+	addSelectorFlags(logsCmd, &logsSelector)
+	registerSelectorCompletions(logsCmd, anyState)
 }
 
 func runLogs(cmd *cobra.Command, args []string) error {
-	job, err := db.FindJobByPartial(args[0])
+	jobs, _, err := logsSelector.selectJobs(args)
 	if err != nil {
-		return fmt.Errorf("failed to find job: %w", err)
+		return err
+	}
+
+	var units []string
+	var files []*db.Job
+	for _, job := range jobs {
+		if jobWritesLogFile(job) {
+			files = append(files, job)
+			continue
+		}
+		if path, prefixed, ok := offlineLog(job); ok && !systemd.HasJournal(job.Unit) {
+			if err := printLogFile(os.Stdout, path, logsLines, logsRaw && prefixed); err != nil {
+				return fmt.Errorf("failed to read logs of %s from %s: %w", job.Unit, path, err)
+			}
+			continue
+		}
+		units = append(units, job.Unit)
+	}
+
+	if !logsFollow {
+		for _, job := range files {
+			if err := tailJobLogFiles(job, os.Stdout, os.Stderr, false); err != nil {
+				return err
+			}
+		}
+		if len(units) == 0 {
+			return nil
+		}
+		return systemd.Logs(units, false, logsLines, logsSince, logsUntil, logsNoColor, logsRaw)
+	}
+
+	// Follow the files alongside journalctl until interrupted
+	stdout, stderr := &lockedWriter{w: os.Stdout}, &lockedWriter{w: os.Stderr}
+	errs := make(chan error, len(files))
+	for _, job := range files {
+		go func(job *db.Job) {
+			errs <- tailJobLogFiles(job, stdout, stderr, true)
+		}(job)
 	}
-	if job == nil {
-		return fmt.Errorf("job not found: %s", args[0])
+	if len(units) > 0 {
+		return systemd.Logs(units, true, logsLines, logsSince, logsUntil, logsNoColor, logsRaw)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return <-errs
+}
+
+// tailJobLogFiles writes the --log-file output of job, its stderr file to
+// stderr if split. With follow, both files are followed concurrently.
+func tailJobLogFiles(job *db.Job, stdout, stderr io.Writer, follow bool) error {
+	tail := func(path string, w io.Writer) error {
+		err := tailLogFile(w, path, logsLines, follow)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read logs of %s from %s: %w", job.Unit, path, err)
+		}
+		return nil
 	}
 
-	return systemd.Logs(job.Unit, logsFollow, logsLines, logsSince, logsUntil, logsNoColor, logsRaw)
+	if !job.ErrLogFile.Valid {
+		return tail(job.LogFile.String, stdout)
+	}
+	if !follow {
+		if err := tail(job.LogFile.String, stdout); err != nil {
+			return err
+		}
+		return tail(job.ErrLogFile.String, stderr)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- tail(job.ErrLogFile.String, stderr) }()
+	if err := tail(job.LogFile.String, stdout); err != nil {
+		return err
+	}
+	return <-errs
+}
+
+// offlineLog returns the file holding job's output besides the journal:
+// the --tee copy, or else the journal archive. prefixed reports whether its
+// lines carry the journal's timestamp, hostname and unit prefix.
+func offlineLog(job *db.Job) (path string, prefixed, ok bool) {
+	if job.LogFile.Valid {
+		if _, err := os.Stat(job.LogFile.String); err == nil {
+			return job.LogFile.String, false, true
+		}
+	}
+	if path, ok := journalArchive(job); ok {
+		return path, true, true
+	}
+	return "", false, false
+}
+
+// printLogFile writes the last lines of a log file to w, all of them if
+// lines is 0. Files ending in .gz are decompressed. strip removes the
+// timestamp, hostname and unit prefix of journal lines as journalctl -o
+// cat would.
+func printLogFile(w io.Writer, path string, lines int, strip bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		r = zr
+	}
+
+	var tail []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strip {
+			if _, msg, ok := strings.Cut(line, ": "); ok {
+				line = msg
+			}
+		}
+		tail = append(tail, line)
+		if lines > 0 && len(tail) > lines {
+			tail = tail[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, line := range tail {
+		fmt.Fprintln(w, line)
+	}
+	return nil
 }
@@ -0,0 +1,443 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var maintSchedule string
+
+// journalArchiveName is the file in a job's directory holding the journal
+// output saved by maintenance.
+const journalArchiveName = "journal.log.gz"
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Manage periodic background maintenance",
+	Long: `Keep the job database tidy without having to remember to.
+
+'jr maintenance install' sets up a persistent systemd user timer that
+regularly runs 'jr maintenance run', which:
+
+  - reconciles the database with systemd, like 'jr sync';
+  - prunes jobs according to the [prune] config table, like 'jr prune';
+  - archives the journal output of finished jobs into their job directory,
+    so 'jr logs' still works after the journal has been rotated;
+  - rotates the files of jobs run with --log-file that exceed the
+    max_size of the [logs] config table;
+  - compacts the database.
+
+The schedule and log archiving are set in the [maintenance] config table.
+Timers only fire while the user manager runs; enable lingering to have
+them run while you are logged out.`,
+}
+
+var maintenanceInstallCmd = &cobra.Command{
+	Use:   "install [flags]",
+	Short: "Install and start the maintenance timer",
+	Args:  cobra.NoArgs,
+	RunE:  runMaintenanceInstall,
+}
+
+var maintenanceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop the maintenance timer and remove its unit files",
+	Args:  cobra.NoArgs,
+	RunE:  runMaintenanceUninstall,
+}
+
+var maintenanceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the maintenance timer and the outcome of the last run",
+	Args:  cobra.NoArgs,
+	RunE:  runMaintenanceStatus,
+}
+
+var maintenanceRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run maintenance now, as the timer does",
+	Args:  cobra.NoArgs,
+	RunE:  runMaintenanceRun,
+}
+
+func init() {
+	maintenanceInstallCmd.Flags().StringVar(&maintSchedule, "schedule", "", "when to run, as a systemd OnCalendar= expression (default from config, \"daily\")")
+	maintenanceCmd.AddCommand(maintenanceInstallCmd, maintenanceUninstallCmd, maintenanceStatusCmd, maintenanceRunCmd)
+}
+
+// maintenanceRun is the record of a maintenance run, kept for status.
+type maintenanceRun struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Adopted  int       `json:"adopted"`
+	Settled  int       `json:"settled"`
+	Pruned   int       `json:"pruned"`
+	Freed    int64     `json:"freed"`
+	Archived int       `json:"archived"`
+	Rotated  int       `json:"rotated"`
+	DBBefore int64     `json:"dbBefore"`
+	DBAfter  int64     `json:"dbAfter"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+func maintenanceRunPath() (string, error) {
+	stateDir, err := db.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "maintenance.json"), nil
+}
+
+func runMaintenanceInstall(cmd *cobra.Command, args []string) error {
+	schedule := maintSchedule
+	if schedule == "" {
+		schedule = cfg.Maint.Schedule
+	}
+	if err := systemd.ValidateCalendar(schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+
+	if err := installMaintenance(os.Stdout, schedule); err != nil {
+		return err
+	}
+
+	if cfg.Defaults.LingerCheck {
+		if lingering, err := systemd.CheckLingering(); err == nil && !lingering {
+			fmt.Fprintf(os.Stderr, "Warning: lingering is disabled; maintenance only runs while you are logged in (loginctl enable-linger)\n")
+		}
+	}
+	return nil
+}
+
+// installMaintenance writes the maintenance service and timer units and
+// enables the timer, reporting progress to w.
+func installMaintenance(w io.Writer, schedule string) error {
+	exe, err := jrExecutable()
+	if err != nil {
+		return err
+	}
+
+	// The user manager does not see the shell's environment, so pin the
+	// locations jr was configured with here.
+	env := make(map[string]string)
+	for _, key := range []string{"XDG_DATA_HOME", "XDG_CONFIG_HOME"} {
+		if v := os.Getenv(key); v != "" {
+			env[key] = v
+		}
+	}
+
+	service := systemd.MaintenanceUnit + ".service"
+	timer := systemd.MaintenanceUnit + ".timer"
+
+	for name, content := range map[string]string{
+		service: maintenanceServiceUnit(exe, env),
+		timer:   maintenanceTimerUnit(schedule),
+	} {
+		path, err := systemd.WriteUserUnit(name, content)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		fmt.Fprintf(w, "Wrote %s\n", path)
+	}
+
+	if err := systemd.DaemonReload(); err != nil {
+		return fmt.Errorf("failed to reload the user manager: %w", err)
+	}
+	if err := systemd.EnableUnit(timer); err != nil {
+		return fmt.Errorf("failed to enable %s: %w", timer, err)
+	}
+	fmt.Fprintf(w, "Enabled %s (%s)\n", timer, schedule)
+	return nil
+}
+
+// maintenanceServiceUnit renders the oneshot service running exe with env.
+func maintenanceServiceUnit(exe string, env map[string]string) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=jr maintenance: sync, prune, log archiving, database compaction\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=oneshot\n")
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(systemd.EnvironmentLine(k, env[k]) + "\n")
+	}
+
+	b.WriteString("ExecStart=" + systemd.ExecLine([]string{exe, "maintenance", "run"}) + "\n")
+	b.WriteString("Nice=10\n")
+	b.WriteString("IOSchedulingClass=idle\n")
+	return b.String()
+}
+
+// maintenanceTimerUnit renders the timer starting the service on schedule.
+// Persistent= catches up on runs missed while the machine was off.
+func maintenanceTimerUnit(schedule string) string {
+	return "[Unit]\n" +
+		"Description=Periodic jr maintenance\n" +
+		"\n[Timer]\n" +
+		"OnCalendar=" + schedule + "\n" +
+		"Persistent=true\n" +
+		"RandomizedDelaySec=15min\n" +
+		"\n[Install]\n" +
+		"WantedBy=timers.target\n"
+}
+
+func runMaintenanceUninstall(cmd *cobra.Command, args []string) error {
+	timer := systemd.MaintenanceUnit + ".timer"
+
+	// Fails harmlessly when the timer was never installed
+	systemd.DisableUnit(timer)
+
+	for _, name := range []string{timer, systemd.MaintenanceUnit + ".service"} {
+		if err := systemd.RemoveUserUnit(name); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	if err := systemd.DaemonReload(); err != nil {
+		return fmt.Errorf("failed to reload the user manager: %w", err)
+	}
+	systemd.ResetFailedUnit(systemd.MaintenanceUnit + ".service")
+
+	fmt.Printf("Removed %s\n", systemd.MaintenanceUnit)
+	return nil
+}
+
+func runMaintenanceStatus(cmd *cobra.Command, args []string) error {
+	timer := systemd.MaintenanceUnit + ".timer"
+
+	info, err := systemd.ShowTimer(timer)
+	switch {
+	case err != nil:
+		fmt.Printf("Timer:     unknown (%v)\n", err)
+	case info.LoadState == "not-found":
+		fmt.Println("Timer:     not installed (jr maintenance install)")
+	default:
+		fmt.Printf("Timer:     %s, %s\n", info.UnitFileState, info.ActiveState)
+		if t, ok := systemd.ParseTimestamp(info.NextElapse); ok {
+			fmt.Printf("Next run:  %s\n", t.Local().Format(time.RFC3339))
+		}
+	}
+
+	run, err := readMaintenanceRun()
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		fmt.Println("Last run:  never")
+		return nil
+	}
+
+	outcome := "ok"
+	if len(run.Errors) > 0 {
+		outcome = "failed"
+	}
+	fmt.Printf("Last run:  %s (%s ago, took %s): %s\n", run.Started.Local().Format(time.RFC3339),
+		formatAge(time.Since(run.Finished)), run.Finished.Sub(run.Started).Round(time.Second), outcome)
+	fmt.Printf("  Synced:   %d adopted, %d settled\n", run.Adopted, run.Settled)
+	fmt.Printf("  Pruned:   %d jobs, %s of job files\n", run.Pruned, formatSize(run.Freed))
+	fmt.Printf("  Archived: %d job logs\n", run.Archived)
+	fmt.Printf("  Rotated:  %d log files\n", run.Rotated)
+	if run.DBBefore > 0 {
+		fmt.Printf("  Database: %s -> %s\n", formatSize(run.DBBefore), formatSize(run.DBAfter))
+	}
+	for _, e := range run.Errors {
+		fmt.Printf("  Error:    %s\n", e)
+	}
+	return nil
+}
+
+func readMaintenanceRun() (*maintenanceRun, error) {
+	path, err := maintenanceRunPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var run maintenanceRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return &run, nil
+}
+
+// runMaintenanceRun performs every maintenance step, carrying on past
+// failures, and records the outcome for 'jr maintenance status'.
+func runMaintenanceRun(cmd *cobra.Command, args []string) error {
+	run := &maintenanceRun{Started: time.Now().UTC()}
+	fail := func(step string, err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", step, err)
+		run.Errors = append(run.Errors, step+": "+err.Error())
+	}
+
+	if report, err := reconcile(false, false); err != nil {
+		fail("sync", err)
+	} else {
+		run.Adopted, run.Settled = len(report.Adopted), len(report.Settled)
+	}
+
+	if policy, err := configPrunePolicy(); err != nil {
+		fail("prune", err)
+	} else if summary, err := executePrune(policy, &jobSelector{}, false, nil); err != nil {
+		fail("prune", err)
+	} else {
+		run.Pruned, run.Freed = summary.Removed, summary.Freed
+		if summary.Failed > 0 {
+			fail("prune", fmt.Errorf("failed to remove %d jobs", summary.Failed))
+		}
+	}
+
+	if cfg.Maint.ArchiveLogs {
+		n, err := archiveJobLogs()
+		run.Archived = n
+		if err != nil {
+			fail("archive", err)
+		}
+	}
+
+	n, err := rotateJobLogs()
+	run.Rotated = n
+	if err != nil {
+		fail("rotate", err)
+	}
+
+	if path, err := db.Path(); err == nil {
+		run.DBBefore = fileSize(path)
+		if err := db.Vacuum(); err != nil {
+			fail("vacuum", err)
+		}
+		run.DBAfter = fileSize(path)
+	}
+
+	run.Finished = time.Now().UTC()
+	fmt.Printf("Maintenance: %d adopted, %d settled, %d pruned, %d logs archived, %d rotated, database %s -> %s\n",
+		run.Adopted, run.Settled, run.Pruned, run.Archived, run.Rotated, formatSize(run.DBBefore), formatSize(run.DBAfter))
+
+	path, err := maintenanceRunPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to record the run: %w", err)
+	}
+
+	if len(run.Errors) > 0 {
+		return fmt.Errorf("maintenance failed: %s", strings.Join(run.Errors, "; "))
+	}
+	return nil
+}
+
+// archiveJobLogs saves the journal output of finished jobs that have no
+// archive yet, returning how many it saved.
+func archiveJobLogs() (int, error) {
+	jobs, err := db.ListJobs(0, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	infos := showJobUnits(jobs)
+	var archived, failed int
+	for _, job := range jobs {
+		state := jobState(job, infos)
+		if isActiveState(state) || state == "unknown" || state == "deactivating" {
+			continue
+		}
+		if jobWritesLogFile(job) {
+			continue
+		}
+		if _, ok := journalArchive(job); ok || !systemd.HasJournal(job.Unit) {
+			continue
+		}
+
+		if err := archiveJobLog(job); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+			continue
+		}
+		archived++
+	}
+
+	if failed > 0 {
+		return archived, fmt.Errorf("failed to archive %d job logs", failed)
+	}
+	return archived, nil
+}
+
+// archiveJobLog writes job's journal output to its archive, gzipped.
+func archiveJobLog(job *db.Job) error {
+	dir, err := db.JobDir(job.Unit)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	// Write under a temporary name so an interrupted run leaves no
+	// truncated archive behind
+	path := filepath.Join(dir, journalArchiveName)
+	f, err := os.CreateTemp(dir, journalArchiveName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if err := systemd.ExportJournal(job.Unit, zw); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// journalArchive returns the path of job's archived journal output, if any.
+func journalArchive(job *db.Job) (string, bool) {
+	dir, err := db.JobDir(job.Unit)
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(dir, journalArchiveName)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceUnits(t *testing.T) {
+	service := maintenanceServiceUnit("/usr/local/bin/jr", map[string]string{
+		"XDG_DATA_HOME":   "/data",
+		"XDG_CONFIG_HOME": "/conf",
+	})
+	for _, want := range []string{
+		"Type=oneshot\n",
+		`Environment="XDG_CONFIG_HOME=/conf"` + "\n" + `Environment="XDG_DATA_HOME=/data"` + "\n",
+		`ExecStart="/usr/local/bin/jr" "maintenance" "run"` + "\n",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("Service unit missing %q:\n%s", want, service)
+		}
+	}
+
+	timer := maintenanceTimerUnit("*-*-* 04:00")
+	for _, want := range []string{"OnCalendar=*-*-* 04:00\n", "Persistent=true\n", "WantedBy=timers.target\n"} {
+		if !strings.Contains(timer, want) {
+			t.Errorf("Timer unit missing %q:\n%s", want, timer)
+		}
+	}
+}
+
+func TestPrintLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalArchiveName)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	io.WriteString(zw, "2024-01-06T14:03:11+0000 host jr-train[42]: epoch 1: loss 0.5\n"+
+		"2024-01-06T14:03:12+0000 host jr-train[42]: epoch 2: loss 0.4\n")
+	zw.Close()
+	f.Close()
+
+	var out strings.Builder
+	if err := printLogFile(&out, path, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "epoch 2: loss 0.4\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	pauseSelector  jobSelector
+	resumeSelector jobSelector
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause <job|range>... [flags]",
+	Short: "Suspend running jobs without losing their progress",
+	Long: `Suspend running jobs with the cgroup freezer, falling back to SIGSTOP on
+systems without it. Paused jobs keep their memory (including GPU memory)
+but use no CPU until 'jr resume'.
+
+systemd keeps counting RuntimeMaxSec= while a job is paused.`,
+	RunE: runPause,
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume <job|range>... [flags]",
+	Short: "Resume paused jobs",
+	RunE:  runResume,
+}
+
+func init() {
+	addSelectorFlags(pauseCmd, &pauseSelector)
+	addBulkFlags(pauseCmd, &pauseSelector)
+	registerSelectorCompletions(pauseCmd, func(state string) bool { return state == "active" || state == "stalled" })
+
+	addSelectorFlags(resumeCmd, &resumeSelector)
+	addBulkFlags(resumeCmd, &resumeSelector)
+	registerSelectorCompletions(resumeCmd, func(state string) bool { return state == "paused" })
+}
+
+func runPause(cmd *cobra.Command, args []string) error {
+	jobs, infos, err := pauseSelector.selectJobs(args)
+	if err != nil {
+		return err
+	}
+
+	ok, err := pauseSelector.confirmBulk("pause", jobs)
+	if err != nil || !ok {
+		return err
+	}
+
+	var failed int
+	for _, job := range jobs {
+		switch state := jobState(job, infos); state {
+		case "active", "stalled":
+		case "paused":
+			fmt.Printf("%d %s is already paused\n", job.ID, job.Unit)
+			continue
+		default:
+			fmt.Fprintf(os.Stderr, "Error: %d %s is %s, not running\n", job.ID, job.Unit, state)
+			failed++
+			continue
+		}
+
+		method, err := pauseJob(job)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Paused %d %s (%s)\n", job.ID, job.Unit, method)
+
+		var props map[string]string
+		json.Unmarshal([]byte(job.PropertiesJSON), &props)
+		if props["RuntimeMaxSec"] != "" {
+			fmt.Fprintf(os.Stderr, "Warning: RuntimeMaxSec=%s keeps counting while %d is paused\n", props["RuntimeMaxSec"], job.ID)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to pause %d of %d jobs", failed, len(jobs))
+	}
+	return nil
+}
+
+// pauseJob suspends job and records it as paused, returning the method
+// used: "freezer" or "signal".
+func pauseJob(job *db.Job) (string, error) {
+	method := "freezer"
+	if err := systemd.FreezeUnit(job.Unit); err != nil {
+		method = "signal"
+		if err := systemd.KillUnit(job.Unit, "SIGSTOP"); err != nil {
+			return "", fmt.Errorf("failed to freeze or send SIGSTOP: %w", err)
+		}
+	}
+
+	if err := db.SetJobPaused(job.ID, method); err != nil {
+		return method, fmt.Errorf("paused but failed to record: %w", err)
+	}
+	return method, nil
+}
+
+func runResume(cmd *cobra.Command, args []string) error {
+	jobs, infos, err := resumeSelector.selectJobs(args)
+	if err != nil {
+		return err
+	}
+
+	ok, err := resumeSelector.confirmBulk("resume", jobs)
+	if err != nil || !ok {
+		return err
+	}
+
+	var failed int
+	for _, job := range jobs {
+		if state := jobState(job, infos); state != "paused" {
+			fmt.Printf("%d %s is not paused (%s)\n", job.ID, job.Unit, state)
+			continue
+		}
+
+		if err := resumeJob(job); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Resumed %d %s\n", job.ID, job.Unit)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to resume %d of %d jobs", failed, len(jobs))
+	}
+	return nil
+}
+
+// resumeJob undoes pauseJob. Jobs frozen outside jr have no recorded
+// method and are thawed.
+func resumeJob(job *db.Job) error {
+	if job.PauseMethod.String == "signal" {
+		if err := systemd.KillUnit(job.Unit, "SIGCONT"); err != nil {
+			return fmt.Errorf("failed to send SIGCONT: %w", err)
+		}
+	} else if err := systemd.ThawUnit(job.Unit); err != nil {
+		return fmt.Errorf("failed to thaw: %w", err)
+	}
+
+	if err := db.SetJobResumed(job.ID); err != nil {
+		return fmt.Errorf("resumed but failed to record: %w", err)
+	}
+	return nil
+}
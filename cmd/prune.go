@@ -2,6 +2,11 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -9,39 +14,368 @@ import (
 )
 
 var (
-	pruneKeep       int
-	pruneOlderThan  string
-	pruneFailedOnly bool
+	pruneKeep        int
+	pruneKeepPerName int
+	pruneOlderThan   string
+	pruneMaxAge      []string
+	pruneMaxLogSize  string
+	pruneFailedOnly  bool
+	pruneDryRun      bool
+	pruneSelector    jobSelector
 )
 
 var pruneCmd = &cobra.Command{
 	Use:   "prune [flags]",
 	Short: "Remove old jobs from the registry",
-	RunE:  runPrune,
+	Long: `Remove old finished jobs, with their leftover units and per-job files.
+Running and paused jobs are never removed. States are reconciled with
+systemd (as by 'jr sync') before anything is decided.
+
+A job is protected if it is among the --keep most recent jobs, or among
+the --keep-per-name most recent jobs of its name. Of the others, matching
+--name, --state, --group and --tag:
+
+  - with no age or size rule, all are removed;
+  - --older-than removes those created longer ago than the given age;
+  - --max-age state=age does the same for jobs in one state;
+  - --max-log-size then removes the oldest until per-job files fit.
+
+Rules default from the [prune] table of the config file.`,
+	Args: cobra.NoArgs,
+	RunE: runPrune,
 }
 
 func init() {
 	pruneCmd.Flags().IntVar(&pruneKeep, "keep", 100, "keep last N jobs")
+	pruneCmd.Flags().IntVar(&pruneKeepPerName, "keep-per-name", 0, "keep the last N jobs of every name")
 	pruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "remove jobs older than duration (e.g., 7d, 24h)")
+	pruneCmd.Flags().StringArrayVar(&pruneMaxAge, "max-age", nil, "remove jobs in a state older than a duration (repeatable, e.g., failed=7d)")
+	pruneCmd.Flags().StringVar(&pruneMaxLogSize, "max-log-size", "", "remove the oldest jobs until per-job files total at most this size (e.g., 10G)")
 	pruneCmd.Flags().BoolVar(&pruneFailedOnly, "failed-only", false, "only remove failed jobs")
+	pruneCmd.Flags().MarkDeprecated("failed-only", "use --state failed")
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "list the jobs that would be removed")
+	addSelectorFlags(pruneCmd, &pruneSelector)
+	registerSelectorCompletions(pruneCmd, anyState)
+}
+
+// prunePolicy holds the rules of a prune; see pruneCmd.
+type prunePolicy struct {
+	Keep        int
+	KeepPerName int
+	OlderThan   time.Duration
+	MaxAge      map[string]time.Duration
+	MaxLogSize  int64
+}
+
+// pruneCandidate is a job a prune removes, and why.
+type pruneCandidate struct {
+	Job    *db.Job
+	State  string
+	Size   int64
+	Reason string
+}
+
+// pruneSummary counts what a prune did.
+type pruneSummary struct {
+	Total   int
+	Removed int
+	Failed  int
+	Counts  map[string]int
+	Freed   int64
 }
 
 func runPrune(cmd *cobra.Command, args []string) error {
-	var duration time.Duration
+	policy, err := prunePolicyFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if pruneFailedOnly {
+		pruneSelector.State = "failed"
+	}
+
+	// A dry run only looks at the states a sync would record
+	var settled map[int64]string
+	report, err := reconcile(false, pruneDryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not reconcile with systemd, using recorded states: %v\n", err)
+	} else if pruneDryRun {
+		settled = report.states()
+	}
+
+	summary, err := executePrune(policy, &pruneSelector, pruneDryRun, settled)
+	if err != nil {
+		return err
+	}
+
+	verb := "Removed"
+	if pruneDryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d of %d jobs", verb, summary.Removed, summary.Total)
+	if counts := formatStateCounts(summary.Counts); counts != "" {
+		fmt.Printf(" (%s)", counts)
+	}
+	if summary.Freed > 0 {
+		fmt.Printf(", %s of job files", formatSize(summary.Freed))
+	}
+	fmt.Println()
+
+	if summary.Failed > 0 {
+		return fmt.Errorf("failed to remove %d jobs", summary.Failed)
+	}
+	return nil
+}
+
+// executePrune removes the jobs matching sel that policy picks, printing
+// each one. With dryRun nothing is removed. settled holds states of jobs
+// that a reconcile found but did not record, by job id.
+func executePrune(policy prunePolicy, sel *jobSelector, dryRun bool, settled map[int64]string) (*pruneSummary, error) {
+	jobs, err := db.ListJobs(0, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	infos := showJobUnits(jobs)
+	states := make(map[int64]string, len(jobs))
+	sizes := make(map[int64]int64, len(jobs))
+	for _, job := range jobs {
+		// Rules such as max_age.failed go by the verdict
+		state, ok := settled[job.ID]
+		if !ok {
+			state = jobState(job, infos)
+		}
+		states[job.ID] = verdictState(job, state)
+		sizes[job.ID] = jobDirSize(job)
+	}
+
+	summary := &pruneSummary{Total: len(jobs), Counts: make(map[string]int)}
+	for _, c := range planPrune(jobs, states, sizes, sel, policy, time.Now()) {
+		if dryRun {
+			fmt.Printf("Would remove %d %s (%s, %s)\n", c.Job.ID, c.Job.Name, c.State, c.Reason)
+		} else {
+			if err := removeJob(c.Job); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", c.Job.ID, c.Job.Unit, err)
+				summary.Failed++
+				continue
+			}
+			fmt.Printf("Removed %d %s (%s, %s)\n", c.Job.ID, c.Job.Name, c.State, c.Reason)
+		}
+		summary.Removed++
+		summary.Counts[c.State]++
+		summary.Freed += c.Size
+	}
+
+	return summary, nil
+}
+
+// configPrunePolicy returns the prune rules of the config file alone.
+func configPrunePolicy() (prunePolicy, error) {
+	policy := prunePolicy{
+		Keep:        cfg.Defaults.PruneKeep,
+		KeepPerName: cfg.Prune.KeepPerName,
+		MaxAge:      make(map[string]time.Duration),
+	}
+
+	for state, age := range cfg.Prune.MaxAge {
+		d, err := parseDuration(age)
+		if err != nil {
+			return policy, fmt.Errorf("invalid max age for %s: %w", state, err)
+		}
+		policy.MaxAge[state] = d
+	}
+
+	if cfg.Prune.MaxLogSize != "" {
+		n, err := parseSize(cfg.Prune.MaxLogSize)
+		if err != nil {
+			return policy, err
+		}
+		policy.MaxLogSize = n
+	}
+
+	return policy, nil
+}
+
+// prunePolicyFromFlags combines the [prune] config table with the flags,
+// flags winning.
+func prunePolicyFromFlags(cmd *cobra.Command) (prunePolicy, error) {
+	policy, err := configPrunePolicy()
+	if err != nil {
+		return policy, err
+	}
+	if cmd.Flags().Changed("keep") {
+		policy.Keep = pruneKeep
+	}
+	if cmd.Flags().Changed("keep-per-name") {
+		policy.KeepPerName = pruneKeepPerName
+	}
+
 	if pruneOlderThan != "" {
-		var err error
-		duration, err = parseDuration(pruneOlderThan)
+		d, err := parseDuration(pruneOlderThan)
 		if err != nil {
-			return fmt.Errorf("invalid duration: %w", err)
+			return policy, fmt.Errorf("invalid duration: %w", err)
 		}
+		policy.OlderThan = d
 	}
 
-	if err := db.PruneJobs(pruneKeep, duration, pruneFailedOnly); err != nil {
-		return fmt.Errorf("failed to prune jobs: %w", err)
+	for _, item := range pruneMaxAge {
+		state, age, ok := strings.Cut(item, "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid --max-age %q (expected state=duration)", item)
+		}
+		d, err := parseDuration(age)
+		if err != nil {
+			return policy, fmt.Errorf("invalid max age for %s: %w", state, err)
+		}
+		policy.MaxAge[state] = d
 	}
 
-	fmt.Printf("Pruned old jobs (keeping last %d)\n", pruneKeep)
-	return nil
+	if pruneMaxLogSize != "" {
+		n, err := parseSize(pruneMaxLogSize)
+		if err != nil {
+			return policy, err
+		}
+		policy.MaxLogSize = n
+	}
+
+	return policy, nil
+}
+
+// planPrune decides which of jobs (newest first) to remove under policy.
+// Candidates are returned oldest first.
+func planPrune(jobs []*db.Job, states map[int64]string, sizes map[int64]int64, sel *jobSelector, policy prunePolicy, now time.Time) []pruneCandidate {
+	var eligible []pruneCandidate
+	var total int64
+	perName := make(map[string]int)
+
+	for i, job := range jobs {
+		total += sizes[job.ID]
+		perName[job.Name]++
+
+		if i < policy.Keep || perName[job.Name] <= policy.KeepPerName {
+			continue
+		}
+		state := states[job.ID]
+		if isActiveState(state) || !sel.matches(job) || (sel.State != "" && state != sel.State) {
+			continue
+		}
+		eligible = append(eligible, pruneCandidate{Job: job, State: state, Size: sizes[job.ID]})
+	}
+
+	// Oldest first from here on
+	for i, j := 0, len(eligible)-1; i < j; i, j = i+1, j-1 {
+		eligible[i], eligible[j] = eligible[j], eligible[i]
+	}
+
+	ageRules := policy.OlderThan > 0 || len(policy.MaxAge) > 0
+	var candidates []pruneCandidate
+	var rest []pruneCandidate
+
+	for _, c := range eligible {
+		created, _ := time.Parse(time.RFC3339, c.Job.CreatedAtUTC)
+		age := now.Sub(created)
+
+		switch {
+		case !ageRules && policy.MaxLogSize == 0:
+			c.Reason = fmt.Sprintf("not among the last %d", policy.Keep)
+		case policy.OlderThan > 0 && age > policy.OlderThan:
+			c.Reason = "older than " + formatAge(policy.OlderThan)
+		case policy.MaxAge[c.State] > 0 && age > policy.MaxAge[c.State]:
+			c.Reason = fmt.Sprintf("%s for over %s", c.State, formatAge(policy.MaxAge[c.State]))
+		default:
+			rest = append(rest, c)
+			continue
+		}
+		candidates = append(candidates, c)
+		total -= c.Size
+	}
+
+	if policy.MaxLogSize > 0 {
+		for _, c := range rest {
+			if total <= policy.MaxLogSize {
+				break
+			}
+			c.Reason = "job files over " + formatSize(policy.MaxLogSize)
+			candidates = append(candidates, c)
+			total -= c.Size
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Job.CreatedAtUTC < candidates[j].Job.CreatedAtUTC
+		})
+	}
+
+	return candidates
+}
+
+// jobDirSize returns the total size of the files in job's directory and of
+// its log files kept elsewhere.
+func jobDirSize(job *db.Job) int64 {
+	dir, err := db.JobDir(job.Unit)
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	for _, path := range jobLogFiles(job) {
+		if filepath.Dir(path) != dir {
+			size += fileSize(path)
+		}
+	}
+	return size
+}
+
+func formatStateCounts(counts map[string]int) string {
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	parts := make([]string, len(states))
+	for i, state := range states {
+		parts[i] = fmt.Sprintf("%d %s", counts[state], state)
+	}
+	return strings.Join(parts, ", ")
+}
+
+var sizeUnits = []string{"B", "K", "M", "G", "T"}
+
+// parseSize parses a byte size such as "512M" or "10G" (powers of 1024).
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	for i, unit := range sizeUnits[1:] {
+		if strings.HasSuffix(s, unit) {
+			s = strings.TrimSuffix(s, unit)
+			mult = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q (expected e.g. 500M or 10G)", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// formatSize renders n bytes with a binary unit, e.g. "1.5G".
+func formatSize(n int64) string {
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(sizeUnits)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64) + sizeUnits[i]
 }
 
 func parseDuration(s string) (time.Duration, error) {
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/user/jr/db"
 )
 
 func TestParseDuration(t *testing.T) {
@@ -32,3 +35,86 @@ func TestParseDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanPrune(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var jobs []*db.Job
+	states := make(map[int64]string)
+	sizes := make(map[int64]int64)
+
+	// Newest first, one job per day: 6 is today, 1 is five days old
+	add := func(id int64, name, state string, size int64) {
+		created := now.Add(-time.Duration(6-id) * 24 * time.Hour)
+		jobs = append(jobs, &db.Job{ID: id, Name: name, CreatedAtUTC: created.Format(time.RFC3339)})
+		states[id] = state
+		sizes[id] = size
+	}
+	add(6, "train", "active", 10)
+	add(5, "train", "exited", 10)
+	add(4, "eval", "failed", 10)
+	add(3, "train", "failed", 10)
+	add(2, "eval", "exited", 10)
+	add(1, "train", "exited", 10)
+
+	ids := func(candidates []pruneCandidate) []int64 {
+		var result []int64
+		for _, c := range candidates {
+			result = append(result, c.Job.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		sel    jobSelector
+		policy prunePolicy
+		want   []int64
+	}{
+		{"keep only", jobSelector{}, prunePolicy{Keep: 3}, []int64{1, 2, 3}},
+		{"running jobs are never removed", jobSelector{}, prunePolicy{Keep: 0}, []int64{1, 2, 3, 4, 5}},
+		{"keep per name", jobSelector{}, prunePolicy{KeepPerName: 2}, []int64{1, 3}},
+		{"state selector", jobSelector{State: "failed"}, prunePolicy{}, []int64{3, 4}},
+		{"name selector", jobSelector{Name: "eval"}, prunePolicy{}, []int64{2, 4}},
+		{"older than", jobSelector{}, prunePolicy{OlderThan: 60 * time.Hour}, []int64{1, 2, 3}},
+		{"max age per state", jobSelector{}, prunePolicy{MaxAge: map[string]time.Duration{"failed": 36 * time.Hour}}, []int64{3, 4}},
+		{"max log size", jobSelector{}, prunePolicy{MaxLogSize: 35}, []int64{1, 2, 3}},
+		{"age and size combined", jobSelector{}, prunePolicy{OlderThan: 108 * time.Hour, MaxLogSize: 45}, []int64{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(planPrune(jobs, states, sizes, &tt.sel, tt.policy, now))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planPrune() removes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"512", 512},
+		{"2K", 2048},
+		{"1.5M", 3 << 19},
+		{"10G", 10 << 30},
+		{"10gb", 10 << 30},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSize(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("Expected an invalid size to fail")
+	}
+
+	if got := formatSize(3 << 29); got != "1.5G" {
+		t.Errorf("formatSize() = %q, want 1.5G", got)
+	}
+}
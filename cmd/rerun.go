@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/config"
+	"github.com/user/jr/db"
+)
+
+var (
+	rerunName     string
+	rerunCheckout bool
+)
+
+var rerunCmd = &cobra.Command{
+	Use:   "rerun <job> [flags]",
+	Short: "Run a job again",
+	Long: `Run a job again as a new job, with the command, working directory,
+environment and properties it was started with. Its group, tags,
+parameters, checkpoint policy, success and artifact rules and log file
+mode carry over, and a new snapshot is taken if the job had one.
+
+Secret variables are not stored, so their values come from the current
+environment. Notify commands, and the log limits and stall timeouts jr
+enforces itself, are not carried over.
+
+--checkout compares the job's snapshot (see 'jr run --snapshot') with the
+working directory before starting, and warns if the git checkout or the
+executable has moved on since, say to a new commit.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeJobs(anyState),
+	RunE:              runRerun,
+}
+
+func init() {
+	rerunCmd.Flags().StringVarP(&rerunName, "name", "n", "", "logical name (default: the job's)")
+	rerunCmd.Flags().BoolVar(&rerunCheckout, "checkout", false, "warn if the working directory has moved on from the job's snapshot")
+}
+
+func runRerun(cmd *cobra.Command, args []string) error {
+	job, err := db.ResolveJob(args[0])
+	var ambiguous *db.AmbiguousError
+	if errors.As(err, &ambiguous) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find job: %w", err)
+	}
+	if job == nil {
+		return fmt.Errorf("job not found: %s", args[0])
+	}
+
+	spec, err := rerunSpec(job, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if rerunName != "" {
+		spec.Name = rerunName
+	}
+
+	if rerunCheckout {
+		if snapshot := jobSnapshot(job); snapshot == nil {
+			fmt.Fprintf(os.Stderr, "Warning: job %d has no snapshot to compare with (see jr run --snapshot)\n", job.ID)
+		} else {
+			for _, drift := range snapshotDrift(snapshot, spec.Cwd, spec.Argv[0]) {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", drift)
+			}
+		}
+	}
+
+	if cfg.Defaults.LingerCheck {
+		warnIfNotLingering()
+	}
+
+	id, err := launchJob(spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Started %d %s (rerun of %d)\n", id, spec.Unit, job.ID)
+	return nil
+}
+
+// rerunSpec rebuilds the spec job was launched from, taking the values of
+// redacted secrets from lookupEnv. Properties jr generated for the old unit,
+// such as its hooks and log files, are left for launchJob to generate anew.
+func rerunSpec(job *db.Job, lookupEnv func(string) (string, bool)) (*jobSpec, error) {
+	spec := &jobSpec{
+		Name:          job.Name,
+		Cwd:           job.Cwd,
+		Group:         job.GroupName.String,
+		Tags:          jobTags(job),
+		SuccessRules:  jobSuccessRules(job),
+		ArtifactRules: jobArtifactRules(job),
+		Snapshot:      job.SnapshotJSON.Valid || cfg.Defaults.Snapshot,
+	}
+
+	if err := json.Unmarshal([]byte(job.ArgvJSON), &spec.Argv); err != nil || len(spec.Argv) == 0 {
+		return nil, fmt.Errorf("job %d has no recorded command", job.ID)
+	}
+	if job.EnvJSON != "" {
+		if err := json.Unmarshal([]byte(job.EnvJSON), &spec.Env); err != nil {
+			return nil, fmt.Errorf("job %d: invalid environment: %w", job.ID, err)
+		}
+	}
+	if spec.Env == nil {
+		spec.Env = make(map[string]string)
+	}
+	if job.PropertiesJSON != "" {
+		if err := json.Unmarshal([]byte(job.PropertiesJSON), &spec.Props); err != nil {
+			return nil, fmt.Errorf("job %d: invalid properties: %w", job.ID, err)
+		}
+	}
+	if spec.Props == nil {
+		spec.Props = make(map[string]string)
+	}
+	if job.ParamsJSON.Valid && job.ParamsJSON.String != "" {
+		if err := json.Unmarshal([]byte(job.ParamsJSON.String), &spec.Params); err != nil {
+			return nil, fmt.Errorf("job %d: invalid parameters: %w", job.ID, err)
+		}
+	}
+
+	var missing []string
+	for k, v := range spec.Env {
+		if v != config.Redacted || !cfg.Env.IsSecret(k) {
+			continue
+		}
+		if value, ok := lookupEnv(k); ok {
+			spec.Env[k] = value
+		} else {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("job %d used secrets that are not stored; set %s in the environment", job.ID, strings.Join(missing, ", "))
+	}
+
+	spec.Props = userProperties(job, spec.Props)
+	if jobWritesLogFile(job) {
+		spec.LogFile = logFileCombined
+		if job.ErrLogFile.Valid {
+			spec.LogFile = logFileSplit
+		}
+	} else if job.LogFile.Valid {
+		spec.Tee = "always"
+	}
+
+	if job.CkptSignal.Valid {
+		spec.CheckpointSignal = job.CkptSignal.String
+		spec.CheckpointPath = job.CkptPath.String
+	}
+	return spec, nil
+}
+
+// userProperties drops the properties launchJob generated for the unit of
+// job from props, its hooks and log files, leaving those the user asked for.
+func userProperties(job *db.Job, props map[string]string) map[string]string {
+	if isJrHook(props["ExecStopPost"]) {
+		delete(props, "ExecStopPost")
+	}
+	if jobWritesLogFile(job) {
+		delete(props, "StandardOutput")
+		delete(props, "StandardError")
+	}
+	return props
+}
+
+// isJrHook reports whether an ExecStopPost= value is the finish hook
+// launchJob generates.
+func isJrHook(value string) bool {
+	return strings.Contains(value, `"`+finishCommand+`"`)
+}
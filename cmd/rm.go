@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/user/jr/db"
@@ -10,46 +12,116 @@ import (
 
 var (
 	rmStop      bool
+	rmForce     bool
 	rmPurgeUnit bool
+	rmArtifacts bool
+	rmSelector  jobSelector
 )
 
 var rmCmd = &cobra.Command{
-	Use:   "rm <id|unit>",
-	Short: "Remove a job from the registry",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runRm,
+	Use:   "rm <job|range>... [flags]",
+	Short: "Remove jobs from the registry",
+	Long: `Remove jobs from the registry, together with their leftover systemd unit
+and their files under jr's state directory.
+
+Running or paused jobs are refused, since removing them would leave an
+untracked unit behind: stop them first, or pass --stop. --force also
+removes jobs whose unit could not be stopped.
+
+Files the jobs produced are kept unless --artifacts is given; see
+'jr artifacts'.`,
+	RunE: runRm,
 }
 
 func init() {
-	rmCmd.Flags().BoolVar(&rmStop, "stop", false, "stop the job before removing")
+	rmCmd.Flags().BoolVar(&rmStop, "stop", false, "stop running jobs before removing them")
+	rmCmd.Flags().BoolVar(&rmForce, "force", false, "like --stop, but remove jobs even if stopping fails")
+	rmCmd.Flags().BoolVar(&rmArtifacts, "artifacts", false, "also delete the files recorded by jr run --artifact, unless modified since")
 	rmCmd.Flags().BoolVar(&rmPurgeUnit, "purge-unit", false, "reset-failed after stopping")
+	rmCmd.Flags().MarkDeprecated("purge-unit", "leftover units are now always cleaned up")
+	addSelectorFlags(rmCmd, &rmSelector)
+	addBulkFlags(rmCmd, &rmSelector)
+	registerSelectorCompletions(rmCmd, anyState)
 }
 
 func runRm(cmd *cobra.Command, args []string) error {
-	job, err := db.FindJobByPartial(args[0])
+	jobs, infos, err := rmSelector.selectJobs(args)
 	if err != nil {
-		return fmt.Errorf("failed to find job: %w", err)
+		return err
+	}
+
+	var running []string
+	for _, job := range jobs {
+		if isActiveState(jobState(job, infos)) {
+			running = append(running, fmt.Sprintf("%d", job.ID))
+		}
 	}
-	if job == nil {
-		return fmt.Errorf("job not found: %s", args[0])
+	if len(running) > 0 && !rmStop && !rmForce {
+		return fmt.Errorf("refusing to remove running jobs %s (stop them first, or pass --stop)", strings.Join(running, ", "))
 	}
 
-	if rmStop {
-		if err := systemd.StopUnit(job.Unit); err != nil {
-			fmt.Printf("Warning: failed to stop unit: %v\n", err)
+	ok, err := rmSelector.confirmBulk("remove", jobs)
+	if err != nil || !ok {
+		return err
+	}
+
+	var failed int
+	for _, job := range jobs {
+		if isActiveState(jobState(job, infos)) {
+			if err := systemd.StopUnit(job.Unit); err != nil {
+				if !rmForce {
+					fmt.Fprintf(os.Stderr, "Error: %d %s: failed to stop unit: %v; not removing\n", job.ID, job.Unit, err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "Warning: %d %s: failed to stop unit: %v\n", job.ID, job.Unit, err)
+			}
 		}
 
-		if rmPurgeUnit {
-			if err := systemd.ResetFailedUnit(job.Unit); err != nil {
-				fmt.Printf("Warning: failed to reset-failed: %v\n", err)
+		if rmArtifacts {
+			if err := removeArtifacts(job); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %d %s: %v; not removing\n", job.ID, job.Unit, err)
+				failed++
+				continue
 			}
 		}
+
+		if err := removeJob(job); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Removed %d %s (%s)\n", job.ID, job.Name, job.Unit)
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d of %d jobs", failed, len(jobs))
+	}
+	return nil
+}
+
+// removeJob deletes a finished job's record, unloads its unit if systemd
+// still holds it (for example as failed) and deletes its per-job files.
+func removeJob(job *db.Job) error {
 	if err := db.DeleteJob(job.ID); err != nil {
 		return fmt.Errorf("failed to delete job: %w", err)
 	}
 
-	fmt.Printf("Removed %d %s\n", job.ID, job.Unit)
+	// Fails harmlessly when the unit was already garbage-collected
+	systemd.ResetFailedUnit(job.Unit)
+
+	for _, path := range jobLogFiles(job) {
+		if err := os.Remove(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", path, err)
+		}
+	}
+
+	// Drop per-job files such as the secrets EnvironmentFile
+	if jobDir, err := db.JobDir(job.Unit); err == nil {
+		if err := os.RemoveAll(jobDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", jobDir, err)
+		}
+	}
+
 	return nil
 }
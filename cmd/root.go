@@ -24,7 +24,24 @@ and can be monitored from any session.`,
 	},
 }
 
+// jobHooks are the hidden commands jr runs inside jobs, which bypass the
+// config and the command line parser.
+var jobHooks = map[string]func(args []string) error{
+	teeCommand:    teeWrapper,
+	finishCommand: finishHook,
+}
+
 func Execute() error {
+	if len(os.Args) > 1 {
+		if hook, ok := jobHooks[os.Args[1]]; ok {
+			if err := hook(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "jr %s: %v\n", os.Args[1], err)
+				return err
+			}
+			return nil
+		}
+	}
+
 	defer db.Close()
 	return rootCmd.Execute()
 }
@@ -39,13 +56,35 @@ func init() {
 	rootCmd.AddCommand(pruneCmd)
 	rootCmd.AddCommand(doctorCmd)
 	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(sweepCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(adoptCmd)
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(checkpointCmd)
+	rootCmd.AddCommand(maintenanceCmd)
+	rootCmd.AddCommand(artifactsCmd)
+	rootCmd.AddCommand(rerunCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(statsCmd)
 
-	cobra.OnInitialize(initDB)
+	cobra.OnInitialize(initConfig, initDB)
+	rootCmd.PersistentPreRun = requireDB
 }
 
+// dbErr is why the database could not be opened. Doctor reports it; every
+// other command refuses to run.
+var dbErr error
+
 func initDB() {
-	if err := db.InitDB(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
+	dbErr = db.InitDB()
+}
+
+func requireDB(cmd *cobra.Command, args []string) {
+	if dbErr != nil && cmd != doctorCmd {
+		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", dbErr)
 		os.Exit(1)
 	}
 }
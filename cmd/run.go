@@ -5,10 +5,14 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/user/jr/config"
 	"github.com/user/jr/db"
 	"github.com/user/jr/systemd"
 )
@@ -54,6 +58,25 @@ var (
 	runNoLingerCheck bool
 	runProperties    []string
 	runAttach        bool
+	runProfile       string
+	runGroup         string
+	runNoInheritEnv  bool
+	runCkptSignal    string
+	runCkptPath      string
+	runTags          []string
+	runTee           bool
+	runLogFile       string
+	runMaxLogRate    string
+	runMaxLogBytes   string
+	runLogLimitAct   string
+	runStallTimeout  string
+	runStallAction   string
+	runSuccessExit   []int
+	runSuccessOutput string
+	runSuccessFiles  []string
+	runArtifactGlobs []string
+	runArtifactSum   bool
+	runSnapshot      bool
 )
 
 var runCmd = &cobra.Command{
@@ -87,59 +110,446 @@ func init() {
 	runCmd.Flags().BoolVar(&runNoLingerCheck, "no-linger-check", false, "skip linger hint if not enabled")
 	runCmd.Flags().StringArrayVar(&runProperties, "property", nil, "pass -p k=v to systemd-run (repeatable)")
 	runCmd.Flags().BoolVarP(&runAttach, "attach", "a", false, "attach to job output (ctrl+c detaches, job keeps running)")
+	runCmd.Flags().StringVarP(&runProfile, "profile", "P", "", "apply a named profile from the config file")
+	runCmd.Flags().BoolVar(&runNoInheritEnv, "no-inherit-env", false, "do not capture the current environment (only --env, profile and systemd defaults)")
+	runCmd.Flags().StringVar(&runGroup, "group", os.Getenv("JR_GROUP"), "add the job to a group (default: $JR_GROUP)")
+	runCmd.Flags().StringArrayVar(&runTags, "tag", nil, "label the job (repeatable); see --tag on list, stop, rm and prune")
+	runCmd.Flags().StringVar(&runCkptSignal, "checkpoint-signal", "", "signal that makes the job save a checkpoint (default with --checkpoint-path: SIGUSR1)")
+	runCmd.Flags().StringVar(&runCkptPath, "checkpoint-path", "", "file or directory the job writes checkpoints to (relative to --cwd)")
+	runCmd.Flags().StringVar(&runLogFile, "log-file", "", "write output to files instead of the journal: combined (the default) or split stdout/stderr; see [logs] in the config")
+	runCmd.Flags().Lookup("log-file").NoOptDefVal = logFileCombined
+	runCmd.Flags().StringVar(&runMaxLogRate, "max-log-rate", "", "drop output beyond LINES[/INTERVAL], e.g. 1000/30s (default interval 1s)")
+	runCmd.Flags().StringVar(&runMaxLogBytes, "max-log-bytes", "", "drop output beyond a total size, e.g. 1G")
+	runCmd.Flags().StringVar(&runLogLimitAct, "log-limit-action", "", "when a log limit is exceeded: warn or stop the job (default from log_limit_action)")
+	runCmd.Flags().StringVar(&runStallTimeout, "stall-timeout", "", "act when the job writes no output and uses almost no CPU for this long, e.g. 30m")
+	runCmd.Flags().StringVar(&runStallAction, "stall-action", stallNotify, "when the job stalls: notify (mark it stalled and run the notify command) or stop")
+	runCmd.Flags().IntSliceVar(&runSuccessExit, "success-exit", nil, "exit statuses that count as success (default 0), e.g. 0,2")
+	runCmd.Flags().StringVar(&runSuccessOutput, "success-output", "", "count as success only if a line of output matches this regular expression")
+	runCmd.Flags().StringArrayVar(&runSuccessFiles, "success-file", nil, "count as success only if a file matches this glob, relative to --cwd (repeatable)")
+	runCmd.Flags().StringArrayVar(&runArtifactGlobs, "artifact", nil, "record the files matching this glob, relative to --cwd, when the job finishes (repeatable); see jr artifacts")
+	runCmd.Flags().BoolVar(&runArtifactSum, "artifact-sha256", false, "also record a SHA-256 checksum of each artifact")
+	runCmd.Flags().BoolVar(&runSnapshot, "snapshot", false, "record the git commit, branch and uncommitted changes of --cwd and the command's executable (default from snapshot)")
+	runCmd.Flags().BoolVar(&runTee, "tee", false, "also copy output to a file in the job directory, safe from journal rotation and rate limits (default from tee_logs)")
+
+	runCmd.RegisterFlagCompletionFunc("property", completeProperties)
+	runCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	runCmd.RegisterFlagCompletionFunc("group", completeGroups)
+	runCmd.RegisterFlagCompletionFunc("tag", completeTags)
+	runCmd.RegisterFlagCompletionFunc("checkpoint-signal", fixedCompletions(signalNames))
+	runCmd.RegisterFlagCompletionFunc("log-file", fixedCompletions(logFileModes))
+	runCmd.RegisterFlagCompletionFunc("log-limit-action", fixedCompletions(logLimitActions))
+	runCmd.RegisterFlagCompletionFunc("stall-action", fixedCompletions(stallActions))
 }
 
-func runRun(cmd *cobra.Command, args []string) error {
-	command := args[0]
-	argv := args
+// jobSpec describes a job to launch. It is assembled from run flags,
+// templates or sweeps and handed to launchJob.
+type jobSpec struct {
+	Name   string
+	Cwd    string
+	Argv   []string
+	Env    map[string]string
+	Props  map[string]string
+	Desc   string
+	Params map[string]string
+	Group  string
+	Tags   []string
+
+	NotifyCommand string
+	NotifyOn      string
+
+	// CheckpointSignal asks the job to write a checkpoint to
+	// CheckpointPath; see jr checkpoint.
+	CheckpointSignal string
+	CheckpointPath   string
 
-	if !systemd.CommandExists(command) {
-		return fmt.Errorf("command not found: %s", command)
+	// Tee is "always", "never" or "auto" to override the tee_logs config.
+	Tee string
+	// LogFile sends output to files instead of the journal: "combined" or
+	// "split"; see logFilePaths.
+	LogFile string
+	// LogLimits caps the job's output; see logLimits.
+	LogLimits logLimits
+	// StallTimeout, if set, watches the job for stalls; see stallWatch.
+	StallTimeout time.Duration
+	StallAction  string
+	// SuccessRules, if set, decide the job's verdict when it finishes.
+	SuccessRules *db.SuccessRules
+	// ArtifactRules, if set, name the files to record when it finishes.
+	ArtifactRules *db.ArtifactRules
+	// Snapshot records the code the job runs; see takeSnapshot.
+	Snapshot bool
+
+	// Unit is set by launchJob.
+	Unit string
+}
+
+// launchJob starts spec as a transient unit and records it, returning the
+// new job id.
+func launchJob(spec *jobSpec) (int64, error) {
+	if !systemd.CommandExists(spec.Argv[0]) {
+		return 0, fmt.Errorf("command not found: %s", spec.Argv[0])
 	}
 
-	name := runName
-	if name == "" {
-		name = filepath.Base(command)
+	spec.Unit = systemd.GenerateUnitName(spec.Name)
+	// The finish hook records how the job ended and runs the notify command
+	// once it knows whether the job succeeded. Jobs with an ExecStopPost= of
+	// their own are left to jr sync.
+	if _, ok := spec.Props["ExecStopPost"]; !ok {
+		exe, err := jrExecutable()
+		if err != nil {
+			return 0, err
+		}
+		dbPath, err := db.Path()
+		if err != nil {
+			return 0, err
+		}
+		spec.Props["ExecStopPost"] = finishProperty(exe, dbPath, spec.Unit, spec.NotifyCommand, spec.NotifyOn)
+	}
+	if spec.SuccessRules != nil && len(spec.SuccessRules.ExitCodes) > 0 {
+		if _, ok := spec.Props["SuccessExitStatus"]; !ok {
+			codes := make([]string, len(spec.SuccessRules.ExitCodes))
+			for i, code := range spec.SuccessRules.ExitCodes {
+				codes[i] = strconv.Itoa(code)
+			}
+			spec.Props["SuccessExitStatus"] = strings.Join(codes, " ")
+		}
 	}
 
-	cwd := runCwd
-	if cwd == "" {
+	// Before the job can change the working tree
+	var snapshot *db.Snapshot
+	if spec.Snapshot {
+		jobDir, err := db.JobDir(spec.Unit)
+		if err != nil {
+			return 0, err
+		}
+		snapshot = takeSnapshot(spec.Cwd, spec.Argv, jobDir)
+	}
+
+	desc := spec.Desc
+	if desc == "" {
+		desc = fmt.Sprintf("jr job: %s", spec.Name)
+	}
+
+	// Secret values never reach systemd-run's argv (visible in process
+	// listings) or the database: they go to a private EnvironmentFile, next
+	// to any the user gave with -p EnvironmentFile=.
+	env := make(map[string]string)
+	secrets := make(map[string]string)
+	for k, v := range spec.Env {
+		if cfg.Env.IsSecret(k) {
+			secrets[k] = v
+		} else {
+			env[k] = v
+		}
+	}
+	var secretsFile string
+	if len(secrets) > 0 {
+		jobDir, err := db.JobDir(spec.Unit)
+		if err != nil {
+			return 0, err
+		}
+		secretsFile = filepath.Join(jobDir, "secrets.env")
+		if err := systemd.WriteEnvironmentFile(secretsFile, secrets); err != nil {
+			return 0, fmt.Errorf("failed to write secrets file: %w", err)
+		}
+	}
+
+	// With --tee, log limits or a stall timeout the command runs under
+	// jr _tee, which keeps it the main process; the database records the
+	// command itself.
+	argv := spec.Argv
+	var wrapper teeOptions
+	var logFile, errLogFile string
+	if spec.LogFile != "" {
 		var err error
-		cwd, err = os.Getwd()
+		if logFile, errLogFile, err = logFilePaths(spec.Unit, spec.LogFile); err != nil {
+			return 0, err
+		}
+		if err := os.MkdirAll(filepath.Dir(logFile), 0700); err != nil {
+			return 0, fmt.Errorf("failed to create log directory: %w", err)
+		}
+		spec.Props["StandardOutput"] = "append:" + logFile
+		spec.Props["StandardError"] = "append:" + logFile
+		if errLogFile != "" {
+			spec.Props["StandardError"] = "append:" + errLogFile
+		}
+	} else if teeMode(spec.Tee, spec.Props) {
+		jobDir, err := db.JobDir(spec.Unit)
 		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
+			return 0, err
+		}
+		logFile = filepath.Join(jobDir, teeLogName)
+		wrapper.File = logFile
+	}
+
+	// journald enforces a plain rate limit by itself; anything else needs
+	// the wrapper
+	if limits := spec.LogLimits; limits.set() {
+		if limits.Lines > 0 && limits.Action == logLimitWarn && spec.LogFile == "" && journaldRateLimit() {
+			spec.Props["LogRateLimitIntervalSec"] = fmt.Sprintf("%gs", limits.Interval.Seconds())
+			spec.Props["LogRateLimitBurst"] = strconv.Itoa(limits.Lines)
+			limits.Lines = 0
+		}
+		if limits.set() {
+			dbPath, err := db.Path()
+			if err != nil {
+				return 0, err
+			}
+			wrapper.Unit, wrapper.DB, wrapper.Limits = spec.Unit, dbPath, limits
+		}
+	}
+
+	if spec.StallTimeout > 0 {
+		dbPath, err := db.Path()
+		if err != nil {
+			return 0, err
+		}
+		wrapper.Unit, wrapper.DB = spec.Unit, dbPath
+		wrapper.StallTimeout, wrapper.StallAction = spec.StallTimeout, spec.StallAction
+		wrapper.Notify, wrapper.NotifyOn = spec.NotifyCommand, spec.NotifyOn
+	}
+
+	if wrapper.needed() {
+		exe, err := jrExecutable()
+		if err != nil {
+			return 0, err
+		}
+		argv = append(append([]string{exe, teeCommand}, wrapper.args()...), "--")
+		argv = append(argv, spec.Argv...)
+	}
+
+	// Recorded before the unit starts, so that hooks running inside the job
+	// always find it
+	id, err := recordJob(spec, logFile, errLogFile, snapshot)
+	if err != nil {
+		discardJobDir(spec.Unit)
+		return 0, err
+	}
+
+	if err := systemd.StartUnit(spec.Unit, spec.Cwd, argv, env, secretsFile, spec.Props, desc); err != nil {
+		db.DeleteJob(id)
+		discardJobDir(spec.Unit)
+		return 0, fmt.Errorf("failed to start unit: %w", err)
+	}
+	return id, nil
+}
+
+// discardJobDir removes what launchJob wrote for a job that never started,
+// such as its secrets EnvironmentFile and snapshot.
+func discardJobDir(unit string) {
+	if jobDir, err := db.JobDir(unit); err == nil {
+		if err := os.RemoveAll(jobDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", jobDir, err)
+		}
+	}
+}
+
+// recordJob adds the job launchJob is about to start to the database. On
+// failure nothing is left recorded.
+func recordJob(spec *jobSpec, logFile, errLogFile string, snapshot *db.Snapshot) (int64, error) {
+	host, _ := os.Hostname()
+	user := os.Getenv("USER")
+
+	id, err := db.CreateJob(spec.Name, spec.Unit, spec.Cwd, spec.Argv, cfg.Env.Redact(spec.Env), spec.Props, host, user)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record job: %w", err)
+	}
+	if err := recordJobDetails(id, spec, logFile, errLogFile, snapshot); err != nil {
+		db.DeleteJob(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+func recordJobDetails(id int64, spec *jobSpec, logFile, errLogFile string, snapshot *db.Snapshot) error {
+	if logFile != "" {
+		if err := db.SetJobLogFiles(id, logFile, errLogFile); err != nil {
+			return fmt.Errorf("failed to record log file: %w", err)
+		}
+	}
+
+	if snapshot != nil {
+		if err := db.SetJobSnapshot(id, snapshot); err != nil {
+			return fmt.Errorf("failed to record snapshot: %w", err)
+		}
+	}
+
+	if spec.Params != nil {
+		if err := db.SetJobParams(id, spec.Params); err != nil {
+			return fmt.Errorf("failed to record parameters: %w", err)
+		}
+	}
+
+	if spec.Group != "" {
+		if err := db.SetJobGroup(id, spec.Group); err != nil {
+			return fmt.Errorf("failed to record group: %w", err)
+		}
+	}
+
+	if len(spec.Tags) > 0 {
+		if err := db.SetJobTags(id, spec.Tags); err != nil {
+			return fmt.Errorf("failed to record tags: %w", err)
+		}
+	}
+
+	signal, timeout := stopPolicy(spec.Props)
+	if err := db.SetJobStopPolicy(id, signal, timeout); err != nil {
+		return fmt.Errorf("failed to record stop policy: %w", err)
+	}
+
+	if spec.CheckpointSignal != "" || spec.CheckpointPath != "" {
+		signal := spec.CheckpointSignal
+		if signal == "" {
+			signal = defaultCheckpointSignal
+		}
+		path := spec.CheckpointPath
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(spec.Cwd, path)
+		}
+		if err := db.SetJobCheckpointPolicy(id, signal, path); err != nil {
+			return fmt.Errorf("failed to record checkpoint policy: %w", err)
+		}
+	}
+
+	if spec.ArtifactRules != nil {
+		if err := db.SetJobArtifactRules(id, spec.ArtifactRules); err != nil {
+			return fmt.Errorf("failed to record artifact patterns: %w", err)
+		}
+	}
+	if spec.SuccessRules != nil {
+		if err := db.SetJobSuccessRules(id, spec.SuccessRules); err != nil {
+			return fmt.Errorf("failed to record success rules: %w", err)
 		}
 	}
+	return nil
+}
 
+// inheritedEnv returns the variables of the current process environment
+// that the configured env policy captures into new jobs.
+func inheritedEnv() map[string]string {
 	env := make(map[string]string)
 	for _, e := range os.Environ() {
 		parts := strings.SplitN(e, "=", 2)
-		if len(parts) != 2 {
+		if len(parts) != 2 || !cfg.Env.Inherits(parts[0]) {
 			continue
 		}
 		env[parts[0]] = parts[1]
 	}
-	for _, e := range runEnv {
+	return env
+}
+
+// runLogLimits builds a job's log limits from the --max-log-rate,
+// --max-log-bytes and --log-limit-action values.
+func runLogLimits(rate, size, action string) (logLimits, error) {
+	limits := logLimits{Action: action}
+	if limits.Action == "" {
+		limits.Action = cfg.Defaults.LogLimitAction
+	}
+	if limits.Action != logLimitWarn && limits.Action != logLimitStop {
+		return limits, fmt.Errorf("invalid --log-limit-action %q (expected warn or stop)", action)
+	}
+
+	if rate != "" {
+		var err error
+		if limits.Lines, limits.Interval, err = parseLogRate(rate); err != nil {
+			return limits, err
+		}
+	}
+	if size != "" {
+		n, err := parseSize(size)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --max-log-bytes: %w", err)
+		}
+		limits.Bytes = n
+	}
+	return limits, nil
+}
+
+func warnIfNotLingering() {
+	linger, err := systemd.CheckLingering()
+	if err == nil && !linger {
+		fmt.Fprintf(os.Stderr, "Warning: lingering not enabled. Jobs may stop on logout.\n")
+		fmt.Fprintf(os.Stderr, "Enable with: sudo loginctl enable-linger $USER\n\n")
+	}
+}
+
+// runEnvAndProps layers the inherited environment (unless inherit is
+// false), the profile and the
+// --env/--gpu/--property flag values into a new job's env and properties.
+func runEnvAndProps(profile config.Profile, inherit bool, envFlags []string, gpu string, propFlags []string) (map[string]string, map[string]string, error) {
+	env := make(map[string]string)
+	if inherit {
+		env = inheritedEnv()
+	}
+	for k, v := range profile.Env {
+		env[k] = v
+	}
+	if profile.GPU != "" {
+		env["CUDA_VISIBLE_DEVICES"] = profile.GPU
+	}
+	for _, e := range envFlags {
 		parts := strings.SplitN(e, "=", 2)
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid env format: %s (expected K=V)", e)
+			return nil, nil, fmt.Errorf("invalid env format: %s (expected K=V)", e)
 		}
 		env[parts[0]] = parts[1]
 	}
 
-	if runGPU != "" {
-		env["CUDA_VISIBLE_DEVICES"] = runGPU
+	if gpu != "" {
+		env["CUDA_VISIBLE_DEVICES"] = gpu
 	}
 
-	props := make(map[string]string)
-	for _, p := range runProperties {
+	props := profile.ResourceProperties()
+	for k, v := range profile.Properties {
+		props[k] = v
+	}
+	for _, p := range propFlags {
 		parts := strings.SplitN(p, "=", 2)
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid property format: %s (expected k=v)", p)
+			return nil, nil, fmt.Errorf("invalid property format: %s (expected k=v)", p)
 		}
 		props[parts[0]] = parts[1]
 	}
 
+	return env, props, nil
+}
+
+func runRun(cmd *cobra.Command, args []string) error {
+	command := args[0]
+	argv := args
+
+	var profile config.Profile
+	if runProfile != "" {
+		var err error
+		profile, err = cfg.Profile(runProfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	name := runName
+	if name == "" {
+		name = filepath.Base(command)
+	}
+
+	cwd := runCwd
+	if cwd == "" {
+		var err error
+		cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	env, props, err := runEnvAndProps(profile, !runNoInheritEnv, runEnv, runGPU, runProperties)
+	if err != nil {
+		return err
+	}
+
+	if runLogFile != "" && (runAttach || runTee) {
+		return fmt.Errorf("--log-file cannot be combined with --attach or --tee, which read the journal")
+	}
+
 	// Set up colored output if in attach mode
 	if runAttach {
 		// Enable color output in systemd journal
@@ -157,31 +567,73 @@ func runRun(cmd *cobra.Command, args []string) error {
 		env["CLICOLOR_FORCE"] = "1"
 	}
 
-	unit := systemd.GenerateUnitName(name)
-	desc := runDesc
-	if desc == "" {
-		desc = fmt.Sprintf("jr job: %s", name)
+	limits, err := runLogLimits(runMaxLogRate, runMaxLogBytes, runLogLimitAct)
+	if err != nil {
+		return err
 	}
 
-	if !runNoLingerCheck {
-		linger, err := systemd.CheckLingering()
-		if err == nil && !linger {
-			fmt.Fprintf(os.Stderr, "Warning: lingering not enabled. Jobs may stop on logout.\n")
-			fmt.Fprintf(os.Stderr, "Enable with: sudo loginctl enable-linger $USER\n\n")
-		}
+	if cfg.Defaults.LingerCheck && !runNoLingerCheck {
+		warnIfNotLingering()
 	}
 
-	if err := systemd.StartUnit(unit, cwd, argv, env, props, desc); err != nil {
-		return fmt.Errorf("failed to start unit: %w", err)
-	}
+	spec := &jobSpec{
+		Name:          name,
+		Cwd:           cwd,
+		Argv:          argv,
+		Env:           env,
+		Props:         props,
+		Desc:          runDesc,
+		Group:         runGroup,
+		Tags:          runTags,
+		NotifyCommand: profile.NotifyCommand,
+		NotifyOn:      profile.NotifyOn,
 
-	host, _ := os.Hostname()
-	user := os.Getenv("USER")
+		CheckpointSignal: runCkptSignal,
+		CheckpointPath:   runCkptPath,
+		LogFile:          runLogFile,
+		LogLimits:        limits,
+		StallAction:      runStallAction,
+	}
+	if runStallTimeout != "" {
+		if spec.StallTimeout, err = systemd.ParseTimespan(runStallTimeout); err != nil || spec.StallTimeout <= 0 {
+			return fmt.Errorf("invalid --stall-timeout %q", runStallTimeout)
+		}
+	}
+	if runStallAction != stallNotify && runStallAction != stallStop {
+		return fmt.Errorf("invalid --stall-action %q (expected notify or stop)", runStallAction)
+	}
+	if len(runSuccessExit) > 0 || runSuccessOutput != "" || len(runSuccessFiles) > 0 {
+		if _, err := regexp.Compile(runSuccessOutput); err != nil {
+			return fmt.Errorf("invalid --success-output: %w", err)
+		}
+		spec.SuccessRules = &db.SuccessRules{ExitCodes: runSuccessExit, Output: runSuccessOutput, Files: runSuccessFiles}
+	}
+	if len(runArtifactGlobs) > 0 {
+		for _, pattern := range runArtifactGlobs {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid --artifact %q: %w", pattern, err)
+			}
+		}
+		spec.ArtifactRules = &db.ArtifactRules{Patterns: runArtifactGlobs, SHA256: runArtifactSum}
+	} else if runArtifactSum {
+		return fmt.Errorf("--artifact-sha256 requires --artifact")
+	}
+	spec.Snapshot = cfg.Defaults.Snapshot
+	if cmd.Flags().Changed("snapshot") {
+		spec.Snapshot = runSnapshot
+	}
+	if cmd.Flags().Changed("tee") {
+		spec.Tee = "never"
+		if runTee {
+			spec.Tee = "always"
+		}
+	}
 
-	id, err := db.CreateJob(name, unit, cwd, argv, env, props, host, user)
+	id, err := launchJob(spec)
 	if err != nil {
-		return fmt.Errorf("job started but failed to record: %w", err)
+		return err
 	}
+	unit := spec.Unit
 
 	fmt.Printf("Started %d %s\n", id, unit)
 
@@ -198,7 +650,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 		// Start log streaming in background
 		logDone := make(chan error, 1)
 		go func() {
-			logDone <- systemd.Logs(unit, true, 0, "", "", false, false)
+			logDone <- systemd.Logs([]string{unit}, true, 0, "", "", false, false)
 		}()
 
 		// Wait for either signal or log completion
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+// jobSelector holds the bulk selection flags shared by status, logs, stop
+// and rm. Positional arguments (job references as understood by
+// db.ResolveJob, or id ranges such as 40-55) pick the candidate jobs; the
+// flags narrow them down, or select from all jobs when no arguments are
+// given.
+type jobSelector struct {
+	Name   string
+	State  string
+	Group  string
+	Tag    string
+	Yes    bool
+	DryRun bool
+}
+
+func addSelectorFlags(cmd *cobra.Command, sel *jobSelector) {
+	cmd.Flags().StringVar(&sel.Name, "name", "", "select jobs by name prefix")
+	cmd.Flags().StringVar(&sel.State, "state", "", "select jobs by state (active, failed, exited, ...)")
+	cmd.Flags().StringVar(&sel.Group, "group", "", "select jobs in a group")
+	cmd.Flags().StringVar(&sel.Tag, "tag", "", "select jobs with a tag")
+}
+
+// addBulkFlags adds the confirmation flags used by destructive commands.
+func addBulkFlags(cmd *cobra.Command, sel *jobSelector) {
+	cmd.Flags().BoolVarP(&sel.Yes, "yes", "y", false, "do not ask for confirmation when several jobs are selected")
+	cmd.Flags().BoolVar(&sel.DryRun, "dry-run", false, "show which jobs would be affected without doing anything")
+}
+
+func (sel *jobSelector) hasFilters() bool {
+	return sel.Name != "" || sel.State != "" || sel.Group != "" || sel.Tag != ""
+}
+
+// matches reports whether job passes the name, group and tag filters.
+// The state filter needs live unit state and is applied separately.
+func (sel *jobSelector) matches(job *db.Job) bool {
+	if sel.Name != "" && !strings.HasPrefix(job.Name, sel.Name) {
+		return false
+	}
+	if sel.Group != "" && job.GroupName.String != sel.Group {
+		return false
+	}
+	if sel.Tag != "" && !hasTag(job, sel.Tag) {
+		return false
+	}
+	return true
+}
+
+// jobTags returns the tags given to job with jr run --tag.
+func jobTags(job *db.Job) []string {
+	var tags []string
+	if job.TagsJSON.Valid {
+		json.Unmarshal([]byte(job.TagsJSON.String), &tags)
+	}
+	return tags
+}
+
+func hasTag(job *db.Job, tag string) bool {
+	for _, t := range jobTags(job) {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var idRangePattern = regexp.MustCompile(`^(\d+)-(\d+)$`)
+
+// selectJobs resolves args and the selector flags to jobs in id order,
+// together with their live unit state.
+func (sel *jobSelector) selectJobs(args []string) ([]*db.Job, map[string]*systemd.UnitInfo, error) {
+	if len(args) == 0 && !sel.hasFilters() {
+		return nil, nil, fmt.Errorf("requires a job id, unit or selector (--name, --state, --group, --tag)")
+	}
+
+	var candidates []*db.Job
+	if len(args) == 0 {
+		var err error
+		candidates, err = db.ListJobs(0, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list jobs: %w", err)
+		}
+	} else {
+		seen := make(map[int64]bool)
+		add := func(job *db.Job) {
+			if !seen[job.ID] {
+				seen[job.ID] = true
+				candidates = append(candidates, job)
+			}
+		}
+
+		for _, arg := range args {
+			if m := idRangePattern.FindStringSubmatch(arg); m != nil {
+				jobs, err := jobsInRange(m[1], m[2])
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, job := range jobs {
+					add(job)
+				}
+				continue
+			}
+
+			job, err := db.ResolveJob(arg)
+			var ambiguous *db.AmbiguousError
+			if errors.As(err, &ambiguous) {
+				return nil, nil, err
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to find job: %w", err)
+			}
+			if job == nil {
+				return nil, nil, fmt.Errorf("job not found: %s", arg)
+			}
+			add(job)
+		}
+	}
+
+	var filtered []*db.Job
+	for _, job := range candidates {
+		if sel.matches(job) {
+			filtered = append(filtered, job)
+		}
+	}
+
+	infos := showJobUnits(filtered)
+
+	if sel.State != "" {
+		var matched []*db.Job
+		for _, job := range filtered {
+			if jobState(job, infos) == sel.State {
+				matched = append(matched, job)
+			}
+		}
+		filtered = matched
+	}
+
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].ID < filtered[j].ID })
+
+	if len(filtered) == 0 {
+		return nil, nil, fmt.Errorf("no jobs match the selection")
+	}
+
+	return filtered, infos, nil
+}
+
+func jobsInRange(lo, hi string) ([]*db.Job, error) {
+	start, err1 := strconv.ParseInt(lo, 10, 64)
+	end, err2 := strconv.ParseInt(hi, 10, 64)
+	if err1 != nil || err2 != nil || end < start {
+		return nil, fmt.Errorf("invalid id range: %s-%s", lo, hi)
+	}
+
+	jobs, err := db.ListJobsByIDRange(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// showJobUnits queries systemd for the units of jobs. Units systemd cannot
+// report on are simply missing from the result.
+func showJobUnits(jobs []*db.Job) map[string]*systemd.UnitInfo {
+	units := make([]string, len(jobs))
+	for i, job := range jobs {
+		units[i] = job.Unit
+	}
+
+	infos, err := systemd.ShowUnits(units)
+	if err != nil {
+		return make(map[string]*systemd.UnitInfo)
+	}
+	return infos
+}
+
+// jobState returns the display state of job given the live unit infos.
+func jobState(job *db.Job, infos map[string]*systemd.UnitInfo) string {
+	return unitState(job, infos[job.Unit])
+}
+
+// unitState returns the display state of job from its unit info, falling
+// back to the state recorded in the database once systemd has forgotten the
+// unit.
+func unitState(job *db.Job, info *systemd.UnitInfo) string {
+	if info != nil && info.ActiveState != "" && !info.Gone() {
+		state := systemd.GetStateString(info)
+		if state == "active" && (info.FreezerState == "frozen" || job.LastKnownState.String == "paused") {
+			return "paused"
+		}
+		if state == "active" && job.LastKnownState.String == "stalled" {
+			return "stalled"
+		}
+		return state
+	}
+	if job.LastKnownState.Valid {
+		return job.LastKnownState.String
+	}
+	return "unknown"
+}
+
+// confirmBulk previews the jobs a destructive action would affect. It
+// returns false when the action should not go ahead: on --dry-run, or when
+// several jobs are selected and the user does not confirm.
+func (sel *jobSelector) confirmBulk(action string, jobs []*db.Job) (bool, error) {
+	if sel.DryRun {
+		for _, job := range jobs {
+			fmt.Printf("Would %s %d %s\n", action, job.ID, job.Unit)
+		}
+		return false, nil
+	}
+
+	if len(jobs) <= 1 || sel.Yes {
+		return true, nil
+	}
+
+	if !isStdinTerminal() {
+		return false, fmt.Errorf("refusing to %s %d jobs without confirmation (use --yes)", action, len(jobs))
+	}
+
+	for _, job := range jobs {
+		fmt.Printf("  %d\t%s\t%s\n", job.ID, job.Name, job.Unit)
+	}
+	fmt.Printf("%s %d jobs? [y/N] ", strings.ToUpper(action[:1])+action[1:], len(jobs))
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func isStdinTerminal() bool {
+	fileInfo, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return (fileInfo.Mode() & os.ModeCharDevice) != 0
+}
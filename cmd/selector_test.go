@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+func TestUnitState(t *testing.T) {
+	recorded := func(state string) *db.Job {
+		return &db.Job{LastKnownState: sql.NullString{String: state, Valid: state != ""}}
+	}
+
+	tests := []struct {
+		name string
+		job  *db.Job
+		info *systemd.UnitInfo
+		want string
+	}{
+		{"running", recorded(""), &systemd.UnitInfo{ActiveState: "active"}, "active"},
+		{"frozen", recorded(""), &systemd.UnitInfo{ActiveState: "active", FreezerState: "frozen"}, "paused"},
+		{"stopped by signal", recorded("paused"), &systemd.UnitInfo{ActiveState: "active"}, "paused"},
+		{"paused then died", recorded("paused"), &systemd.UnitInfo{ActiveState: "failed"}, "failed"},
+		{"stalled", recorded("stalled"), &systemd.UnitInfo{ActiveState: "active"}, "stalled"},
+		{"stalled then stopped", recorded("stalled"), &systemd.UnitInfo{ActiveState: "failed"}, "failed"},
+		{"collected", recorded("failed"), &systemd.UnitInfo{LoadState: "not-found", ActiveState: "inactive"}, "failed"},
+		{"never seen", recorded(""), nil, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unitState(tt.job, tt.info); got != tt.want {
+				t.Errorf("unitState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/jr/db"
+)
+
+// gitDiffName is the file in the job directory holding the uncommitted
+// changes of the job's checkout at launch.
+const gitDiffName = "git.diff"
+
+// gitCheckout is the state of a git checkout.
+type gitCheckout struct {
+	Commit    string
+	Branch    string
+	Diff      []byte
+	Untracked int
+}
+
+// readGitCheckout returns the state of the git checkout holding dir, or nil
+// if dir is not in one.
+func readGitCheckout(dir string) (*gitCheckout, error) {
+	git := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+	if _, err := git("rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, nil
+	}
+
+	commit, err := git("rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		// No commit yet
+		return nil, nil
+	}
+	checkout := &gitCheckout{Commit: strings.TrimSpace(string(commit))}
+
+	// Fails on a detached HEAD
+	if branch, err := git("symbolic-ref", "-q", "--short", "HEAD"); err == nil {
+		checkout.Branch = strings.TrimSpace(string(branch))
+	}
+
+	if checkout.Diff, err = git("diff", "--binary", "HEAD"); err != nil {
+		return nil, err
+	}
+
+	status, err := git("status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "??") {
+			checkout.Untracked++
+		}
+	}
+	return checkout, nil
+}
+
+// diffSHA256 returns the checksum of a diff, empty for no changes.
+func diffSHA256(diff []byte) string {
+	if len(diff) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(diff)
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveExecutable returns the path of the file command runs, looked up
+// in PATH unless it has a slash, relative to cwd if not absolute.
+func resolveExecutable(command, cwd string) (string, error) {
+	path := command
+	if !strings.Contains(command, "/") {
+		var err error
+		if path, err = exec.LookPath(command); err != nil {
+			return "", err
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// takeSnapshot records the git state of cwd and the executable of argv,
+// keeping any uncommitted changes in jobDir. Whatever cannot be read is
+// left out with a warning rather than failing the launch.
+func takeSnapshot(cwd string, argv []string, jobDir string) *db.Snapshot {
+	snapshot := &db.Snapshot{}
+
+	checkout, err := readGitCheckout(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: snapshot: %v\n", err)
+	}
+	if checkout != nil {
+		snapshot.GitCommit = checkout.Commit
+		snapshot.GitBranch = checkout.Branch
+		snapshot.GitUntracked = checkout.Untracked
+		if len(checkout.Diff) > 0 {
+			snapshot.GitDiffSHA256 = diffSHA256(checkout.Diff)
+			err := os.MkdirAll(jobDir, 0700)
+			if err == nil {
+				err = os.WriteFile(filepath.Join(jobDir, gitDiffName), checkout.Diff, 0600)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: snapshot: failed to save git diff: %v\n", err)
+			}
+		}
+	}
+
+	if exe, err := resolveExecutable(argv[0], cwd); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: snapshot: failed to resolve %s: %v\n", argv[0], err)
+	} else {
+		snapshot.Executable = exe
+		if snapshot.ExecutableSHA256, err = fileSHA256(exe); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: snapshot: %v\n", err)
+		}
+	}
+	return snapshot
+}
+
+// jobSnapshot returns the snapshot recorded for job, nil if none.
+func jobSnapshot(job *db.Job) *db.Snapshot {
+	if !job.SnapshotJSON.Valid {
+		return nil
+	}
+	var snapshot db.Snapshot
+	if err := json.Unmarshal([]byte(job.SnapshotJSON.String), &snapshot); err != nil {
+		return nil
+	}
+	return &snapshot
+}
+
+// formatGitSnapshot describes the git part of snapshot for jr status, with
+// the path of the saved diff if there is one.
+func formatGitSnapshot(job *db.Job, snapshot *db.Snapshot) string {
+	s := shortCommit(snapshot.GitCommit)
+	if snapshot.GitBranch != "" {
+		s += " (" + snapshot.GitBranch + ")"
+	}
+	if snapshot.GitDiffSHA256 != "" {
+		s += ", uncommitted changes"
+		if dir, err := db.JobDir(job.Unit); err == nil {
+			s += " in " + filepath.Join(dir, gitDiffName)
+		}
+	}
+	if snapshot.GitUntracked > 0 {
+		s += fmt.Sprintf(", %d untracked files", snapshot.GitUntracked)
+	}
+	return s
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// snapshotDrift compares the snapshot of a job with the current state of
+// its cwd and executable, describing each difference.
+func snapshotDrift(snapshot *db.Snapshot, cwd, command string) []string {
+	var drift []string
+
+	if snapshot.GitCommit != "" {
+		checkout, err := readGitCheckout(cwd)
+		switch {
+		case err != nil:
+			drift = append(drift, fmt.Sprintf("cannot read the git checkout: %v", err))
+		case checkout == nil:
+			drift = append(drift, cwd+" is no longer a git checkout")
+		default:
+			if checkout.Commit != snapshot.GitCommit {
+				was := shortCommit(snapshot.GitCommit)
+				if snapshot.GitBranch != "" {
+					was += " (" + snapshot.GitBranch + ")"
+				}
+				now := shortCommit(checkout.Commit)
+				if checkout.Branch != "" {
+					now += " (" + checkout.Branch + ")"
+				}
+				drift = append(drift, fmt.Sprintf("HEAD is now %s, was %s", now, was))
+			}
+			if sum := diffSHA256(checkout.Diff); sum != snapshot.GitDiffSHA256 {
+				switch {
+				case sum == "":
+					drift = append(drift, "the uncommitted changes the job ran with are gone")
+				case snapshot.GitDiffSHA256 == "":
+					drift = append(drift, "the working tree has uncommitted changes, the job ran on a clean tree")
+				default:
+					drift = append(drift, "the uncommitted changes differ from those the job ran with")
+				}
+			}
+		}
+	}
+
+	if snapshot.Executable != "" {
+		exe, err := resolveExecutable(command, cwd)
+		switch {
+		case err != nil:
+			drift = append(drift, fmt.Sprintf("cannot resolve %s: %v", command, err))
+		case exe != snapshot.Executable:
+			drift = append(drift, fmt.Sprintf("%s now resolves to %s, was %s", command, exe, snapshot.Executable))
+		case snapshot.ExecutableSHA256 != "":
+			if sum, err := fileSHA256(exe); err == nil && sum != snapshot.ExecutableSHA256 {
+				drift = append(drift, fmt.Sprintf("%s has changed since", exe))
+			}
+		}
+	}
+
+	return drift
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/jr/db"
+)
+
+func TestSnapshotDrift(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=jr", "GIT_AUTHOR_EMAIL=jr@example.com",
+			"GIT_COMMITTER_NAME=jr", "GIT_COMMITTER_EMAIL=jr@example.com")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", args[0], err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	write("train.sh", "#!/bin/sh\necho 1\n")
+	git("add", "train.sh")
+	git("commit", "-q", "-m", "first")
+	write("train.sh", "#!/bin/sh\necho 2\n")
+	write("notes.txt", "untracked")
+
+	jobDir := t.TempDir()
+	snapshot := takeSnapshot(repo, []string{"./train.sh"}, jobDir)
+	if len(snapshot.GitCommit) != 40 || snapshot.GitBranch != "main" || snapshot.GitUntracked != 1 {
+		t.Fatalf("Unexpected git snapshot %+v", snapshot)
+	}
+	if diff, err := os.ReadFile(filepath.Join(jobDir, gitDiffName)); err != nil || !strings.Contains(string(diff), "+echo 2") {
+		t.Errorf("Expected the diff to be saved, got %q (%v)", diff, err)
+	}
+	if snapshot.Executable != filepath.Join(repo, "train.sh") || snapshot.ExecutableSHA256 == "" {
+		t.Errorf("Unexpected executable %q (%q)", snapshot.Executable, snapshot.ExecutableSHA256)
+	}
+
+	if drift := snapshotDrift(snapshot, repo, "./train.sh"); len(drift) != 0 {
+		t.Errorf("Expected no drift right after the snapshot, got %q", drift)
+	}
+
+	git("commit", "-q", "-am", "second")
+	drift := snapshotDrift(snapshot, repo, "./train.sh")
+	if len(drift) != 2 || !strings.HasPrefix(drift[0], "HEAD is now") || !strings.Contains(drift[1], "are gone") {
+		t.Errorf("Expected a new HEAD and lost changes, got %q", drift)
+	}
+
+	write("train.sh", "#!/bin/sh\necho 3\n")
+	drift = snapshotDrift(snapshot, repo, "./train.sh")
+	if len(drift) != 3 || !strings.Contains(drift[1], "differ") || !strings.Contains(drift[2], "has changed") {
+		t.Errorf("Expected changed diff and executable, got %q", drift)
+	}
+
+	// Outside a checkout only the executable is recorded
+	if snapshot := takeSnapshot(t.TempDir(), []string{"sh"}, jobDir); snapshot.GitCommit != "" || snapshot.Executable == "" {
+		t.Errorf("Unexpected snapshot outside git: %+v", snapshot)
+	}
+}
+
+func TestRerunSpec(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	props := map[string]string{
+		"MemoryMax":       "4G",
+		"ExecStopPost":    finishProperty("/usr/bin/jr", "/jr.db", "jr-train-1.service", "", ""),
+		"EnvironmentFile": "/work/.env",
+		"StandardOutput":  "append:/logs/train.log",
+		"StandardError":   "append:/logs/train.log",
+	}
+	propsJSON, _ := json.Marshal(props)
+	job := &db.Job{
+		ID:             7,
+		Name:           "train",
+		Unit:           "jr-train-1.service",
+		Cwd:            "/work",
+		ArgvJSON:       `["python","train.py"]`,
+		EnvJSON:        `{"LR":"0.1","API_TOKEN":"<redacted>"}`,
+		PropertiesJSON: string(propsJSON),
+		GroupName:      sql.NullString{String: "search", Valid: true},
+		TagsJSON:       sql.NullString{String: `["scratch"]`, Valid: true},
+		LogFile:        sql.NullString{String: "/logs/train.log", Valid: true},
+		SuccessRules:   sql.NullString{String: `{"exitCodes":[0,2]}`, Valid: true},
+		SnapshotJSON:   sql.NullString{String: `{"gitCommit":"abc"}`, Valid: true},
+	}
+
+	if _, err := rerunSpec(job, func(string) (string, bool) { return "", false }); err == nil || !strings.Contains(err.Error(), "API_TOKEN") {
+		t.Errorf("Expected an error naming the missing secret, got %v", err)
+	}
+
+	spec, err := rerunSpec(job, func(k string) (string, bool) { return "hunter2", k == "API_TOKEN" })
+	if err != nil {
+		t.Fatalf("rerunSpec: %v", err)
+	}
+	if spec.Env["API_TOKEN"] != "hunter2" || spec.Env["LR"] != "0.1" {
+		t.Errorf("Unexpected env %v", spec.Env)
+	}
+	if len(spec.Props) != 2 || spec.Props["MemoryMax"] != "4G" || spec.Props["EnvironmentFile"] != "/work/.env" {
+		t.Errorf("Expected only the user's properties, got %v", spec.Props)
+	}
+	if spec.LogFile != logFileCombined || spec.Group != "search" || len(spec.Tags) != 1 || !spec.Snapshot {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+	if spec.SuccessRules == nil || len(spec.SuccessRules.ExitCodes) != 2 {
+		t.Errorf("Expected success rules to carry over, got %+v", spec.SuccessRules)
+	}
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+// Values of jr run --stall-action.
+const (
+	stallNotify = "notify"
+	stallStop   = "stop"
+)
+
+var stallActions = []string{stallNotify, stallStop}
+
+const eventStall = "stall"
+
+// stallCPUThreshold is the share of one CPU below which a silent job counts
+// as stalled rather than busy computing.
+const stallCPUThreshold = 0.01
+
+// stallWatch detects a job that has written no output for timeout while
+// using almost no CPU. The copier calls touch on output and run checks
+// periodically.
+type stallWatch struct {
+	timeout time.Duration
+	now     func() time.Time
+	// cpu returns the job's CPU time so far; on error only silence counts.
+	cpu func() (time.Duration, error)
+
+	mu         sync.Mutex
+	lastOutput time.Time
+
+	// The CPU time at the first check of the current silence
+	baselineAt  time.Time
+	baselineCPU time.Duration
+	stalledAt   time.Time
+}
+
+func newStallWatch(timeout time.Duration) *stallWatch {
+	return &stallWatch{timeout: timeout, now: time.Now, cpu: systemd.OwnCgroupCPU, lastOutput: time.Now()}
+}
+
+func (s *stallWatch) touch() {
+	s.mu.Lock()
+	s.lastOutput = s.now()
+	s.mu.Unlock()
+}
+
+// check reports whether the job has just stalled or has just recovered
+// from a stall by writing output again.
+func (s *stallWatch) check() (stalled, recovered bool) {
+	s.mu.Lock()
+	lastOutput := s.lastOutput
+	s.mu.Unlock()
+	now := s.now()
+
+	if !s.stalledAt.IsZero() {
+		if lastOutput.After(s.stalledAt) {
+			s.stalledAt, s.baselineAt = time.Time{}, time.Time{}
+			return false, true
+		}
+		return false, false
+	}
+
+	cpu, cpuErr := s.cpu()
+	if s.baselineAt.IsZero() || lastOutput.After(s.baselineAt) {
+		s.baselineAt, s.baselineCPU = now, cpu
+	}
+	if now.Sub(lastOutput) < s.timeout {
+		return false, false
+	}
+	if cpuErr == nil {
+		if elapsed := now.Sub(s.baselineAt); elapsed > 0 && float64(cpu-s.baselineCPU)/float64(elapsed) >= stallCPUThreshold {
+			return false, false
+		}
+	}
+
+	s.stalledAt = now
+	return true, false
+}
+
+// interval is how often run checks: a tenth of the timeout, between a
+// second and a minute.
+func (s *stallWatch) interval() time.Duration {
+	return min(max(s.timeout/10, time.Second), time.Minute)
+}
+
+// run checks for stalls until done is closed, calling onStall and
+// onRecover as the job stalls and recovers. onStall returns false if the
+// job turned out not to be stalled after all, say because it is paused.
+func (s *stallWatch) run(done <-chan struct{}, onStall func() bool, onRecover func()) {
+	ticker := time.NewTicker(s.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			stalled, recovered := s.check()
+			if stalled && !onStall() {
+				s.stalledAt, s.baselineAt = time.Time{}, time.Time{}
+			} else if recovered {
+				onRecover()
+			}
+		}
+	}
+}
+
+// stallHandlers returns the functions that act on a stall of the job of
+// unit per opts: mark the job stalled in the database, note it in the
+// job's output, and stop the job or run its notify command.
+func stallHandlers(opts *teeOptions) (onStall func() bool, onRecover func()) {
+	onStall = func() bool {
+		message := fmt.Sprintf("no output for %s and under %.0f%% CPU", formatAge(opts.StallTimeout), stallCPUThreshold*100)
+		if opts.DB != "" {
+			if err := openJobDB(opts.DB); err != nil {
+				fmt.Fprintf(os.Stderr, "jr: failed to open database: %v\n", err)
+			} else if marked, err := db.SetJobStalled(opts.Unit); err != nil {
+				fmt.Fprintf(os.Stderr, "jr: failed to mark job stalled: %v\n", err)
+			} else if !marked {
+				// Paused or already gone
+				return false
+			}
+		}
+
+		outcome := "marked stalled"
+		if opts.StallAction == stallStop {
+			outcome = "stopping the job"
+		}
+		fmt.Fprintf(os.Stderr, "jr: job stalled: %s; %s\n", message, outcome)
+
+		if opts.StallAction == stallStop {
+			if err := systemd.StopUnitNoBlock(opts.Unit); err != nil {
+				fmt.Fprintf(os.Stderr, "jr: failed to stop %s: %v\n", opts.Unit, err)
+			}
+		} else {
+			runStallNotify(opts.Unit, opts.Notify, opts.NotifyOn)
+		}
+
+		if opts.DB != "" {
+			if err := recordJobEvent(opts.DB, opts.Unit, eventStall, message+"; "+outcome); err != nil {
+				fmt.Fprintf(os.Stderr, "jr: failed to record %s event: %v\n", eventStall, err)
+			}
+		}
+		return true
+	}
+
+	onRecover = func() {
+		fmt.Fprintf(os.Stderr, "jr: job is writing output again after stalling\n")
+		if opts.DB == "" {
+			return
+		}
+		if err := openJobDB(opts.DB); err == nil {
+			db.SetJobUnstalled(opts.Unit)
+		}
+	}
+	return onStall, onRecover
+}
+
+// runStallNotify runs the job's notify command as ExecStopPost= would,
+// with SERVICE_RESULT set to "stalled". A stall counts as a failure for
+// the --notify-on filter.
+func runStallNotify(unit, notify, on string) {
+	if notify == "" || (on != "" && on != "always" && on != verdictFailure) {
+		return
+	}
+	cmd := exec.Command("/bin/sh", "-c", notify)
+	cmd.Env = append(os.Environ(), "JR_UNIT="+unit, "SERVICE_RESULT=stalled")
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "jr: notify command failed: %v\n", err)
+	}
+}
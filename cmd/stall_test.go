@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStallWatch returns a stall watch on a fake clock and CPU counter.
+func testStallWatch(timeout time.Duration) (*stallWatch, *time.Time, *time.Duration) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var cpu time.Duration
+	s := &stallWatch{timeout: timeout, lastOutput: now}
+	s.now = func() time.Time { return now }
+	s.cpu = func() (time.Duration, error) { return cpu, nil }
+	return s, &now, &cpu
+}
+
+func TestStallWatch(t *testing.T) {
+	s, now, _ := testStallWatch(time.Minute)
+
+	*now = now.Add(30 * time.Second)
+	if stalled, _ := s.check(); stalled {
+		t.Fatal("Expected no stall before the timeout")
+	}
+
+	*now = now.Add(40 * time.Second)
+	if stalled, _ := s.check(); !stalled {
+		t.Fatal("Expected a stall after a silent, idle minute")
+	}
+	if stalled, _ := s.check(); stalled {
+		t.Error("Expected a stall to be reported once")
+	}
+
+	*now = now.Add(time.Second)
+	s.touch()
+	*now = now.Add(time.Second)
+	if _, recovered := s.check(); !recovered {
+		t.Error("Expected recovery once output resumes")
+	}
+}
+
+func TestStallWatchBusy(t *testing.T) {
+	s, now, cpu := testStallWatch(time.Minute)
+
+	s.check()
+	*now = now.Add(2 * time.Minute)
+	*cpu += time.Minute
+	if stalled, _ := s.check(); stalled {
+		t.Error("Expected a silent job busy on the CPU not to be stalled")
+	}
+}
+
+func TestStallWatchNoCPU(t *testing.T) {
+	s, now, _ := testStallWatch(time.Minute)
+	s.cpu = func() (time.Duration, error) { return 0, errors.New("no cgroup") }
+
+	*now = now.Add(2 * time.Minute)
+	if stalled, _ := s.check(); !stalled {
+		t.Error("Expected silence alone to count without CPU usage")
+	}
+}
+
+func TestRunStallNotify(t *testing.T) {
+	for on, want := range map[string]bool{"": true, "always": true, "failure": true, "success": false} {
+		marker := filepath.Join(t.TempDir(), "notified")
+		runStallNotify("jr-a.service", "touch "+marker, on)
+		if _, err := os.Stat(marker); (err == nil) != want {
+			t.Errorf("runStallNotify(--notify-on %q) notified = %v, want %v", on, err == nil, want)
+		}
+	}
+}
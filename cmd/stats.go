@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+)
+
+var (
+	statsSince    string
+	statsUntil    string
+	statsJSON     bool
+	statsSelector jobSelector
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [flags]",
+	Short: "Summarize how jobs have used the machine",
+	Long: `Summarize the jobs created in a time window, per name: how many ran,
+how many succeeded or failed (by their verdict, see 'jr run --success-exit'),
+median and 95th percentile durations, CPU-hours and peak memory, plus the
+hours of the day when most jobs start.
+
+Outcomes, durations and resource usage are those jobs recorded as they
+finished. Run 'jr sync' first for jobs that could not record their own,
+or set auto_sync = true in [defaults].`,
+	Args: cobra.NoArgs,
+	RunE: runStats,
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsSince, "since", "30d", "window start: an age such as 7d, a date (2006-01-02), or \"all\"")
+	statsCmd.Flags().StringVar(&statsUntil, "until", "", "window end, like --since (default: now)")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "output as JSON")
+	statsCmd.Flags().StringVar(&statsSelector.Name, "name", "", "only jobs with this name prefix")
+	statsCmd.Flags().StringVar(&statsSelector.Group, "group", "", "only jobs in a group")
+	statsCmd.Flags().StringVar(&statsSelector.Tag, "tag", "", "only jobs with a tag")
+	statsCmd.RegisterFlagCompletionFunc("name", completeNames)
+	statsCmd.RegisterFlagCompletionFunc("group", completeGroups)
+	statsCmd.RegisterFlagCompletionFunc("tag", completeTags)
+}
+
+// NameStats summarizes the jobs of one name, or all jobs.
+type NameStats struct {
+	Name string `json:"name"`
+	sweepSummary
+	// SuccessRate is succeeded over finished jobs, -1 if none finished.
+	SuccessRate float64 `json:"successRate"`
+	// Durations of finished jobs in seconds; 0 if none is known.
+	MedianSeconds float64 `json:"medianSeconds"`
+	P95Seconds    float64 `json:"p95Seconds"`
+	CPUHours      float64 `json:"cpuHours"`
+	// MemoryPeak is the highest peak of any job in bytes; 0 if unknown.
+	MemoryPeak int64 `json:"memoryPeak"`
+
+	durations []time.Duration
+}
+
+// StatsOutput is what jr stats --json prints.
+type StatsOutput struct {
+	Since string       `json:"since,omitempty"`
+	Until string       `json:"until,omitempty"`
+	Total *NameStats   `json:"total"`
+	Names []*NameStats `json:"names"`
+	// StartsByHour counts job starts per local hour of the day.
+	StartsByHour [24]int `json:"startsByHour"`
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+	since, err := parseStatsTime(statsSince, now)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	var until time.Time
+	if statsUntil != "" {
+		if until, err = parseStatsTime(statsUntil, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+
+	if cfg.Defaults.AutoSync {
+		if _, err := reconcile(true, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: auto sync failed: %v\n", err)
+		}
+	}
+
+	jobs, err := db.ListJobsCreatedBetween(since, until)
+	if err != nil {
+		return fmt.Errorf("failed to list jobs: %w", err)
+	}
+	var selected []*db.Job
+	for _, job := range jobs {
+		if statsSelector.matches(job) {
+			selected = append(selected, job)
+		}
+	}
+
+	output := jobStats(selected)
+	if !since.IsZero() {
+		output.Since = since.UTC().Format(time.RFC3339)
+	}
+	if !until.IsZero() {
+		output.Until = until.UTC().Format(time.RFC3339)
+	}
+
+	if statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(output)
+	}
+
+	window := "all time"
+	if !since.IsZero() {
+		window = "since " + since.Local().Format("2006-01-02 15:04")
+	}
+	if !until.IsZero() {
+		window += " until " + until.Local().Format("2006-01-02 15:04")
+	}
+	if len(selected) == 0 {
+		fmt.Printf("No jobs %s\n", window)
+		return nil
+	}
+
+	total := output.Total
+	fmt.Printf("%d jobs %s: %d succeeded, %d failed, %d running", total.Total, window, total.Succeeded, total.Failed, total.Running)
+	if total.Other > 0 {
+		fmt.Printf(", %d other", total.Other)
+	}
+	fmt.Println()
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tJOBS\tOK\tFAILED\tSUCCESS\tMEDIAN\tP95\tCPU-HOURS\tPEAK MEM")
+	for _, s := range append(output.Names, total) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			s.Name, s.Total, s.Succeeded, s.Failed, formatRate(s.SuccessRate),
+			formatSeconds(s.MedianSeconds), formatSeconds(s.P95Seconds),
+			formatCPUHours(s.CPUHours), formatPeak(s.MemoryPeak))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if busiest := busiestHours(output.StartsByHour, 3); len(busiest) > 0 {
+		fmt.Printf("\nBusiest hours: %s\n", strings.Join(busiest, ", "))
+	}
+	return nil
+}
+
+// jobStats aggregates jobs per name, the busiest names first, with the
+// total for all of them under the name "all".
+func jobStats(jobs []*db.Job) *StatsOutput {
+	output := &StatsOutput{Total: &NameStats{Name: "all"}}
+	byName := make(map[string]*NameStats)
+	for _, job := range jobs {
+		s := byName[job.Name]
+		if s == nil {
+			s = &NameStats{Name: job.Name}
+			byName[job.Name] = s
+			output.Names = append(output.Names, s)
+		}
+
+		for _, s := range []*NameStats{s, output.Total} {
+			s.addJob(job)
+		}
+
+		started, ok := parseUTC(job.StartedAtUTC.String)
+		if !ok {
+			started, _ = parseUTC(job.CreatedAtUTC)
+		}
+		output.StartsByHour[started.Local().Hour()]++
+	}
+
+	for _, s := range append(output.Names, output.Total) {
+		s.finish()
+	}
+	sort.SliceStable(output.Names, func(i, j int) bool {
+		return output.Names[i].Total > output.Names[j].Total
+	})
+	if output.Names == nil {
+		output.Names = []*NameStats{}
+	}
+	return output
+}
+
+func (s *NameStats) addJob(job *db.Job) {
+	// Stats come from what was recorded, without asking systemd
+	s.add(verdictState(job, job.LastKnownState.String))
+
+	started, startedOK := parseUTC(job.StartedAtUTC.String)
+	finished, finishedOK := parseUTC(job.FinishedAtUTC.String)
+	if startedOK && finishedOK && !finished.Before(started) {
+		s.durations = append(s.durations, finished.Sub(started))
+	}
+	s.CPUHours += time.Duration(job.CPUUsageNSec.Int64).Hours()
+	s.MemoryPeak = max(s.MemoryPeak, job.MemoryPeak.Int64)
+}
+
+func (s *NameStats) finish() {
+	s.SuccessRate = -1
+	if finished := s.Succeeded + s.Failed; finished > 0 {
+		s.SuccessRate = float64(s.Succeeded) / float64(finished)
+	}
+	sort.Slice(s.durations, func(i, j int) bool { return s.durations[i] < s.durations[j] })
+	s.MedianSeconds = percentile(s.durations, 0.5).Seconds()
+	s.P95Seconds = percentile(s.durations, 0.95).Seconds()
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, 0 if it
+// is empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// busiestHours formats the n hours of the day with the most job starts.
+func busiestHours(starts [24]int, n int) []string {
+	hours := make([]int, 24)
+	for h := range hours {
+		hours[h] = h
+	}
+	sort.SliceStable(hours, func(i, j int) bool { return starts[hours[i]] > starts[hours[j]] })
+
+	var busiest []string
+	for _, h := range hours[:n] {
+		if starts[h] == 0 {
+			break
+		}
+		busiest = append(busiest, fmt.Sprintf("%02d:00 (%d jobs)", h, starts[h]))
+	}
+	return busiest
+}
+
+// parseStatsTime parses a --since or --until value relative to now: an age
+// such as 7d, a date, or "all" for no bound.
+func parseStatsTime(s string, now time.Time) (time.Time, error) {
+	if s == "all" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an age such as 7d or a date such as 2006-01-02", s)
+	}
+	return now.Add(-d), nil
+}
+
+func formatRate(rate float64) string {
+	if rate < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", rate*100)
+}
+
+func formatSeconds(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+	return roundDuration(time.Duration(seconds * float64(time.Second))).String()
+}
+
+func formatCPUHours(hours float64) string {
+	if hours == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", hours)
+}
+
+func formatPeak(bytes int64) string {
+	if bytes == 0 {
+		return "-"
+	}
+	return formatSize(bytes)
+}
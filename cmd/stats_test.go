@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/jr/db"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 20; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Second)
+	}
+	tests := []struct {
+		durations []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{nil, 0.5, 0},
+		{sorted[:1], 0.95, time.Second},
+		{sorted[:3], 0.5, 2 * time.Second},
+		{sorted[:4], 0.5, 2 * time.Second},
+		{sorted, 0.5, 10 * time.Second},
+		{sorted, 0.95, 19 * time.Second},
+		{sorted, 0, time.Second},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.durations, tt.p); got != tt.want {
+			t.Errorf("percentile(%d durations, %v) = %v, want %v", len(tt.durations), tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestJobStats(t *testing.T) {
+	job := func(name, state, started string, minutes int, cpu time.Duration, peak int64) *db.Job {
+		j := &db.Job{
+			Name:           name,
+			CreatedAtUTC:   started,
+			LastKnownState: sql.NullString{String: state, Valid: true},
+			StartedAtUTC:   sql.NullString{String: started, Valid: true},
+			CPUUsageNSec:   sql.NullInt64{Int64: int64(cpu), Valid: cpu > 0},
+			MemoryPeak:     sql.NullInt64{Int64: peak, Valid: peak > 0},
+		}
+		if minutes > 0 {
+			start, _ := time.Parse(time.RFC3339, started)
+			finished := start.Add(time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+			j.FinishedAtUTC = sql.NullString{String: finished, Valid: true}
+		}
+		return j
+	}
+	jobs := []*db.Job{
+		job("eval", "exited", "2024-01-06T09:00:00Z", 5, 0, 0),
+		job("train", "exited", "2024-01-06T14:00:00Z", 60, 90*time.Minute, 4<<30),
+		job("train", "failed", "2024-01-06T14:30:00Z", 10, 30*time.Minute, 8<<30),
+		job("train", "active", "2024-01-07T14:00:00Z", 0, 0, 0),
+	}
+
+	output := jobStats(jobs)
+	if len(output.Names) != 2 || output.Names[0].Name != "train" || output.Names[1].Name != "eval" {
+		t.Fatalf("names not ordered by job count: %+v", output.Names)
+	}
+
+	train := output.Names[0]
+	if train.Total != 3 || train.Succeeded != 1 || train.Failed != 1 || train.Running != 1 {
+		t.Errorf("train counts = %+v", train.sweepSummary)
+	}
+	if train.SuccessRate != 0.5 {
+		t.Errorf("train success rate = %v, want 0.5", train.SuccessRate)
+	}
+	if train.MedianSeconds != 600 || train.P95Seconds != 3600 {
+		t.Errorf("train durations = median %v, p95 %v, want 600, 3600", train.MedianSeconds, train.P95Seconds)
+	}
+	if train.CPUHours != 2 {
+		t.Errorf("train CPU-hours = %v, want 2", train.CPUHours)
+	}
+	if train.MemoryPeak != 8<<30 {
+		t.Errorf("train memory peak = %d, want %d", train.MemoryPeak, int64(8<<30))
+	}
+
+	if output.Total.Total != 4 || output.Total.Succeeded != 2 || output.Total.CPUHours != 2 {
+		t.Errorf("total = %+v", output.Total)
+	}
+
+	starts := 0
+	for _, n := range output.StartsByHour {
+		starts += n
+	}
+	if starts != 4 {
+		t.Errorf("StartsByHour counts %d starts, want 4", starts)
+	}
+
+	empty := jobStats(nil)
+	if empty.Names == nil || empty.Total.SuccessRate != -1 {
+		t.Errorf("empty stats = %+v", empty)
+	}
+}
+
+func TestBusiestHours(t *testing.T) {
+	var starts [24]int
+	starts[9] = 2
+	starts[14] = 5
+	starts[22] = 2
+	got := busiestHours(starts, 4)
+	want := []string{"14:00 (5 jobs)", "09:00 (2 jobs)", "22:00 (2 jobs)"}
+	if len(got) != len(want) {
+		t.Fatalf("busiestHours = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("busiestHours = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestParseStatsTime(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	if got, err := parseStatsTime("7d", now); err != nil || !got.Equal(now.Add(-7*24*time.Hour)) {
+		t.Errorf("parseStatsTime(7d) = %v, %v", got, err)
+	}
+	if got, err := parseStatsTime("2024-01-02", now); err != nil || !got.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("parseStatsTime(2024-01-02) = %v, %v", got, err)
+	}
+	if got, err := parseStatsTime("all", now); err != nil || !got.IsZero() {
+		t.Errorf("parseStatsTime(all) = %v, %v", got, err)
+	}
+	if _, err := parseStatsTime("yesterday", now); err == nil {
+		t.Error("parseStatsTime(yesterday) succeeded")
+	}
+}
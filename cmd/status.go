@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -11,38 +13,62 @@ import (
 	"github.com/user/jr/systemd"
 )
 
-var statusJSON bool
+var (
+	statusJSON     bool
+	statusSelector jobSelector
+)
 
 var statusCmd = &cobra.Command{
-	Use:   "status <id|unit>",
-	Short: "Show detailed status for a job",
-	Args:  cobra.ExactArgs(1),
+	Use:   "status <job|range>... [flags]",
+	Short: "Show detailed status for jobs",
 	RunE:  runStatus,
 }
 
 func init() {
 	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "output as JSON")
+	addSelectorFlags(statusCmd, &statusSelector)
+	registerSelectorCompletions(statusCmd, anyState)
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
-	job, err := db.FindJobByPartial(args[0])
+	jobs, infos, err := statusSelector.selectJobs(args)
 	if err != nil {
-		return fmt.Errorf("failed to find job: %w", err)
-	}
-	if job == nil {
-		return fmt.Errorf("job not found: %s", args[0])
+		return err
 	}
 
-	info, err := systemd.ShowUnit(job.Unit)
-	if err != nil {
-		info = &systemd.UnitInfo{Unit: job.Unit}
-	}
+	// A single job argument keeps the single-object output
+	single := len(args) == 1 && !statusSelector.hasFilters() && len(jobs) == 1
 
 	if statusJSON {
-		return outputStatusJSON(job, info)
+		var outputs []map[string]interface{}
+		for _, job := range jobs {
+			outputs = append(outputs, statusJSONOutput(job, unitInfoOrEmpty(job, infos)))
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if single {
+			return enc.Encode(outputs[0])
+		}
+		return enc.Encode(outputs)
+	}
+
+	for i, job := range jobs {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := outputStatusHuman(job, unitInfoOrEmpty(job, infos)); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return outputStatusHuman(job, info)
+func unitInfoOrEmpty(job *db.Job, infos map[string]*systemd.UnitInfo) *systemd.UnitInfo {
+	if info := infos[job.Unit]; info != nil {
+		return info
+	}
+	return &systemd.UnitInfo{Unit: job.Unit}
 }
 
 func outputStatusHuman(job *db.Job, info *systemd.UnitInfo) error {
@@ -53,7 +79,7 @@ func outputStatusHuman(job *db.Job, info *systemd.UnitInfo) error {
 	created, _ := time.Parse(time.RFC3339, job.CreatedAtUTC)
 	fmt.Printf("Created:     %s\n", created.Format(time.RFC3339))
 
-	fmt.Printf("State:       %s\n", systemd.GetStateString(info))
+	fmt.Printf("State:       %s\n", unitState(job, info))
 	if info.SubState != "" {
 		fmt.Printf("SubState:    %s\n", info.SubState)
 	}
@@ -62,20 +88,97 @@ func outputStatusHuman(job *db.Job, info *systemd.UnitInfo) error {
 		fmt.Printf("PID:         %s\n", info.ExecMainPID)
 	}
 
-	if info.ExecMainStatus != "" {
+	if info.ExecMainStatus != "" && !info.Gone() {
 		fmt.Printf("Exit Code:   %s\n", info.ExecMainStatus)
+	} else if job.ExitStatus.Valid {
+		fmt.Printf("Exit Code:   %s\n", job.ExitStatus.String)
 	}
 
 	if info.ExecMainStartTimestamp != "" {
 		fmt.Printf("Started:     %s\n", info.ExecMainStartTimestamp)
+	} else if job.StartedAtUTC.Valid {
+		fmt.Printf("Started:     %s\n", job.StartedAtUTC.String)
 	}
 
 	if info.ExecMainExitTimestamp != "" {
 		fmt.Printf("Exited:      %s\n", info.ExecMainExitTimestamp)
+	} else if job.FinishedAtUTC.Valid {
+		fmt.Printf("Exited:      %s\n", job.FinishedAtUTC.String)
+	}
+
+	if job.PausedAtUTC.Valid {
+		fmt.Printf("Paused:      %s (%s)\n", job.PausedAtUTC.String, job.PauseMethod.String)
+	}
+
+	cpuUsage, memoryPeak := jobUsage(job, info)
+	if cpuUsage > 0 {
+		fmt.Printf("CPU time:    %s\n", roundDuration(cpuUsage))
+	}
+	if memoryPeak > 0 {
+		fmt.Printf("Memory peak: %s\n", formatSize(memoryPeak))
+	}
+
+	if verdict := jobVerdict(job, unitState(job, info)); verdict != "" {
+		if job.VerdictReason.Valid {
+			verdict += " (" + job.VerdictReason.String + ")"
+		}
+		fmt.Printf("Verdict:     %s\n", verdict)
+	}
+	if rules := jobSuccessRules(job); rules != nil {
+		fmt.Printf("Success if:  %s\n", formatSuccessRules(rules))
+	}
+
+	if job.StopResult.Valid {
+		fmt.Printf("Stop:        %s\n", job.StopResult.String)
+	}
+
+	// Events explain what jr did to the job on its own, such as stopping
+	// it for exceeding a log limit
+	events, err := db.ListJobEvents(job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	for _, e := range events {
+		fmt.Printf("Event:       %s %s: %s\n", e.AtUTC, e.Kind, e.Message)
+	}
+
+	if job.CkptSignal.Valid {
+		ckpt := job.CkptSignal.String
+		if job.CkptPath.Valid {
+			ckpt += " -> " + job.CkptPath.String
+		}
+		if job.LastCkptAtUTC.Valid {
+			ckpt += " (last " + job.LastCkptAtUTC.String + ")"
+		}
+		fmt.Printf("Checkpoint:  %s\n", ckpt)
 	}
 
 	fmt.Printf("Working Dir: %s\n", job.Cwd)
 
+	if snapshot := jobSnapshot(job); snapshot != nil {
+		if snapshot.GitCommit != "" {
+			fmt.Printf("Git:         %s\n", formatGitSnapshot(job, snapshot))
+		}
+		if snapshot.Executable != "" {
+			exe := snapshot.Executable
+			if snapshot.ExecutableSHA256 != "" {
+				exe += " (sha256 " + snapshot.ExecutableSHA256[:12] + ")"
+			}
+			fmt.Printf("Executable:  %s\n", exe)
+		}
+	}
+
+	if rules := jobArtifactRules(job); rules != nil {
+		fmt.Printf("Artifacts:   %s\n", formatArtifacts(job, rules))
+	}
+
+	if job.LogFile.Valid {
+		fmt.Printf("Log file:    %s\n", job.LogFile.String)
+	}
+	if job.ErrLogFile.Valid {
+		fmt.Printf("Stderr log:  %s\n", job.ErrLogFile.String)
+	}
+
 	var argv []string
 	if job.ArgvJSON != "" {
 		if err := json.Unmarshal([]byte(job.ArgvJSON), &argv); err != nil {
@@ -85,6 +188,21 @@ func outputStatusHuman(job *db.Job, info *systemd.UnitInfo) error {
 		}
 	}
 
+	if job.ParamsJSON.Valid && job.ParamsJSON.String != "" {
+		var params map[string]string
+		if err := json.Unmarshal([]byte(job.ParamsJSON.String), &params); err == nil && len(params) > 0 {
+			fmt.Printf("Params:      %s\n", formatParams(params))
+		}
+	}
+
+	if job.GroupName.Valid {
+		fmt.Printf("Group:       %s\n", job.GroupName.String)
+	}
+
+	if tags := jobTags(job); len(tags) > 0 {
+		fmt.Printf("Tags:        %s\n", strings.Join(tags, ", "))
+	}
+
 	if job.Host.Valid {
 		fmt.Printf("Host:        %s\n", job.Host.String)
 	}
@@ -95,13 +213,13 @@ func outputStatusHuman(job *db.Job, info *systemd.UnitInfo) error {
 	return nil
 }
 
-func outputStatusJSON(job *db.Job, info *systemd.UnitInfo) error {
+func statusJSONOutput(job *db.Job, info *systemd.UnitInfo) map[string]interface{} {
 	output := map[string]interface{}{
 		"id":          job.ID,
 		"name":        job.Name,
 		"unit":        job.Unit,
 		"created":     job.CreatedAtUTC,
-		"state":       systemd.GetStateString(info),
+		"state":       unitState(job, info),
 		"activeState": info.ActiveState,
 		"subState":    info.SubState,
 		"pid":         info.ExecMainPID,
@@ -119,15 +237,36 @@ func outputStatusJSON(job *db.Job, info *systemd.UnitInfo) error {
 	var env map[string]string
 	if job.EnvJSON != "" {
 		if err := json.Unmarshal([]byte(job.EnvJSON), &env); err == nil {
-			output["env"] = env
+			output["env"] = cfg.Env.Redact(env)
 		}
 	}
 
+	if job.ParamsJSON.Valid && job.ParamsJSON.String != "" {
+		var params map[string]string
+		if err := json.Unmarshal([]byte(job.ParamsJSON.String), &params); err == nil {
+			output["params"] = params
+		}
+	}
+
+	if info.Gone() && job.ExitStatus.Valid {
+		output["exitCode"] = job.ExitStatus.String
+	}
 	if info.ExecMainStartTimestamp != "" {
 		output["started"] = info.ExecMainStartTimestamp
+	} else if job.StartedAtUTC.Valid {
+		output["started"] = job.StartedAtUTC.String
 	}
 	if info.ExecMainExitTimestamp != "" {
 		output["exited"] = info.ExecMainExitTimestamp
+	} else if job.FinishedAtUTC.Valid {
+		output["exited"] = job.FinishedAtUTC.String
+	}
+	cpuUsage, memoryPeak := jobUsage(job, info)
+	if cpuUsage > 0 {
+		output["cpuUsageNSec"] = cpuUsage.Nanoseconds()
+	}
+	if memoryPeak > 0 {
+		output["memoryPeak"] = memoryPeak
 	}
 	if job.Host.Valid {
 		output["host"] = job.Host.String
@@ -135,10 +274,64 @@ func outputStatusJSON(job *db.Job, info *systemd.UnitInfo) error {
 	if job.User.Valid {
 		output["user"] = job.User.String
 	}
+	if job.GroupName.Valid {
+		output["group"] = job.GroupName.String
+	}
+	if tags := jobTags(job); len(tags) > 0 {
+		output["tags"] = tags
+	}
+	if job.StopSignal.Valid {
+		output["stopSignal"] = job.StopSignal.String
+		output["stopTimeout"] = job.StopTimeout.String
+	}
+	if job.StopResult.Valid {
+		output["stopResult"] = job.StopResult.String
+	}
+	if verdict := jobVerdict(job, unitState(job, info)); verdict != "" {
+		output["verdict"] = verdict
+		if job.VerdictReason.Valid {
+			output["verdictReason"] = job.VerdictReason.String
+		}
+	}
+	if rules := jobSuccessRules(job); rules != nil {
+		output["successRules"] = rules
+	}
+	if snapshot := jobSnapshot(job); snapshot != nil {
+		output["snapshot"] = snapshot
+	}
+	if rules := jobArtifactRules(job); rules != nil {
+		output["artifactRules"] = rules
+		if job.ArtifactsAtUTC.Valid {
+			output["artifactsRecorded"] = job.ArtifactsAtUTC.String
+		}
+	}
+	if job.PausedAtUTC.Valid {
+		output["pausedAt"] = job.PausedAtUTC.String
+	}
+	if job.CkptSignal.Valid {
+		output["checkpointSignal"] = job.CkptSignal.String
+	}
+	if job.CkptPath.Valid {
+		output["checkpointPath"] = job.CkptPath.String
+	}
+	if job.LastCkptAtUTC.Valid {
+		output["lastCheckpoint"] = job.LastCkptAtUTC.String
+	}
+	if job.LogFile.Valid {
+		output["logFile"] = job.LogFile.String
+	}
+	if job.ErrLogFile.Valid {
+		output["errLogFile"] = job.ErrLogFile.String
+	}
+	if events, err := db.ListJobEvents(job.ID); err == nil && len(events) > 0 {
+		list := make([]map[string]string, len(events))
+		for i, e := range events {
+			list[i] = map[string]string{"at": e.AtUTC, "kind": e.Kind, "message": e.Message}
+		}
+		output["events"] = list
+	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	return enc.Encode(output)
+	return output
 }
 
 func formatArgv(argv []string) string {
@@ -156,6 +349,21 @@ func formatArgv(argv []string) string {
 	return result
 }
 
+// formatParams renders params as sorted key=value pairs.
+func formatParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + params[k]
+	}
+	return strings.Join(pairs, " ")
+}
+
 func containsSpace(s string) bool {
 	for _, r := range s {
 		if r == ' ' || r == '\t' || r == '\n' {
@@ -164,3 +372,27 @@ func containsSpace(s string) bool {
 	}
 	return false
 }
+
+// jobUsage returns the CPU time and peak memory job has used: live from
+// its unit while systemd still has it, else as recorded when it finished.
+// Zero values are unknown.
+func jobUsage(job *db.Job, info *systemd.UnitInfo) (time.Duration, int64) {
+	cpuUsage := time.Duration(systemd.ParseAccounting(info.CPUUsageNSec))
+	if cpuUsage == 0 {
+		cpuUsage = time.Duration(job.CPUUsageNSec.Int64)
+	}
+	memoryPeak := systemd.ParseAccounting(info.MemoryPeak)
+	if memoryPeak == 0 {
+		memoryPeak = job.MemoryPeak.Int64
+	}
+	return cpuUsage, memoryPeak
+}
+
+// roundDuration rounds d for display: to the second, or to the millisecond
+// under a minute.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
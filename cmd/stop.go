@@ -3,48 +3,298 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/user/jr/db"
 	"github.com/user/jr/systemd"
 )
 
-var stopSignal string
+var (
+	stopSignal     string
+	stopTimeout    string
+	stopCheckpoint bool
+	stopSelector   jobSelector
+)
+
+// systemd's defaults for services without KillSignal= or TimeoutStopSec=.
+const (
+	defaultStopSignal  = "SIGTERM"
+	defaultStopTimeout = 90 * time.Second
+)
+
+// How long to wait after escalating to SIGTERM and to SIGKILL, and how
+// often to check whether stopping jobs have exited.
+const (
+	stopTermGrace    = 10 * time.Second
+	stopKillGrace    = 5 * time.Second
+	stopPollInterval = 500 * time.Millisecond
+)
 
 var stopCmd = &cobra.Command{
-	Use:   "stop <id|unit>",
-	Short: "Stop a running job",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runStop,
+	Use:   "stop <job|range>... [flags]",
+	Short: "Stop running jobs",
+	Long: `Stop running jobs gracefully, escalating if they do not exit in time.
+
+Each job is sent its stop signal, then given up to its stop timeout to
+exit. A job still running is sent SIGTERM, and finally SIGKILL. The signal
+and timeout default to the KillSignal= and TimeoutStopSec= properties the
+job was started with (SIGTERM and 90s unless set), and can be overridden
+with --signal and --timeout.`,
+	RunE: runStop,
 }
 
 func init() {
-	stopCmd.Flags().StringVarP(&stopSignal, "signal", "s", "", "signal to send before stopping (e.g., SIGTERM, SIGINT)")
+	stopCmd.Flags().StringVarP(&stopSignal, "signal", "s", "", "signal asking the job to exit (default: the job's KillSignal)")
+	stopCmd.Flags().StringVarP(&stopTimeout, "timeout", "t", "", "time to wait before escalating, e.g. 30s, 5min, infinity (default: the job's TimeoutStopSec)")
+	stopCmd.Flags().BoolVar(&stopCheckpoint, "checkpoint", false, "have jobs save a checkpoint first (see jr checkpoint); jobs that fail to are not stopped")
+	addSelectorFlags(stopCmd, &stopSelector)
+	addBulkFlags(stopCmd, &stopSelector)
+	registerSelectorCompletions(stopCmd, isActiveState)
+	stopCmd.RegisterFlagCompletionFunc("signal", fixedCompletions(signalNames))
 }
 
-func runStop(cmd *cobra.Command, args []string) error {
-	job, err := db.FindJobByPartial(args[0])
-	if err != nil {
-		return fmt.Errorf("failed to find job: %w", err)
+// stopPolicy returns the stop signal and timeout recorded for a job started
+// with props.
+func stopPolicy(props map[string]string) (signal, timeout string) {
+	signal = defaultStopSignal
+	if s := props["KillSignal"]; s != "" {
+		signal = s
+	}
+
+	timeout = defaultStopTimeout.String()
+	if d, err := systemd.ParseTimespan(props["TimeoutStopSec"]); err == nil {
+		timeout = formatStopTimeout(d)
 	}
-	if job == nil {
-		return fmt.Errorf("job not found: %s", args[0])
+	return signal, timeout
+}
+
+func formatStopTimeout(d time.Duration) string {
+	if d == 0 {
+		return "infinity"
 	}
+	return d.String()
+}
 
+// stopping tracks a job through the stop sequence.
+type stopping struct {
+	job     *db.Job
+	signal  string
+	timeout time.Duration
+	// sent is the last signal sent; deadline is when to escalate next, or
+	// zero to wait indefinitely.
+	sent      string
+	escalated bool
+	started   time.Time
+	deadline  time.Time
+}
+
+func newStopping(job *db.Job) (*stopping, error) {
+	st := &stopping{job: job, signal: defaultStopSignal, timeout: defaultStopTimeout}
+
+	if job.StopSignal.Valid && job.StopSignal.String != "" {
+		st.signal = job.StopSignal.String
+	}
 	if stopSignal != "" {
-		if err := systemd.KillUnit(job.Unit, stopSignal); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to send signal: %v\n", err)
+		st.signal = stopSignal
+	}
+
+	timeout := job.StopTimeout.String
+	if stopTimeout != "" {
+		timeout = stopTimeout
+	}
+	if timeout != "" {
+		d, err := systemd.ParseTimespan(timeout)
+		if err != nil {
+			return nil, err
 		}
+		st.timeout = d
 	}
 
-	if err := systemd.StopUnit(job.Unit); err != nil {
-		return fmt.Errorf("failed to stop unit: %w", err)
+	return st, nil
+}
+
+func (st *stopping) send(signal string, wait time.Duration) error {
+	if err := systemd.KillUnit(st.job.Unit, signal); err != nil {
+		return fmt.Errorf("failed to send %s: %w", signal, err)
+	}
+	st.sent = signal
+	st.deadline = time.Time{}
+	if wait > 0 {
+		st.deadline = time.Now().Add(wait)
+	}
+	return nil
+}
+
+// escalate moves to the next step after the current one timed out. It
+// returns true once nothing is left but to have systemd stop the unit.
+func (st *stopping) escalate() (bool, error) {
+	st.escalated = true
+	switch st.sent {
+	case "SIGKILL":
+		return true, nil
+	case "SIGTERM":
+		return false, st.send("SIGKILL", stopKillGrace)
+	default:
+		return false, st.send("SIGTERM", stopTermGrace)
 	}
+}
+
+func runStop(cmd *cobra.Command, args []string) error {
+	jobs, infos, err := stopSelector.selectJobs(args)
+	if err != nil {
+		return err
+	}
+
+	ok, err := stopSelector.confirmBulk("stop", jobs)
+	if err != nil || !ok {
+		return err
+	}
+
+	var failed int
+	var pending []*stopping
+	for _, job := range jobs {
+		st, err := newStopping(job)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+
+		state := jobState(job, infos)
+		if !isActiveState(state) {
+			fmt.Printf("%d %s had already exited\n", job.ID, job.Unit)
+			continue
+		}
+
+		// A paused job cannot react to its stop signal, and its stop
+		// timeout should only start once it can
+		if state == "paused" {
+			if err := resumeJob(job); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+				failed++
+				continue
+			}
+		}
+
+		if stopCheckpoint {
+			if err := checkpointJob(job, "", "", defaultCheckpointTimeout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %d %s: %v; not stopping\n", job.ID, job.Unit, err)
+				failed++
+				continue
+			}
+		}
+
+		st.started = time.Now()
+		if err := st.send(st.signal, st.timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", job.ID, job.Unit, err)
+			failed++
+			continue
+		}
 
-	if err := db.UpdateJobState(job.ID, "stopped"); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to update job state: %v\n", err)
+		wait := "indefinitely"
+		if st.timeout > 0 {
+			wait = "up to " + st.timeout.String()
+		}
+		fmt.Printf("Sent %s to %d %s, waiting %s\n", st.signal, job.ID, job.Unit, wait)
+		pending = append(pending, st)
 	}
 
-	fmt.Printf("Stopped %d %s\n", job.ID, job.Unit)
+	failed += waitForStops(pending)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d of %d jobs", failed, len(jobs))
+	}
 	return nil
 }
+
+// waitForStops polls the stopping jobs until all have exited, escalating
+// those that outlive their deadline. It returns the number of failures.
+func waitForStops(pending []*stopping) int {
+	progress := isTerminal()
+	clearProgress := func() {
+		if progress {
+			fmt.Print("\r\033[K")
+		}
+	}
+
+	var failed int
+	for len(pending) > 0 {
+		time.Sleep(stopPollInterval)
+
+		units := make([]string, len(pending))
+		for i, st := range pending {
+			units[i] = st.job.Unit
+		}
+		infos, err := systemd.ShowUnits(units)
+		if err != nil {
+			continue
+		}
+
+		var remaining []*stopping
+		for _, st := range pending {
+			info := infos[st.job.Unit]
+			if info == nil || info.Gone() || !isActiveState(systemd.GetStateString(info)) {
+				clearProgress()
+				finishStop(st)
+				continue
+			}
+
+			if !st.deadline.IsZero() && time.Now().After(st.deadline) {
+				prev := st.sent
+				done, err := st.escalate()
+				clearProgress()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %d %s: %v\n", st.job.ID, st.job.Unit, err)
+					failed++
+					continue
+				}
+				if done {
+					// Leave the rest to systemd, which also cleans up
+					// processes that ignore SIGKILL while in D state
+					if err := systemd.StopUnit(st.job.Unit); err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %d %s: failed to stop unit: %v\n", st.job.ID, st.job.Unit, err)
+						failed++
+						continue
+					}
+					finishStop(st)
+					continue
+				}
+				fmt.Printf("%d %s still running after %s, sent %s\n",
+					st.job.ID, st.job.Unit, prev, st.sent)
+			}
+
+			remaining = append(remaining, st)
+		}
+		pending = remaining
+
+		if progress && len(pending) > 0 {
+			fmt.Printf("\rWaiting for %d job(s) to exit (%s)", len(pending),
+				time.Since(pending[0].started).Round(time.Second))
+		}
+	}
+
+	return failed
+}
+
+func finishStop(st *stopping) {
+	elapsed := time.Since(st.started).Round(time.Second)
+	if !st.escalated {
+		fmt.Printf("Stopped %d %s (exited after %s in %s)\n", st.job.ID, st.job.Unit, st.signal, elapsed)
+		recordStop(st.job, "graceful")
+		return
+	}
+	fmt.Printf("Killed %d %s (did not exit within %s of %s)\n", st.job.ID, st.job.Unit, st.timeout, st.signal)
+	recordStop(st.job, "killed")
+}
+
+// recordStop records how job was stopped, and that it failed: the finish
+// hook has seen a job that exited on its stop signal as a success. Its
+// state is left alone, so the job's exit status and times are still
+// recorded as for any other job that finished.
+func recordStop(job *db.Job, result string) {
+	if err := db.SetJobStopResult(job.ID, result); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record stop result: %v\n", err)
+	}
+	if err := db.SetJobVerdict(job.ID, verdictFailure, "stopped by jr stop ("+result+")"); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record verdict: %v\n", err)
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/user/jr/db"
+)
+
+func TestStopPolicy(t *testing.T) {
+	tests := []struct {
+		props   map[string]string
+		signal  string
+		timeout string
+	}{
+		{nil, "SIGTERM", "1m30s"},
+		{map[string]string{"KillSignal": "SIGINT", "TimeoutStopSec": "30"}, "SIGINT", "30s"},
+		{map[string]string{"TimeoutStopSec": "5min"}, "SIGTERM", "5m0s"},
+		{map[string]string{"TimeoutStopSec": "infinity"}, "SIGTERM", "infinity"},
+	}
+
+	for _, tt := range tests {
+		signal, timeout := stopPolicy(tt.props)
+		if signal != tt.signal || timeout != tt.timeout {
+			t.Errorf("stopPolicy(%v) = %s, %s, want %s, %s", tt.props, signal, timeout, tt.signal, tt.timeout)
+		}
+	}
+}
+
+func TestNewStopping(t *testing.T) {
+	defer func() { stopSignal, stopTimeout = "", "" }()
+
+	job := &db.Job{
+		StopSignal:  sql.NullString{String: "SIGINT", Valid: true},
+		StopTimeout: sql.NullString{String: "30s", Valid: true},
+	}
+
+	st, err := newStopping(job)
+	if err != nil {
+		t.Fatalf("newStopping() error = %v", err)
+	}
+	if st.signal != "SIGINT" || st.timeout != 30*time.Second {
+		t.Errorf("Expected the job's policy, got %s %v", st.signal, st.timeout)
+	}
+
+	stopSignal, stopTimeout = "SIGUSR1", "infinity"
+	st, err = newStopping(job)
+	if err != nil {
+		t.Fatalf("newStopping() error = %v", err)
+	}
+	if st.signal != "SIGUSR1" || st.timeout != 0 {
+		t.Errorf("Expected flags to override, got %s %v", st.signal, st.timeout)
+	}
+
+	stopTimeout = "soon"
+	if _, err := newStopping(job); err == nil {
+		t.Error("Expected an invalid timeout to fail")
+	}
+}
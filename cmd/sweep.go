@@ -0,0 +1,426 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/config"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	sweepParams        []string
+	sweepName          string
+	sweepGroup         string
+	sweepCwd           string
+	sweepEnv           []string
+	sweepProperties    []string
+	sweepProfile       string
+	sweepMaxConcurrent int
+	sweepDryRun        bool
+	sweepNoInheritEnv  bool
+	sweepStatusJSON    bool
+)
+
+// sweepPollInterval is how often a throttled sweep checks for free slots.
+const sweepPollInterval = 5 * time.Second
+
+var sweepCmd = &cobra.Command{
+	Use:   "sweep --param k=v1,v2 [--param k=1..5] [flags] -- <command> [args...]",
+	Short: "Launch a job for every combination of parameter values",
+	Long: `Launch one job per combination (Cartesian product) of the --param values.
+Occurrences of {name} in the command and in --env values are replaced by the
+variant's value. All variants share a group, summarized by 'jr sweep status'.
+
+Values are comma-separated lists (lr=0.1,0.01) or inclusive integer ranges
+(seed=1..5). With --max-concurrent, jr stays in the foreground and launches
+the next variant as soon as a slot frees up.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("requires a command to run")
+		}
+		return nil
+	},
+	RunE: runSweep,
+}
+
+var sweepStatusCmd = &cobra.Command{
+	Use:   "status <group>",
+	Short: "Summarize the jobs of a sweep",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSweepStatus,
+}
+
+func init() {
+	sweepCmd.Flags().StringArrayVar(&sweepParams, "param", nil, "parameter values (repeatable, format: k=v1,v2 or k=1..5)")
+	sweepCmd.Flags().StringVarP(&sweepName, "name", "n", "", "logical name for every variant (default: derived from command)")
+	sweepCmd.Flags().StringVar(&sweepGroup, "group", "", "group name (default: <name>-<timestamp>)")
+	sweepCmd.Flags().StringVar(&sweepCwd, "cwd", "", "working directory (default: current)")
+	sweepCmd.Flags().StringArrayVarP(&sweepEnv, "env", "e", nil, "environment variables (repeatable, format: K=V)")
+	sweepCmd.Flags().StringArrayVar(&sweepProperties, "property", nil, "pass -p k=v to systemd-run (repeatable)")
+	sweepCmd.Flags().StringVarP(&sweepProfile, "profile", "P", "", "apply a named profile from the config file")
+	sweepCmd.Flags().IntVarP(&sweepMaxConcurrent, "max-concurrent", "j", 0, "run at most N variants at once (0: no limit)")
+	sweepCmd.Flags().BoolVar(&sweepNoInheritEnv, "no-inherit-env", false, "do not capture the current environment")
+	sweepCmd.Flags().BoolVar(&sweepDryRun, "dry-run", false, "print the variants without launching them")
+
+	sweepStatusCmd.Flags().BoolVar(&sweepStatusJSON, "json", false, "output as JSON")
+
+	sweepCmd.AddCommand(sweepStatusCmd)
+
+	sweepCmd.RegisterFlagCompletionFunc("property", completeProperties)
+	sweepCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	sweepStatusCmd.ValidArgsFunction = completeSweepGroup
+}
+
+// sweepParam is one --param with its expanded values.
+type sweepParam struct {
+	Name   string
+	Values []string
+}
+
+func parseSweepParam(s string) (sweepParam, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return sweepParam{}, fmt.Errorf("invalid param format: %s (expected k=v1,v2 or k=1..5)", s)
+	}
+
+	p := sweepParam{Name: parts[0]}
+	for _, item := range strings.Split(parts[1], ",") {
+		if lo, hi, ok := strings.Cut(item, ".."); ok {
+			start, err1 := strconv.Atoi(lo)
+			end, err2 := strconv.Atoi(hi)
+			if err1 != nil || err2 != nil || end < start {
+				return sweepParam{}, fmt.Errorf("invalid range in param %s: %s", p.Name, item)
+			}
+			for i := start; i <= end; i++ {
+				p.Values = append(p.Values, strconv.Itoa(i))
+			}
+			continue
+		}
+		p.Values = append(p.Values, item)
+	}
+
+	return p, nil
+}
+
+// sweepVariants returns the Cartesian product of params, varying the last
+// parameter fastest.
+func sweepVariants(params []sweepParam) []map[string]string {
+	variants := []map[string]string{{}}
+	for _, p := range params {
+		var next []map[string]string
+		for _, base := range variants {
+			for _, v := range p.Values {
+				variant := make(map[string]string, len(base)+1)
+				for k, bv := range base {
+					variant[k] = bv
+				}
+				variant[p.Name] = v
+				next = append(next, variant)
+			}
+		}
+		variants = next
+	}
+	return variants
+}
+
+var sweepPlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteSweep replaces {name} placeholders that name a parameter; other
+// braces (such as awk programs) are left untouched.
+func substituteSweep(s string, values map[string]string) string {
+	return sweepPlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := values[m[1:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// sweepRecordedParams returns the values of a variant as its job records
+// them, with parameters that fill in a secret variable of envFlags redacted.
+func sweepRecordedParams(values map[string]string, envFlags []string) map[string]string {
+	env := make(map[string]string, len(envFlags))
+	for _, e := range envFlags {
+		if k, v, ok := strings.Cut(e, "="); ok {
+			env[k] = v
+		}
+	}
+	return redactParams(values, env, func(s string) []string {
+		var names []string
+		for _, m := range sweepPlaceholder.FindAllStringSubmatch(s, -1) {
+			names = append(names, m[1])
+		}
+		return names
+	})
+}
+
+func runSweep(cmd *cobra.Command, args []string) error {
+	if len(sweepParams) == 0 {
+		return fmt.Errorf("at least one --param is required")
+	}
+
+	var params []sweepParam
+	seen := make(map[string]bool)
+	for _, s := range sweepParams {
+		p, err := parseSweepParam(s)
+		if err != nil {
+			return err
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("param %s given more than once", p.Name)
+		}
+		seen[p.Name] = true
+		params = append(params, p)
+	}
+
+	// Catch typos: every parameter must be used somewhere
+	used := make(map[string]bool)
+	for _, s := range append(append([]string{}, args...), sweepEnv...) {
+		for _, m := range sweepPlaceholder.FindAllStringSubmatch(s, -1) {
+			used[m[1]] = true
+		}
+	}
+	for _, p := range params {
+		if !used[p.Name] {
+			return fmt.Errorf("param %s is not used in the command (add {%s})", p.Name, p.Name)
+		}
+	}
+
+	var profile config.Profile
+	if sweepProfile != "" {
+		var err error
+		profile, err = cfg.Profile(sweepProfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	name := sweepName
+	if name == "" {
+		name = filepath.Base(args[0])
+	}
+
+	group := sweepGroup
+	if group == "" {
+		group = fmt.Sprintf("%s-%s", name, time.Now().Format("20060102-150405"))
+	}
+
+	cwd := sweepCwd
+	if cwd == "" {
+		var err error
+		cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	variants := sweepVariants(params)
+
+	if sweepDryRun {
+		for i, values := range variants {
+			argv := make([]string, len(args))
+			for j, arg := range args {
+				argv[j] = substituteSweep(arg, values)
+			}
+			fmt.Printf("%d\t%s\t%s\n", i+1, formatParams(sweepRecordedParams(values, sweepEnv)), formatArgv(argv))
+		}
+		fmt.Printf("Would launch %d jobs in group %s\n", len(variants), group)
+		return nil
+	}
+
+	if cfg.Defaults.LingerCheck {
+		warnIfNotLingering()
+	}
+
+	var launched []string
+	for i, values := range variants {
+		if sweepMaxConcurrent > 0 {
+			if err := waitForSweepSlot(launched, sweepMaxConcurrent); err != nil {
+				return err
+			}
+		}
+
+		argv := make([]string, len(args))
+		for j, arg := range args {
+			argv[j] = substituteSweep(arg, values)
+		}
+
+		envFlags := make([]string, len(sweepEnv))
+		for j, e := range sweepEnv {
+			envFlags[j] = substituteSweep(e, values)
+		}
+
+		env, props, err := runEnvAndProps(profile, !sweepNoInheritEnv, envFlags, "", sweepProperties)
+		if err != nil {
+			return err
+		}
+		recorded := sweepRecordedParams(values, sweepEnv)
+
+		spec := &jobSpec{
+			Name:          name,
+			Cwd:           cwd,
+			Argv:          argv,
+			Env:           env,
+			Props:         props,
+			Params:        recorded,
+			Group:         group,
+			NotifyCommand: profile.NotifyCommand,
+			NotifyOn:      profile.NotifyOn,
+			Snapshot:      cfg.Defaults.Snapshot,
+		}
+
+		id, err := launchJob(spec)
+		if err != nil {
+			return fmt.Errorf("variant %d/%d (%s): %w", i+1, len(variants), formatParams(recorded), err)
+		}
+		launched = append(launched, spec.Unit)
+
+		fmt.Printf("Started %d %s (%s)\n", id, spec.Unit, formatParams(recorded))
+	}
+
+	fmt.Printf("Launched %d jobs in group %s\n", len(variants), group)
+	fmt.Printf("Check progress: jr sweep status %s\n", group)
+	return nil
+}
+
+// waitForSweepSlot blocks until fewer than max of units are running.
+func waitForSweepSlot(units []string, max int) error {
+	for {
+		if len(units) < max {
+			return nil
+		}
+
+		infos, err := systemd.ShowUnits(units)
+		if err != nil {
+			return fmt.Errorf("failed to query running variants: %w", err)
+		}
+
+		running := 0
+		for _, info := range infos {
+			if holdsSweepSlot(info) {
+				running++
+			}
+		}
+		if running < max {
+			return nil
+		}
+
+		time.Sleep(sweepPollInterval)
+	}
+}
+
+// holdsSweepSlot reports whether a variant's unit counts toward
+// --max-concurrent: any state but inactive, failed or gone, so units still
+// activating, reloading or deactivating count too.
+func holdsSweepSlot(info *systemd.UnitInfo) bool {
+	switch info.ActiveState {
+	case "", "inactive", "failed":
+		return false
+	}
+	return !info.Gone()
+}
+
+// sweepSummary counts the jobs of a group by outcome.
+type sweepSummary struct {
+	Total     int `json:"total"`
+	Running   int `json:"running"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Other     int `json:"other"`
+}
+
+func (s *sweepSummary) add(state string) {
+	s.Total++
+	switch state {
+	case "active", "activating", "paused", "stalled":
+		s.Running++
+	case "exited":
+		s.Succeeded++
+	case "failed":
+		s.Failed++
+	default:
+		s.Other++
+	}
+}
+
+func runSweepStatus(cmd *cobra.Command, args []string) error {
+	group := args[0]
+
+	jobs, err := db.ListJobsByGroup(group)
+	if err != nil {
+		return fmt.Errorf("failed to list group: %w", err)
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("group not found: %s", group)
+	}
+
+	units := make([]string, len(jobs))
+	for i, job := range jobs {
+		units[i] = job.Unit
+	}
+
+	unitInfos, err := systemd.ShowUnits(units)
+	if err != nil {
+		unitInfos = make(map[string]*systemd.UnitInfo)
+	}
+
+	type variantOutput struct {
+		ID     int64             `json:"id"`
+		State  string            `json:"state"`
+		Params map[string]string `json:"params"`
+		Unit   string            `json:"unit"`
+	}
+
+	var summary sweepSummary
+	var variants []variantOutput
+	for _, job := range jobs {
+		state := verdictState(job, jobState(job, unitInfos))
+		summary.add(state)
+
+		var params map[string]string
+		if job.ParamsJSON.Valid && job.ParamsJSON.String != "" {
+			json.Unmarshal([]byte(job.ParamsJSON.String), &params)
+		}
+
+		variants = append(variants, variantOutput{ID: job.ID, State: state, Params: params, Unit: job.Unit})
+	}
+
+	if sweepStatusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{
+			"group":   group,
+			"summary": summary,
+			"jobs":    variants,
+		})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tPARAMS")
+	for _, v := range variants {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", v.ID, colorState(v.State), formatParams(v.Params))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("%s: %d jobs, %d succeeded, %d failed, %d running",
+		group, summary.Total, summary.Succeeded, summary.Failed, summary.Running)
+	if summary.Other > 0 {
+		fmt.Printf(", %d other", summary.Other)
+	}
+	fmt.Println()
+
+	return nil
+}
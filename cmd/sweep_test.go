@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/jr/systemd"
+)
+
+func TestParseSweepParam(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected sweepParam
+		wantErr  bool
+	}{
+		{"lr=0.1,0.01", sweepParam{"lr", []string{"0.1", "0.01"}}, false},
+		{"seed=1..3", sweepParam{"seed", []string{"1", "2", "3"}}, false},
+		{"seed=1..2,7", sweepParam{"seed", []string{"1", "2", "7"}}, false},
+		{"opt=adam", sweepParam{"opt", []string{"adam"}}, false},
+		{"seed=5..1", sweepParam{}, true},
+		{"seed=a..b", sweepParam{}, true},
+		{"lr", sweepParam{}, true},
+		{"lr=", sweepParam{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := parseSweepParam(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSweepParam(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseSweepParam(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSweepVariants(t *testing.T) {
+	variants := sweepVariants([]sweepParam{
+		{"lr", []string{"0.1", "0.01"}},
+		{"seed", []string{"1", "2", "3"}},
+	})
+
+	if len(variants) != 6 {
+		t.Fatalf("Expected 6 variants, got %d", len(variants))
+	}
+
+	expected := map[string]string{"lr": "0.1", "seed": "2"}
+	if !reflect.DeepEqual(variants[1], expected) {
+		t.Errorf("variants[1] = %v, want %v", variants[1], expected)
+	}
+}
+
+func TestSubstituteSweep(t *testing.T) {
+	values := map[string]string{"lr": "0.1", "seed": "3"}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"--lr={lr}", "--lr=0.1"},
+		{"run-{seed}-{lr}", "run-3-0.1"},
+		{"{print $1}", "{print $1}"},
+		{"{other}", "{other}"},
+	}
+
+	for _, tt := range tests {
+		if result := substituteSweep(tt.input, values); result != tt.expected {
+			t.Errorf("substituteSweep(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestHoldsSweepSlot(t *testing.T) {
+	tests := []struct {
+		info     systemd.UnitInfo
+		expected bool
+	}{
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "active"}, true},
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "activating"}, true},
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "reloading"}, true},
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "deactivating"}, true},
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "inactive"}, false},
+		{systemd.UnitInfo{LoadState: "loaded", ActiveState: "failed"}, false},
+		{systemd.UnitInfo{LoadState: "not-found", ActiveState: "inactive"}, false},
+	}
+
+	for _, tt := range tests {
+		if result := holdsSweepSlot(&tt.info); result != tt.expected {
+			t.Errorf("holdsSweepSlot(%s) = %v, want %v", tt.info.ActiveState, result, tt.expected)
+		}
+	}
+}
+
+func TestSweepRecordedParams(t *testing.T) {
+	envFlags := []string{"API_TOKEN=tok-{token}", "SEED={seed}", "PLAIN"}
+	got := sweepRecordedParams(map[string]string{"token": "hunter2", "seed": "3"}, envFlags)
+	want := map[string]string{"token": "<redacted>", "seed": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sweepRecordedParams() = %v, want %v", got, want)
+	}
+}
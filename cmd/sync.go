@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var syncDryRun bool
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [flags]",
+	Short: "Reconcile the job database with systemd",
+	Long: `Bring the job database in line with the units systemd knows about.
+
+Units named jr-*.service that have no job are adopted: their command,
+working directory and environment are recovered from the unit. Jobs record
+their own outcome as they finish; those that could not, such as adopted
+units or jobs with an ExecStopPost= of their own, get their final state,
+exit status and resource usage recorded here, looking in the journal for
+units systemd has already garbage-collected. Processes adopted into a
+scope have no exit status: their job is recorded as exited once the scope
+is gone.
+
+Set auto_sync = true in [defaults] to have 'jr list' and 'jr stats' do
+the same without the journal lookups.`,
+	Args: cobra.NoArgs,
+	RunE: runSync,
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "report discrepancies without changing the database")
+}
+
+// syncChange is a job whose final state a sync recorded (or would record).
+type syncChange struct {
+	Job        *db.Job
+	State      string
+	ExitStatus string
+}
+
+// syncReport lists the discrepancies found by reconcile.
+type syncReport struct {
+	Adopted []*db.Job
+	Settled []syncChange
+	// Lost are jobs whose unit vanished without a verdict in the journal.
+	Lost    []*db.Job
+	Skipped []string
+}
+
+// states returns the final state of each job the report settled or lost,
+// by job id.
+func (r *syncReport) states() map[int64]string {
+	states := make(map[int64]string, len(r.Settled)+len(r.Lost))
+	for _, c := range r.Settled {
+		states[c.Job.ID] = c.State
+	}
+	for _, job := range r.Lost {
+		states[job.ID] = "unknown"
+	}
+	return states
+}
+
+// reconcile adopts unknown jr units and records the final state of finished
+// jobs. A light reconcile skips the journal, leaving jobs whose unit has
+// been garbage-collected for a full sync.
+func reconcile(light, dryRun bool) (*syncReport, error) {
+	report := &syncReport{}
+
+	units, err := systemd.ListJobUnits()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list units: %w", err)
+	}
+
+	for _, unit := range units {
+		if systemd.IsHelperUnit(unit) {
+			continue
+		}
+		known, err := db.GetJobByUnit(unit)
+		if err != nil {
+			return nil, err
+		}
+		if known != nil {
+			continue
+		}
+
+		job, err := adoptUnit(unit, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("failed to adopt %s: %w", unit, err)
+		}
+		if job == nil {
+			report.Skipped = append(report.Skipped, unit)
+			continue
+		}
+		report.Adopted = append(report.Adopted, job)
+	}
+
+	jobs, err := db.ListUnsettledJobs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	infos := showJobUnits(jobs)
+	for _, job := range jobs {
+		info := infos[job.Unit]
+		if info == nil {
+			continue
+		}
+
+		if !info.Gone() {
+			state := unitState(job, info)
+			if state != "exited" && state != "failed" {
+				if !dryRun && job.LastKnownState.String != state {
+					db.UpdateJobState(job.ID, state)
+				}
+				continue
+			}
+
+			change := syncChange{Job: job, State: state, ExitStatus: info.ExecMainStatus}
+			if !dryRun {
+				err := db.RecordJobOutcome(job.ID, state, info.ExecMainStatus,
+					utcTimestamp(info.ExecMainStartTimestamp), utcTimestamp(info.ExecMainExitTimestamp))
+				if err != nil {
+					return nil, err
+				}
+				cpuUsage := time.Duration(systemd.ParseAccounting(info.CPUUsageNSec))
+				if err := db.SetJobUsage(job.ID, cpuUsage, systemd.ParseAccounting(info.MemoryPeak)); err != nil {
+					return nil, err
+				}
+				settleVerdict(job, info.ExecMainStatus)
+				settleArtifacts(job)
+			}
+			report.Settled = append(report.Settled, change)
+			continue
+		}
+
+		// A scope has no main process whose exit the journal records; its
+		// unit goes away once the adopted processes have all exited
+		if strings.HasSuffix(job.Unit, ".scope") {
+			if !dryRun {
+				if err := db.RecordJobOutcome(job.ID, "exited", "", "", ""); err != nil {
+					return nil, err
+				}
+			}
+			report.Settled = append(report.Settled, syncChange{Job: job, State: "exited"})
+			continue
+		}
+
+		if light {
+			continue
+		}
+		// jr run records a job just before starting its unit
+		if created, ok := parseUTC(job.CreatedAtUTC); ok && time.Since(created) < time.Minute {
+			continue
+		}
+
+		outcome, err := systemd.JournalOutcome(job.Unit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read journal for %s: %v\n", job.Unit, err)
+			continue
+		}
+
+		if outcome == nil {
+			if !dryRun {
+				if err := db.UpdateJobState(job.ID, "unknown"); err != nil {
+					return nil, err
+				}
+			}
+			report.Lost = append(report.Lost, job)
+			continue
+		}
+
+		if !dryRun {
+			var finished string
+			if !outcome.Finished.IsZero() {
+				finished = outcome.Finished.Format(time.RFC3339)
+			}
+			if err := db.RecordJobOutcome(job.ID, outcome.State, outcome.ExitStatus, "", finished); err != nil {
+				return nil, err
+			}
+			if err := db.SetJobUsage(job.ID, outcome.CPUUsage, outcome.MemoryPeak); err != nil {
+				return nil, err
+			}
+			settleVerdict(job, outcome.ExitStatus)
+			settleArtifacts(job)
+		}
+		report.Settled = append(report.Settled, syncChange{Job: job, State: outcome.State, ExitStatus: outcome.ExitStatus})
+	}
+
+	return report, nil
+}
+
+// adoptUnit records a job for a unit jr has no row for, recovering what it
+// can from the unit. It returns nil for jr-* units that are not jobs. With
+// dryRun the returned job is not saved and has no id.
+func adoptUnit(unit string, dryRun bool) (*db.Job, error) {
+	name, created, ok := systemd.ParseUnitName(unit)
+	if !ok {
+		return nil, nil
+	}
+
+	details, err := systemd.ShowUnitDetails(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	if desc, ok := strings.CutPrefix(details.Description, "jr job: "); ok && desc != "" {
+		name = desc
+	}
+
+	if dryRun {
+		return &db.Job{Name: name, Unit: unit, Cwd: details.WorkingDirectory}, nil
+	}
+	return recordUnit(unit, name, created, details)
+}
+
+// recordUnit inserts a job for an existing unit described by details.
+func recordUnit(unit, name string, created time.Time, details *systemd.UnitDetails) (*db.Job, error) {
+	host, _ := os.Hostname()
+	id, err := db.CreateJob(name, unit, details.WorkingDirectory, details.Argv,
+		cfg.Env.Redact(details.Env), nil, host, os.Getenv("USER"))
+	if err != nil {
+		return nil, err
+	}
+	if !created.IsZero() {
+		if err := db.SetJobCreated(id, created); err != nil {
+			return nil, err
+		}
+	}
+
+	return db.GetJobByID(id)
+}
+
+// utcTimestamp converts a systemctl timestamp to RFC 3339 in UTC, or ""
+// when it does not parse.
+func utcTimestamp(s string) string {
+	t, ok := systemd.ParseTimestamp(s)
+	if !ok {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	report, err := reconcile(false, syncDryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := func(done, would string) string {
+		if syncDryRun {
+			return would
+		}
+		return done
+	}
+
+	for _, job := range report.Adopted {
+		if syncDryRun {
+			fmt.Printf("Would adopt %s (%s)\n", job.Unit, job.Name)
+		} else {
+			fmt.Printf("Adopted %d %s (%s)\n", job.ID, job.Unit, job.Name)
+		}
+	}
+
+	for _, c := range report.Settled {
+		detail := c.State
+		if c.ExitStatus != "" && c.ExitStatus != "0" {
+			detail += ", exit status " + c.ExitStatus
+		}
+		fmt.Printf("%s %d %s: %s\n", verb("Recorded", "Would record"), c.Job.ID, c.Job.Unit, detail)
+	}
+
+	for _, job := range report.Lost {
+		fmt.Printf("%s %d %s: unit vanished, outcome unknown\n", verb("Marked", "Would mark"), job.ID, job.Unit)
+	}
+
+	for _, unit := range report.Skipped {
+		fmt.Printf("Skipped %s: not a job unit\n", unit)
+	}
+
+	if len(report.Adopted)+len(report.Settled)+len(report.Lost) == 0 {
+		fmt.Println("Database is in sync")
+	}
+
+	return nil
+}
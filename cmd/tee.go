@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// teeCommand is the hidden first argument of the ExecStart= wrapper of
+// jobs run with --tee or log limits: jr _tee [options] -- <command>
+// [args...].
+const teeCommand = "_tee"
+
+// teeLogName is the file in a job's directory that --tee copies output to.
+const teeLogName = "output.log"
+
+// jrExecutable returns the resolved path of the running jr binary, for
+// units that call back into jr.
+func jrExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the jr binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return exe, nil
+}
+
+// teeOptions are the options of the _tee wrapper, which copies a job's
+// output to File, enforces its log limits and watches it for stalls. Unit
+// and DB locate the job to stop and record events against.
+type teeOptions struct {
+	File   string
+	Unit   string
+	DB     string
+	Limits logLimits
+
+	StallTimeout time.Duration
+	StallAction  string
+	// Notify is the job's notify command, run by the notify stall action
+	// if NotifyOn, as for jr run --notify-on, lets a failure through.
+	Notify   string
+	NotifyOn string
+}
+
+// needed reports whether opts call for the wrapper at all.
+func (opts *teeOptions) needed() bool {
+	return opts.File != "" || opts.Limits.set() || opts.StallTimeout > 0
+}
+
+// args returns opts as _tee options.
+func (opts *teeOptions) args() []string {
+	var args []string
+	if opts.File != "" {
+		args = append(args, "--file", opts.File)
+	}
+	if opts.Unit != "" {
+		args = append(args, "--unit", opts.Unit)
+	}
+	if opts.DB != "" {
+		args = append(args, "--db", opts.DB)
+	}
+	if opts.Limits.Lines > 0 {
+		args = append(args, "--max-log-rate", opts.Limits.rate())
+	}
+	if opts.Limits.Bytes > 0 {
+		args = append(args, "--max-log-bytes", strconv.FormatInt(opts.Limits.Bytes, 10))
+	}
+	if opts.Limits.set() {
+		args = append(args, "--log-limit-action", opts.Limits.Action)
+	}
+	if opts.StallTimeout > 0 {
+		args = append(args, "--stall-timeout", opts.StallTimeout.String(), "--stall-action", opts.StallAction)
+		if opts.Notify != "" {
+			args = append(args, "--notify", opts.Notify, "--notify-on", opts.NotifyOn)
+		}
+	}
+	return args
+}
+
+// parseTeeArgs parses the arguments of jr _tee, returning the options,
+// whether this is the copier, and the command to run.
+func parseTeeArgs(args []string) (opts *teeOptions, copier bool, argv []string, err error) {
+	opts = &teeOptions{Limits: logLimits{Action: logLimitWarn}, StallAction: stallNotify}
+	var rate string
+	fs := flag.NewFlagSet("jr "+teeCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&copier, "copy", false, "")
+	fs.StringVar(&opts.File, "file", "", "")
+	fs.StringVar(&opts.Unit, "unit", "", "")
+	fs.StringVar(&opts.DB, "db", "", "")
+	fs.StringVar(&rate, "max-log-rate", "", "")
+	fs.Int64Var(&opts.Limits.Bytes, "max-log-bytes", 0, "")
+	fs.StringVar(&opts.Limits.Action, "log-limit-action", logLimitWarn, "")
+	fs.DurationVar(&opts.StallTimeout, "stall-timeout", 0, "")
+	fs.StringVar(&opts.StallAction, "stall-action", stallNotify, "")
+	fs.StringVar(&opts.Notify, "notify", "", "")
+	fs.StringVar(&opts.NotifyOn, "notify-on", "", "")
+	if err := fs.Parse(args); err != nil {
+		return nil, false, nil, err
+	}
+
+	if rate != "" {
+		if opts.Limits.Lines, opts.Limits.Interval, err = parseLogRate(rate); err != nil {
+			return nil, false, nil, err
+		}
+	}
+
+	// Parse consumes the "--" that ends the options
+	return opts, copier, fs.Args(), nil
+}
+
+// teeWrapper is the --tee and log limit wrapper. It runs inside the job,
+// so Execute calls it before any config or database is touched.
+//
+// It starts a copier process and then execs the job's command with stdout
+// and stderr redirected to pipes read by the copier, so the command keeps
+// the unit's main PID and receives stop and checkpoint signals directly.
+// The copier writes everything both to the original stdout and stderr
+// (the journal) and to the log file, if any, up to the log limits.
+func teeWrapper(args []string) error {
+	opts, copier, argv, err := parseTeeArgs(args)
+	if err != nil {
+		return err
+	}
+	if copier {
+		return runTeeCopier(opts)
+	}
+	if len(argv) == 0 {
+		return fmt.Errorf("usage: jr %s [--file <file>] [options] -- <command> [args...]", teeCommand)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	copierCmd := exec.Command(exe, append([]string{teeCommand, "--copy"}, opts.args()...)...)
+	copierCmd.Stdout = os.Stdout
+	copierCmd.Stderr = os.Stderr
+	copierCmd.ExtraFiles = []*os.File{outR, errR}
+	if err := copierCmd.Start(); err != nil {
+		return fmt.Errorf("failed to start log copier: %w", err)
+	}
+	outR.Close()
+	errR.Close()
+
+	if err := syscall.Dup3(int(outW.Fd()), 1, 0); err != nil {
+		return err
+	}
+	if err := syscall.Dup3(int(errW.Fd()), 2, 0); err != nil {
+		return err
+	}
+	outW.Close()
+	errW.Close()
+
+	return syscall.Exec(bin, argv, os.Environ())
+}
+
+// runTeeCopier copies the pipes inherited as fds 3 (stdout) and 4
+// (stderr) to its own stdout and stderr and appends both to the log file,
+// until the command closes them.
+func runTeeCopier(opts *teeOptions) error {
+	// Stopping the unit signals every process in it; the copier outlives
+	// the command just long enough to drain what it wrote.
+	signal.Ignore(syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	var file io.Writer
+	if opts.File != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.File), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		file = &lockedWriter{w: f}
+	}
+
+	var watch *logWatchdog
+	if opts.Limits.set() {
+		watch = newLogWatchdog(opts.Limits, logLimitTrip(opts.Unit, opts.DB, opts.Limits.Action))
+		defer watch.wait()
+	}
+
+	var stall *stallWatch
+	if opts.StallTimeout > 0 {
+		stall = newStallWatch(opts.StallTimeout)
+		done := make(chan struct{})
+		defer close(done)
+		onStall, onRecover := stallHandlers(opts)
+		go stall.run(done, onStall, onRecover)
+	}
+
+	admit := func(p []byte) int {
+		if stall != nil {
+			stall.touch()
+		}
+		if watch != nil {
+			return watch.admit(p)
+		}
+		return len(p)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range []struct {
+		src *os.File
+		dst io.Writer
+	}{
+		{os.NewFile(3, "stdout"), os.Stdout},
+		{os.NewFile(4, "stderr"), os.Stderr},
+	} {
+		wg.Add(1)
+		go func(src *os.File, dst io.Writer) {
+			defer wg.Done()
+			teeCopy(src, dst, file, admit)
+		}(p.src, p.dst)
+	}
+	wg.Wait()
+	return nil
+}
+
+// teeCopy copies src to both dst and file, if not nil. admit, if not nil,
+// sees all output and returns how much of it to copy. A failing
+// destination is dropped so the other keeps receiving output and the
+// command never blocks on a full pipe.
+func teeCopy(src io.Reader, dst, file io.Writer, admit func([]byte) int) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 && admit != nil {
+			n = admit(buf[:n])
+		}
+		if n > 0 {
+			if dst != nil {
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					dst = nil
+				}
+			}
+			if file != nil {
+				if _, werr := file.Write(buf[:n]); werr != nil {
+					file = nil
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// lockedWriter serializes writes from the stdout and stderr copiers.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
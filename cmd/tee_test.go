@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestTeeCopy(t *testing.T) {
+	var dst, file strings.Builder
+	teeCopy(strings.NewReader("epoch 1\nepoch 2\n"), &dst, &lockedWriter{w: &file}, nil)
+	if dst.String() != "epoch 1\nepoch 2\n" || file.String() != dst.String() {
+		t.Errorf("Expected both copies, got %q and %q", dst.String(), file.String())
+	}
+
+	// A broken journal stream must not stop the file copy
+	file.Reset()
+	teeCopy(strings.NewReader("still here\n"), failingWriter{}, &file, nil)
+	if file.String() != "still here\n" {
+		t.Errorf("Expected file copy despite failing stdout, got %q", file.String())
+	}
+}
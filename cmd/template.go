@@ -0,0 +1,566 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/spf13/cobra"
+	"github.com/user/jr/config"
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+var (
+	templateSaveCwd        string
+	templateSaveEnv        []string
+	templateSaveProperties []string
+	templateSaveForce      bool
+	templateRunName        string
+	templateRunGroup       string
+	templateRunNoInherit   bool
+)
+
+var templateCmd = &cobra.Command{
+	Use:     "template",
+	Aliases: []string{"tpl"},
+	Short:   "Manage saved job templates",
+}
+
+var templateSaveCmd = &cobra.Command{
+	Use:   "save <name> [flags] -- <command> [args...]",
+	Short: "Save a command line as a template",
+	Long: `Save a command line as a named template. Arguments, the working
+directory, env values and property values may contain placeholders such as
+{{.lr}} that are filled in by 'jr template run'.
+
+Values of secret variables (see [env].secret) are kept in a private file
+rather than the database.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("requires a template name and a command")
+		}
+		return nil
+	},
+	RunE: runTemplateSave,
+}
+
+var templateRunCmd = &cobra.Command{
+	Use:   "run <name> [key=value...]",
+	Short: "Run a job from a template",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTemplateRun,
+}
+
+var templateLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List saved templates",
+	Args:    cobra.NoArgs,
+	RunE:    runTemplateLs,
+}
+
+var templateRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Delete a template",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTemplateRm,
+}
+
+func init() {
+	templateSaveCmd.Flags().StringVar(&templateSaveCwd, "cwd", "", "working directory (default: current)")
+	templateSaveCmd.Flags().StringArrayVarP(&templateSaveEnv, "env", "e", nil, "environment variables (repeatable, format: K=V)")
+	templateSaveCmd.Flags().StringArrayVar(&templateSaveProperties, "property", nil, "pass -p k=v to systemd-run (repeatable)")
+	templateSaveCmd.Flags().BoolVar(&templateSaveForce, "force", false, "overwrite an existing template")
+
+	templateRunCmd.Flags().StringVarP(&templateRunName, "name", "n", "", "logical name (default: template name)")
+	templateRunCmd.Flags().BoolVar(&templateRunNoInherit, "no-inherit-env", false, "do not capture the current environment")
+	templateRunCmd.Flags().StringVar(&templateRunGroup, "group", os.Getenv("JR_GROUP"), "add the job to a group (default: $JR_GROUP)")
+
+	templateCmd.AddCommand(templateSaveCmd)
+	templateCmd.AddCommand(templateRunCmd)
+	templateCmd.AddCommand(templateLsCmd)
+	templateCmd.AddCommand(templateRmCmd)
+
+	templateSaveCmd.RegisterFlagCompletionFunc("property", completeProperties)
+	templateRunCmd.ValidArgsFunction = completeTemplates
+	templateRmCmd.ValidArgsFunction = completeTemplates
+}
+
+func runTemplateSave(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	argv := args[1:]
+
+	existing, err := db.GetTemplate(name)
+	if err != nil {
+		return fmt.Errorf("failed to look up template: %w", err)
+	}
+	if existing != nil && !templateSaveForce {
+		return fmt.Errorf("template %s already exists (use --force to overwrite)", name)
+	}
+
+	cwd := templateSaveCwd
+	if cwd == "" {
+		cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	env, err := parseKeyValues(templateSaveEnv, "env", "K=V")
+	if err != nil {
+		return err
+	}
+	props, err := parseKeyValues(templateSaveProperties, "property", "k=v")
+	if err != nil {
+		return err
+	}
+
+	tmpl := &templateFields{Cwd: cwd, Argv: argv, Env: env, Props: props}
+	params, err := tmpl.params()
+	if err != nil {
+		return err
+	}
+
+	secrets := make(map[string]string)
+	for k, v := range env {
+		if cfg.Env.IsSecret(k) {
+			secrets[k] = v
+		}
+	}
+	if err := saveTemplateSecrets(name, secrets); err != nil {
+		return fmt.Errorf("failed to save template secrets: %w", err)
+	}
+	if err := db.SaveTemplate(name, cwd, argv, cfg.Env.Redact(env), props); err != nil {
+		return fmt.Errorf("failed to save template: %w", err)
+	}
+
+	if len(params) > 0 {
+		fmt.Printf("Saved template %s (parameters: %s)\n", name, strings.Join(params, ", "))
+	} else {
+		fmt.Printf("Saved template %s\n", name)
+	}
+	return nil
+}
+
+func runTemplateRun(cmd *cobra.Command, args []string) error {
+	t, err := db.GetTemplate(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to look up template: %w", err)
+	}
+	if t == nil {
+		return fmt.Errorf("template not found: %s", args[0])
+	}
+
+	tmpl, err := loadTemplateFields(t)
+	if err != nil {
+		return err
+	}
+
+	values, err := parseKeyValues(args[1:], "parameter", "key=value")
+	if err != nil {
+		return err
+	}
+
+	expanded, err := tmpl.expand(values)
+	if err != nil {
+		return fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	for k, v := range expanded.Env {
+		if v == config.Redacted && cfg.Env.IsSecret(k) {
+			return fmt.Errorf("template %s: the value of %s is missing; save the template again", t.Name, k)
+		}
+	}
+
+	name := templateRunName
+	if name == "" {
+		name = t.Name
+	}
+
+	env := make(map[string]string)
+	if !templateRunNoInherit {
+		env = inheritedEnv()
+	}
+	for k, v := range expanded.Env {
+		env[k] = v
+	}
+
+	if cfg.Defaults.LingerCheck {
+		warnIfNotLingering()
+	}
+
+	spec := &jobSpec{
+		Name:     name,
+		Cwd:      expanded.Cwd,
+		Argv:     expanded.Argv,
+		Env:      env,
+		Props:    expanded.Props,
+		Params:   tmpl.recordedParams(values),
+		Group:    templateRunGroup,
+		Snapshot: cfg.Defaults.Snapshot,
+	}
+
+	id, err := launchJob(spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Started %d %s\n", id, spec.Unit)
+	return nil
+}
+
+func runTemplateLs(cmd *cobra.Command, args []string) error {
+	templates, err := db.ListTemplates()
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	if len(templates) == 0 {
+		fmt.Println("No templates found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPARAMS\tCWD\tCMD")
+
+	for _, t := range templates {
+		tmpl, err := loadTemplateFields(t)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t\t%s\t<unmarshal error>\n", t.Name, t.Cwd)
+			continue
+		}
+
+		params, err := tmpl.params()
+		paramsStr := strings.Join(params, ",")
+		if err != nil {
+			paramsStr = "<invalid>"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, paramsStr, t.Cwd, systemd.ShortenCommand(tmpl.Argv, 40))
+	}
+
+	return w.Flush()
+}
+
+func runTemplateRm(cmd *cobra.Command, args []string) error {
+	deleted, err := db.DeleteTemplate(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("template not found: %s", args[0])
+	}
+	if err := saveTemplateSecrets(args[0], nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove template secrets: %v\n", err)
+	}
+
+	fmt.Printf("Removed template %s\n", args[0])
+	return nil
+}
+
+// parseKeyValues splits "k=v" arguments into a map; what and format are used
+// in error messages.
+func parseKeyValues(items []string, what, format string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid %s format: %s (expected %s)", what, item, format)
+		}
+		result[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// templateFields holds the placeholder-bearing parts of a template.
+type templateFields struct {
+	Cwd   string
+	Argv  []string
+	Env   map[string]string
+	Props map[string]string
+}
+
+func loadTemplateFields(t *db.Template) (*templateFields, error) {
+	tmpl := &templateFields{Cwd: t.Cwd}
+
+	if err := json.Unmarshal([]byte(t.ArgvJSON), &tmpl.Argv); err != nil {
+		return nil, fmt.Errorf("template %s: invalid argv: %w", t.Name, err)
+	}
+	if t.EnvJSON.Valid && t.EnvJSON.String != "" {
+		if err := json.Unmarshal([]byte(t.EnvJSON.String), &tmpl.Env); err != nil {
+			return nil, fmt.Errorf("template %s: invalid env: %w", t.Name, err)
+		}
+	}
+	secrets, err := loadTemplateSecrets(t.Name)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	for k, v := range secrets {
+		if tmpl.Env[k] == config.Redacted {
+			tmpl.Env[k] = v
+		}
+	}
+	if t.PropertiesJSON.Valid && t.PropertiesJSON.String != "" {
+		if err := json.Unmarshal([]byte(t.PropertiesJSON.String), &tmpl.Props); err != nil {
+			return nil, fmt.Errorf("template %s: invalid properties: %w", t.Name, err)
+		}
+	}
+
+	return tmpl, nil
+}
+
+// saveTemplateSecrets writes the secret env values of template name to its
+// private file, or removes the file if there are none.
+func saveTemplateSecrets(name string, secrets map[string]string) error {
+	path, err := db.TemplateSecretsPath(name)
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// loadTemplateSecrets reads the secret env values of template name, nil if
+// it has none.
+func loadTemplateSecrets(name string) (map[string]string, error) {
+	path, err := db.TemplateSecretsPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid secrets file %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// recordedParams returns values as a job records them, with the values of
+// parameters that fill in a secret variable redacted.
+func (t *templateFields) recordedParams(values map[string]string) map[string]string {
+	return redactParams(values, t.Env, func(s string) []string {
+		names, _ := templateParams(s)
+		return names
+	})
+}
+
+// redactParams returns a copy of values with the parameters redacted that
+// placeholders finds in the value of a secret variable of env.
+func redactParams(values, env map[string]string, placeholders func(string) []string) map[string]string {
+	params := make(map[string]string, len(values))
+	for k, v := range values {
+		params[k] = v
+	}
+	for k, v := range env {
+		if !cfg.Env.IsSecret(k) {
+			continue
+		}
+		for _, name := range placeholders(v) {
+			if _, ok := params[name]; ok {
+				params[name] = config.Redacted
+			}
+		}
+	}
+	return params
+}
+
+// allStrings returns every templated string, in a stable order.
+func (t *templateFields) allStrings() []string {
+	all := []string{t.Cwd}
+	all = append(all, t.Argv...)
+	for _, m := range []map[string]string{t.Env, t.Props} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			all = append(all, m[k])
+		}
+	}
+	return all
+}
+
+// params returns the sorted, de-duplicated placeholder names.
+func (t *templateFields) params() ([]string, error) {
+	seen := make(map[string]bool)
+	for _, s := range t.allStrings() {
+		names, err := templateParams(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+
+	params := make([]string, 0, len(seen))
+	for name := range seen {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	return params, nil
+}
+
+// expand substitutes values into every field, failing if a placeholder has
+// no value or a value matches no placeholder.
+func (t *templateFields) expand(values map[string]string) (*templateFields, error) {
+	params, err := t.params()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	known := make(map[string]bool)
+	for _, p := range params {
+		known[p] = true
+		if _, ok := values[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing parameters: %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for k := range values {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameters: %s (template takes: %s)", strings.Join(unknown, ", "), strings.Join(params, ", "))
+	}
+
+	expand := func(s string) (string, error) {
+		return expandTemplate(s, values)
+	}
+
+	result := &templateFields{}
+	if result.Cwd, err = expand(t.Cwd); err != nil {
+		return nil, err
+	}
+	for _, arg := range t.Argv {
+		expanded, err := expand(arg)
+		if err != nil {
+			return nil, err
+		}
+		result.Argv = append(result.Argv, expanded)
+	}
+	if result.Env, err = expandMap(t.Env, expand); err != nil {
+		return nil, err
+	}
+	if result.Props, err = expandMap(t.Props, expand); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func expandMap(m map[string]string, expand func(string) (string, error)) (map[string]string, error) {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		expanded, err := expand(v)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = expanded
+	}
+	return result, nil
+}
+
+// templateParams returns the names of the {{.name}} fields referenced by s.
+func templateParams(s string) ([]string, error) {
+	t, err := template.New("").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid placeholder in %q: %w", s, err)
+	}
+
+	var names []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			names = append(names, n.Ident[0])
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+
+	if t.Tree != nil {
+		walk(t.Tree.Root)
+	}
+	return names, nil
+}
+
+func expandTemplate(s string, values map[string]string) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid placeholder in %q: %w", s, err)
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/user/jr/db"
+)
+
+func TestTemplateParams(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{"train.py", nil, false},
+		{"--lr={{.lr}}", []string{"lr"}, false},
+		{"{{.a}}-{{.b}}", []string{"a", "b"}, false},
+		{"{{if .debug}}-v{{end}}", []string{"debug"}, false},
+		{"{{.lr", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := templateParams(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("templateParams(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("templateParams(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTemplateExpand(t *testing.T) {
+	tmpl := &templateFields{
+		Cwd:   "/runs/{{.seed}}",
+		Argv:  []string{"python", "train.py", "--lr", "{{.lr}}"},
+		Env:   map[string]string{"SEED": "{{.seed}}"},
+		Props: map[string]string{"MemoryMax": "4G"},
+	}
+
+	params, err := tmpl.params()
+	if err != nil {
+		t.Fatalf("params() error: %v", err)
+	}
+	if !reflect.DeepEqual(params, []string{"lr", "seed"}) {
+		t.Errorf("params() = %v, want [lr seed]", params)
+	}
+
+	expanded, err := tmpl.expand(map[string]string{"lr": "0.01", "seed": "3"})
+	if err != nil {
+		t.Fatalf("expand() error: %v", err)
+	}
+	if expanded.Cwd != "/runs/3" {
+		t.Errorf("Expected Cwd=/runs/3, got %q", expanded.Cwd)
+	}
+	if expanded.Argv[3] != "0.01" {
+		t.Errorf("Expected --lr 0.01, got %v", expanded.Argv)
+	}
+	if expanded.Env["SEED"] != "3" {
+		t.Errorf("Expected SEED=3, got %q", expanded.Env["SEED"])
+	}
+
+	_, err = tmpl.expand(map[string]string{"lr": "0.01"})
+	if err == nil || !strings.Contains(err.Error(), "missing parameters: seed") {
+		t.Errorf("Expected missing parameter error, got %v", err)
+	}
+
+	_, err = tmpl.expand(map[string]string{"lr": "0.01", "seed": "1", "epochs": "5"})
+	if err == nil || !strings.Contains(err.Error(), "unknown parameters: epochs") {
+		t.Errorf("Expected unknown parameter error, got %v", err)
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	result, err := parseKeyValues([]string{"a=1", "b=x=y"}, "parameter", "key=value")
+	if err != nil {
+		t.Fatalf("parseKeyValues() error: %v", err)
+	}
+	if result["a"] != "1" || result["b"] != "x=y" {
+		t.Errorf("parseKeyValues() = %v", result)
+	}
+
+	if _, err := parseKeyValues([]string{"novalue"}, "parameter", "key=value"); err == nil {
+		t.Error("Expected error for missing '='")
+	}
+}
+
+func TestTemplateSecrets(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	if err := saveTemplateSecrets("ci/train", map[string]string{"API_TOKEN": "hunter2"}); err != nil {
+		t.Fatalf("saveTemplateSecrets: %v", err)
+	}
+	path, _ := db.TemplateSecretsPath("ci/train")
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private secrets file, got %v, %v", info, err)
+	}
+
+	tmpl, err := loadTemplateFields(&db.Template{
+		Name:     "ci/train",
+		ArgvJSON: `["train"]`,
+		EnvJSON:  sql.NullString{String: `{"API_TOKEN":"<redacted>","LR":"0.1"}`, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("loadTemplateFields: %v", err)
+	}
+	if tmpl.Env["API_TOKEN"] != "hunter2" || tmpl.Env["LR"] != "0.1" {
+		t.Errorf("Expected the secret to be restored, got %v", tmpl.Env)
+	}
+
+	if err := saveTemplateSecrets("ci/train", nil); err != nil {
+		t.Fatalf("saveTemplateSecrets: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the secrets file to be removed, got %v", err)
+	}
+}
+
+func TestTemplateRecordedParams(t *testing.T) {
+	tmpl := &templateFields{
+		Env: map[string]string{"API_TOKEN": "{{.token}}", "SEED": "{{.seed}}"},
+	}
+	got := tmpl.recordedParams(map[string]string{"token": "hunter2", "seed": "3"})
+	want := map[string]string{"token": "<redacted>", "seed": "3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recordedParams() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+// Verdicts of finished jobs.
+const (
+	verdictSuccess = "success"
+	verdictFailure = "failure"
+)
+
+// jobSuccessRules returns the success rules job was run with, nil if none.
+func jobSuccessRules(job *db.Job) *db.SuccessRules {
+	if !job.SuccessRules.Valid {
+		return nil
+	}
+	var rules db.SuccessRules
+	if err := json.Unmarshal([]byte(job.SuccessRules.String), &rules); err != nil {
+		return nil
+	}
+	return &rules
+}
+
+// jobExit describes how the main process of a job ended.
+type jobExit struct {
+	// Code is "exited", "killed" or "dumped" as in $EXIT_CODE of
+	// ExecStopPost=, or empty if unknown.
+	Code string
+	// Status is the exit status, or the signal if killed.
+	Status string
+}
+
+// evaluateVerdict decides whether a finished job succeeded under rules,
+// returning the reason if not. Files are looked up relative to cwd, and
+// output is only read if a rule needs it.
+func evaluateVerdict(rules *db.SuccessRules, exit jobExit, cwd string, output func() (io.ReadCloser, error)) (verdict, reason string) {
+	if exit.Code != "" && exit.Code != "exited" {
+		return verdictFailure, fmt.Sprintf("%s by signal %s", exit.Code, exit.Status)
+	}
+
+	allowed := rules.ExitCodes
+	if len(allowed) == 0 {
+		allowed = []int{0}
+	}
+	status, err := strconv.Atoi(exit.Status)
+	if err != nil {
+		return verdictFailure, fmt.Sprintf("unknown exit status %q", exit.Status)
+	}
+	if !slices.Contains(allowed, status) {
+		return verdictFailure, fmt.Sprintf("exit status %d", status)
+	}
+
+	for _, pattern := range rules.Files {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(cwd, pattern)
+		}
+		if matches, _ := filepath.Glob(pattern); len(matches) == 0 {
+			return verdictFailure, fmt.Sprintf("no file matches %s", pattern)
+		}
+	}
+
+	if rules.Output != "" {
+		re, err := regexp.Compile(rules.Output)
+		if err != nil {
+			return verdictFailure, fmt.Sprintf("invalid output rule: %v", err)
+		}
+		r, err := output()
+		if err != nil {
+			return verdictFailure, fmt.Sprintf("failed to read output: %v", err)
+		}
+		defer r.Close()
+		if !outputMatches(r, re) {
+			return verdictFailure, fmt.Sprintf("no output matched /%s/", rules.Output)
+		}
+	}
+
+	return verdictSuccess, ""
+}
+
+// outputMatches reports whether some line read from r matches re.
+func outputMatches(r io.Reader, re *regexp.Regexp) bool {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if re.Match(scanner.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobOutput returns a reader over the output of job: its log files if it
+// was run with --log-file, else its messages in the journal.
+func jobOutput(job *db.Job) (io.ReadCloser, error) {
+	if jobWritesLogFile(job) {
+		var readers []io.Reader
+		var files multiCloser
+		for _, path := range []string{job.LogFile.String, job.ErrLogFile.String} {
+			if path == "" {
+				continue
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				files.Close()
+				return nil, err
+			}
+			readers = append(readers, f)
+			files = append(files, f)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(readers...), files}, nil
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		w.CloseWithError(systemd.WriteJournalMessages(job.Unit, w))
+	}()
+	return r, nil
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	for _, c := range m {
+		c.Close()
+	}
+	return nil
+}
+
+// settleVerdict evaluates and records the verdict of a finished job with
+// success rules that has none yet, because its ExecStopPost= hook did not
+// run.
+func settleVerdict(job *db.Job, exitStatus string) {
+	rules := jobSuccessRules(job)
+	if rules == nil || job.Verdict.Valid {
+		return
+	}
+	verdict, reason := evaluateVerdict(rules, jobExit{Status: exitStatus}, job.Cwd, func() (io.ReadCloser, error) {
+		return jobOutput(job)
+	})
+	if err := db.SetJobVerdict(job.ID, verdict, reason); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record verdict of %d %s: %v\n", job.ID, job.Unit, err)
+	}
+}
+
+// jobVerdict returns the verdict of job in state: the recorded one, or
+// else one derived from the state once the job has finished. A job that
+// jr stop ended failed, even if it exited cleanly on its stop signal.
+func jobVerdict(job *db.Job, state string) string {
+	if job.StopResult.Valid && !isActiveState(state) {
+		return verdictFailure
+	}
+	if job.Verdict.Valid && !isActiveState(state) {
+		return job.Verdict.String
+	}
+	switch state {
+	case "exited":
+		return verdictSuccess
+	case "failed":
+		return verdictFailure
+	}
+	return ""
+}
+
+// verdictState returns the state of a finished job as its verdict has it,
+// "exited" for success and "failed" for failure, for state based policies.
+// Other states are returned unchanged.
+func verdictState(job *db.Job, state string) string {
+	if state != "exited" && state != "failed" {
+		return state
+	}
+	if jobVerdict(job, state) == verdictSuccess {
+		return "exited"
+	}
+	return "failed"
+}
+
+// formatSuccessRules describes rules for jr status.
+func formatSuccessRules(rules *db.SuccessRules) string {
+	var parts []string
+	if len(rules.ExitCodes) > 0 {
+		codes := make([]string, len(rules.ExitCodes))
+		for i, code := range rules.ExitCodes {
+			codes[i] = strconv.Itoa(code)
+		}
+		parts = append(parts, "exit "+strings.Join(codes, ","))
+	}
+	if rules.Output != "" {
+		parts = append(parts, "output /"+rules.Output+"/")
+	}
+	for _, f := range rules.Files {
+		parts = append(parts, "file "+f)
+	}
+	return strings.Join(parts, "; ")
+}
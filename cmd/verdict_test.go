@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/jr/db"
+	"github.com/user/jr/systemd"
+)
+
+func TestEvaluateVerdict(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cwd, "result.csv"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	output := func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("epoch 1\nall done\n")), nil
+	}
+
+	tests := []struct {
+		name    string
+		rules   db.SuccessRules
+		exit    jobExit
+		verdict string
+		reason  string
+	}{
+		{"zero exit", db.SuccessRules{}, jobExit{Code: "exited", Status: "0"}, verdictSuccess, ""},
+		{"non-zero exit", db.SuccessRules{}, jobExit{Code: "exited", Status: "1"}, verdictFailure, "exit status 1"},
+		{"allowed exit", db.SuccessRules{ExitCodes: []int{0, 2}}, jobExit{Status: "2"}, verdictSuccess, ""},
+		{"disallowed zero", db.SuccessRules{ExitCodes: []int{2}}, jobExit{Status: "0"}, verdictFailure, "exit status 0"},
+		{"killed", db.SuccessRules{ExitCodes: []int{0, 15}}, jobExit{Code: "killed", Status: "TERM"}, verdictFailure, "killed by signal TERM"},
+		{"file present", db.SuccessRules{Files: []string{"*.csv"}}, jobExit{Status: "0"}, verdictSuccess, ""},
+		{"file missing", db.SuccessRules{Files: []string{"*.pt"}}, jobExit{Status: "0"}, verdictFailure, "no file matches " + filepath.Join(cwd, "*.pt")},
+		{"output matches", db.SuccessRules{Output: "^all done$"}, jobExit{Status: "0"}, verdictSuccess, ""},
+		{"output missing", db.SuccessRules{Output: "^finished"}, jobExit{Status: "0"}, verdictFailure, "no output matched /^finished/"},
+	}
+
+	for _, tt := range tests {
+		verdict, reason := evaluateVerdict(&tt.rules, tt.exit, cwd, output)
+		if verdict != tt.verdict || reason != tt.reason {
+			t.Errorf("%s: got %s (%q), expected %s (%q)", tt.name, verdict, reason, tt.verdict, tt.reason)
+		}
+	}
+
+	// Output is not read unless a rule needs it
+	evaluateVerdict(&db.SuccessRules{}, jobExit{Status: "0"}, cwd, func() (io.ReadCloser, error) {
+		t.Error("Expected output not to be read")
+		return nil, nil
+	})
+}
+
+func TestVerdictState(t *testing.T) {
+	job := &db.Job{}
+	if got := verdictState(job, "failed"); got != "failed" {
+		t.Errorf("Expected a failed job without verdict to stay failed, got %q", got)
+	}
+
+	// Exit 2 allowed by --success-exit
+	job.Verdict = sql.NullString{String: verdictSuccess, Valid: true}
+	if got := verdictState(job, "failed"); got != "exited" {
+		t.Errorf("Expected a successful verdict to count as exited, got %q", got)
+	}
+	if got := jobVerdict(job, "active"); got != "" {
+		t.Errorf("Expected no verdict while the job runs again, got %q", got)
+	}
+
+	// Exit 0 without the expected output
+	job.Verdict = sql.NullString{String: verdictFailure, Valid: true}
+	if got := verdictState(job, "exited"); got != "failed" {
+		t.Errorf("Expected a failed verdict to count as failed, got %q", got)
+	}
+	if got := verdictState(job, "paused"); got != "paused" {
+		t.Errorf("Expected running states unchanged, got %q", got)
+	}
+
+	// Exited cleanly on the SIGTERM of jr stop
+	job.Verdict = sql.NullString{String: verdictSuccess, Valid: true}
+	job.StopResult = sql.NullString{String: "graceful", Valid: true}
+	if got := verdictState(job, "exited"); got != "failed" {
+		t.Errorf("Expected a stopped job to count as failed, got %q", got)
+	}
+}
+
+func TestFinishProperty(t *testing.T) {
+	got := finishProperty("/usr/bin/jr", "/state/jr.db", "jr-a.service", "notify-send $JR_VERDICT", "failure")
+	want := `-"/usr/bin/jr" "_finish" "--db" "/state/jr.db" "--unit" "jr-a.service" "--notify" "notify-send $$JR_VERDICT" "--notify-on" "failure"`
+	if got != want {
+		t.Errorf("finishProperty =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFinishOutcome(t *testing.T) {
+	now := time.Date(2024, 1, 6, 15, 0, 0, 0, time.UTC)
+	info := &systemd.UnitInfo{
+		ExecMainStartTimestamp: "Sat 2024-01-06 14:00:00 UTC",
+		ExecMainExitTimestamp:  "Sat 2024-01-06 14:30:00 UTC",
+	}
+	state, started, finished := finishOutcome("success", info, now)
+	if state != "exited" || started != "2024-01-06T14:00:00Z" || finished != "2024-01-06T14:30:00Z" {
+		t.Errorf("finishOutcome(success) = %s, %s, %s", state, started, finished)
+	}
+
+	// Without the unit, the hook's clock stands in for the exit time
+	state, started, finished = finishOutcome("exit-code", &systemd.UnitInfo{}, now)
+	if state != "failed" || started != "" || finished != "2024-01-06T15:00:00Z" {
+		t.Errorf("finishOutcome(exit-code) = %s, %s, %s", state, started, finished)
+	}
+}
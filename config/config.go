@@ -0,0 +1,324 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the user configuration read from $XDG_CONFIG_HOME/jr/config.
+//
+// Values are layered with the following precedence (lowest first):
+// built-in defaults, the [defaults] table, the selected [profile.<name>]
+// table, and finally flags given on the command line.
+type Config struct {
+	Defaults Defaults           `toml:"defaults"`
+	Env      EnvPolicy          `toml:"env"`
+	Prune    PrunePolicy        `toml:"prune"`
+	Maint    Maintenance        `toml:"maintenance"`
+	Logs     LogFiles           `toml:"logs"`
+	Profiles map[string]Profile `toml:"profile"`
+}
+
+type Defaults struct {
+	ListLimit   int    `toml:"list_limit"`
+	PruneKeep   int    `toml:"prune_keep"`
+	Color       string `toml:"color"`
+	LingerCheck bool   `toml:"linger_check"`
+	// AutoSync makes `jr list` and `jr stats` record finished jobs and
+	// adopt unknown units first, like a light `jr sync`.
+	AutoSync bool `toml:"auto_sync"`
+	// JournalCheck warns at `jr run` when job output may be lost: volatile
+	// journal storage, no readable user journal, or strict rate limits.
+	JournalCheck bool `toml:"journal_check"`
+	// TeeLogs copies job output to a file besides the journal: "never",
+	// "always", or "auto" when JournalCheck would warn. --tee overrides.
+	TeeLogs string `toml:"tee_logs"`
+	// LogLimitAction is what happens when a job exceeds --max-log-rate or
+	// --max-log-bytes: "warn" drops the excess output, "stop" also stops
+	// the job. --log-limit-action overrides.
+	LogLimitAction string `toml:"log_limit_action"`
+	// Snapshot records the git state of the job's cwd and its executable
+	// at `jr run`; --snapshot overrides.
+	Snapshot bool `toml:"snapshot"`
+}
+
+// EnvPolicy controls which variables of the invoking environment a job
+// captures and which are treated as secrets. Patterns are shell globs
+// matched case-insensitively against variable names.
+type EnvPolicy struct {
+	// Inherit captures the invoking environment; --no-inherit-env overrides.
+	Inherit bool `toml:"inherit"`
+	// Allow, when non-empty, limits inherited variables to matching names.
+	Allow []string `toml:"allow"`
+	// Deny excludes matching variables from inheritance.
+	Deny []string `toml:"deny"`
+	// Secret marks variables whose values are delivered through a private
+	// file instead of the command line and redacted from all output.
+	Secret []string `toml:"secret"`
+}
+
+// PrunePolicy holds the rules `jr prune` applies on top of
+// defaults.prune_keep; see the prune command for how they combine.
+type PrunePolicy struct {
+	// KeepPerName protects the most recent jobs of every name.
+	KeepPerName int `toml:"keep_per_name"`
+	// MaxAge maps a job state (exited, failed, ...) to the age, such as
+	// "7d", after which finished jobs in that state are removed.
+	MaxAge map[string]string `toml:"max_age,omitempty"`
+	// MaxLogSize caps the total size of per-job files, such as "10G";
+	// the oldest jobs go first.
+	MaxLogSize string `toml:"max_log_size,omitempty"`
+}
+
+// Maintenance configures the background run installed by
+// `jr maintenance install`.
+type Maintenance struct {
+	// Schedule is the timer's OnCalendar= expression, such as "daily" or
+	// "*-*-* 04:00".
+	Schedule string `toml:"schedule"`
+	// ArchiveLogs copies the journal output of finished jobs into their
+	// job directory, so it survives journal rotation.
+	ArchiveLogs bool `toml:"archive_logs"`
+}
+
+// LogFiles configures the files written by `jr run --log-file` and
+// `--tee`.
+type LogFiles struct {
+	// Dir holds --log-file files; empty means each job's own directory
+	// under the state dir. A leading ~/ is the home directory.
+	Dir string `toml:"dir,omitempty"`
+	// MaxSize, such as "100M", is the size beyond which maintenance
+	// rotates a log file; empty disables rotation.
+	MaxSize string `toml:"max_size,omitempty"`
+	// Keep is how many rotated, compressed generations are kept.
+	Keep int `toml:"keep"`
+}
+
+// Redacted replaces secret values in stored and printed environments.
+const Redacted = "<redacted>"
+
+// Profile is a named set of run options selected with `jr run -P <name>`.
+type Profile struct {
+	Env        map[string]string `toml:"env,omitempty"`
+	Properties map[string]string `toml:"properties,omitempty"`
+	GPU        string            `toml:"gpu,omitempty"`
+
+	// Resource limits, translated to the matching systemd properties.
+	MemoryMax  string `toml:"memory_max,omitempty"`
+	CPUQuota   string `toml:"cpu_quota,omitempty"`
+	TasksMax   string `toml:"tasks_max,omitempty"`
+	RuntimeMax string `toml:"runtime_max,omitempty"`
+	Nice       string `toml:"nice,omitempty"`
+
+	// NotifyCommand is run through /bin/sh when the job stops. NotifyOn
+	// selects when: "always" (default), "failure" or "success".
+	NotifyCommand string `toml:"notify_command,omitempty"`
+	NotifyOn      string `toml:"notify_on,omitempty"`
+}
+
+// Default returns the built-in configuration used when no file exists.
+func Default() *Config {
+	return &Config{
+		Defaults: Defaults{
+			ListLimit:    10,
+			PruneKeep:    100,
+			Color:        "auto",
+			LingerCheck:  true,
+			JournalCheck: true,
+			TeeLogs:      "never",
+
+			LogLimitAction: "warn",
+		},
+		Env: EnvPolicy{
+			Inherit: true,
+			Secret:  []string{"*TOKEN*", "*SECRET*", "*KEY*", "*PASSWORD*", "*PASSWD*", "*CREDENTIAL*"},
+		},
+		Maint: Maintenance{
+			Schedule:    "daily",
+			ArchiveLogs: true,
+		},
+		Logs: LogFiles{
+			Keep: 3,
+		},
+		Profiles: map[string]Profile{},
+	}
+}
+
+// Path returns the location of the configuration file.
+func Path() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "jr", "config"), nil
+}
+
+// Load reads the configuration file, falling back to the built-in defaults
+// when it does not exist.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	switch c.Defaults.Color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("invalid color %q (expected auto, always or never)", c.Defaults.Color)
+	}
+
+	switch c.Defaults.TeeLogs {
+	case "never", "always", "auto":
+	default:
+		return fmt.Errorf("invalid tee_logs %q (expected never, always or auto)", c.Defaults.TeeLogs)
+	}
+
+	switch c.Defaults.LogLimitAction {
+	case "warn", "stop":
+	default:
+		return fmt.Errorf("invalid log_limit_action %q (expected warn or stop)", c.Defaults.LogLimitAction)
+	}
+
+	for _, patterns := range [][]string{c.Env.Allow, c.Env.Deny, c.Env.Secret} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid env pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	for name, p := range c.Profiles {
+		switch p.NotifyOn {
+		case "", "always", "failure", "success":
+		default:
+			return fmt.Errorf("profile %s: invalid notify_on %q (expected always, failure or success)", name, p.NotifyOn)
+		}
+	}
+
+	return nil
+}
+
+// Profile returns the named profile or an error listing the known ones.
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := c.ProfileNames()
+		if len(names) == 0 {
+			return Profile{}, fmt.Errorf("unknown profile %q (no profiles configured)", name)
+		}
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %v)", name, names)
+	}
+	return p, nil
+}
+
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write encodes the configuration as TOML.
+func (c *Config) Write(w io.Writer) error {
+	enc := toml.NewEncoder(w)
+	enc.Indent = ""
+	return enc.Encode(c)
+}
+
+// ResourceProperties maps the profile's resource limits to systemd
+// properties.
+func (p Profile) ResourceProperties() map[string]string {
+	props := make(map[string]string)
+	if p.MemoryMax != "" {
+		props["MemoryMax"] = p.MemoryMax
+	}
+	if p.CPUQuota != "" {
+		props["CPUQuota"] = p.CPUQuota
+	}
+	if p.TasksMax != "" {
+		props["TasksMax"] = p.TasksMax
+	}
+	if p.RuntimeMax != "" {
+		props["RuntimeMaxSec"] = p.RuntimeMax
+	}
+	if p.Nice != "" {
+		props["Nice"] = p.Nice
+	}
+	return props
+}
+
+// Inherits reports whether the invoking environment's variable key is
+// captured into new jobs.
+func (p EnvPolicy) Inherits(key string) bool {
+	if !p.Inherit || matchesAny(p.Deny, key) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchesAny(p.Allow, key)
+}
+
+func (p EnvPolicy) IsSecret(key string) bool {
+	return matchesAny(p.Secret, key)
+}
+
+// Redact returns a copy of env with secret values replaced by Redacted.
+func (p EnvPolicy) Redact(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	result := make(map[string]string, len(env))
+	for k, v := range env {
+		if p.IsSecret(k) {
+			v = Redacted
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func matchesAny(patterns []string, key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
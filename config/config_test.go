@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("Missing config should not error: %v", err)
+	}
+
+	if cfg.Defaults.ListLimit != 10 {
+		t.Errorf("Expected default ListLimit=10, got %d", cfg.Defaults.ListLimit)
+	}
+	if !cfg.Defaults.LingerCheck {
+		t.Error("Expected LingerCheck to default to true")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+[defaults]
+list_limit = 25
+color = "never"
+
+[profile.train]
+gpu = "1"
+memory_max = "32G"
+notify_command = "notify-send done"
+notify_on = "failure"
+
+[profile.train.env]
+WANDB_MODE = "offline"
+
+[profile.train.properties]
+Nice = "10"
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.Defaults.ListLimit != 25 {
+		t.Errorf("Expected ListLimit=25, got %d", cfg.Defaults.ListLimit)
+	}
+	if cfg.Defaults.PruneKeep != 100 {
+		t.Errorf("Expected unset PruneKeep to keep default 100, got %d", cfg.Defaults.PruneKeep)
+	}
+	if cfg.Defaults.Color != "never" {
+		t.Errorf("Expected Color=never, got %q", cfg.Defaults.Color)
+	}
+
+	p, err := cfg.Profile("train")
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if p.GPU != "1" {
+		t.Errorf("Expected GPU=1, got %q", p.GPU)
+	}
+	if p.Env["WANDB_MODE"] != "offline" {
+		t.Errorf("Expected WANDB_MODE=offline, got %q", p.Env["WANDB_MODE"])
+	}
+	if p.Properties["Nice"] != "10" {
+		t.Errorf("Expected Nice=10, got %q", p.Properties["Nice"])
+	}
+	if p.ResourceProperties()["MemoryMax"] != "32G" {
+		t.Errorf("Expected MemoryMax=32G, got %q", p.ResourceProperties()["MemoryMax"])
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", "[defaults]\nlist_limt = 5\n", "unknown key"},
+		{"bad color", "[defaults]\ncolor = \"sometimes\"\n", "invalid color"},
+		{"bad tee_logs", "[defaults]\ntee_logs = \"sometimes\"\n", "invalid tee_logs"},
+		{"bad log_limit_action", "[defaults]\nlog_limit_action = \"kill\"\n", "invalid log_limit_action"},
+		{"bad notify_on", "[profile.x]\nnotify_on = \"never\"\n", "invalid notify_on"},
+		{"syntax", "[defaults\n", "config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfileUnknown(t *testing.T) {
+	cfg := Default()
+	cfg.Profiles["a"] = Profile{}
+
+	_, err := cfg.Profile("b")
+	if err == nil || !strings.Contains(err.Error(), "[a]") {
+		t.Errorf("Expected error listing available profiles, got %v", err)
+	}
+}
+
+func TestEnvPolicy(t *testing.T) {
+	p := Default().Env
+
+	if !p.Inherits("HOME") {
+		t.Error("Expected HOME to be inherited by default")
+	}
+	if !p.IsSecret("GITHUB_TOKEN") || !p.IsSecret("aws_secret_access_key") {
+		t.Error("Expected token and secret variables to be secrets")
+	}
+	if p.IsSecret("PATH") {
+		t.Error("Expected PATH not to be a secret")
+	}
+
+	p.Allow = []string{"CUDA_*", "PATH"}
+	p.Deny = []string{"CUDA_LAUNCH_BLOCKING"}
+	if !p.Inherits("CUDA_VISIBLE_DEVICES") || !p.Inherits("PATH") {
+		t.Error("Expected allowed variables to be inherited")
+	}
+	if p.Inherits("HOME") {
+		t.Error("Expected variables outside the allowlist not to be inherited")
+	}
+	if p.Inherits("CUDA_LAUNCH_BLOCKING") {
+		t.Error("Expected deny to win over allow")
+	}
+
+	p.Inherit = false
+	if p.Inherits("PATH") {
+		t.Error("Expected nothing to be inherited when inherit is off")
+	}
+
+	redacted := p.Redact(map[string]string{"API_KEY": "hunter2", "LR": "0.1"})
+	if redacted["API_KEY"] != Redacted || redacted["LR"] != "0.1" {
+		t.Errorf("Unexpected redaction %v", redacted)
+	}
+}
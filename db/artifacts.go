@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// ArtifactRules name the files a job produces, snapshotted once it has
+// finished.
+type ArtifactRules struct {
+	// Patterns are globs relative to the job's cwd. A matching directory
+	// stands for the files under it.
+	Patterns []string `json:"patterns"`
+	// SHA256 asks for a checksum of each file.
+	SHA256 bool `json:"sha256,omitempty"`
+}
+
+// Artifact is a file a finished job produced, as it was when the job
+// finished.
+type Artifact struct {
+	ID       int64
+	JobID    int64
+	Path     string
+	Size     int64
+	ModTime  string
+	Checksum sql.NullString
+}
+
+func SetJobArtifactRules(id int64, rules *ArtifactRules) error {
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE jobs SET artifacts_json = ? WHERE id = ?`
+	_, err = DB.Exec(query, string(rulesJSON), id)
+	return err
+}
+
+// RecordJobArtifacts replaces the artifacts of a job with a new snapshot
+// and records when it was taken, even if no file matched.
+func RecordJobArtifacts(jobID int64, artifacts []*Artifact) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM job_artifacts WHERE job_id = ?`, jobID); err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		query := `INSERT INTO job_artifacts (job_id, path, size, mtime_utc, sha256) VALUES (?, ?, ?, ?, ?)`
+		if _, err := tx.Exec(query, jobID, a.Path, a.Size, a.ModTime, a.Checksum); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE jobs SET artifacts_at_utc = ? WHERE id = ?`
+	if _, err := tx.Exec(query, time.Now().UTC().Format(time.RFC3339), jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListJobArtifacts returns the artifacts of a job ordered by path.
+func ListJobArtifacts(jobID int64) ([]*Artifact, error) {
+	query := `SELECT id, job_id, path, size, mtime_utc, sha256 FROM job_artifacts
+		WHERE job_id = ? ORDER BY path`
+	rows, err := DB.Query(query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var artifacts []*Artifact
+	for rows.Next() {
+		var a Artifact
+		if err := rows.Scan(&a.ID, &a.JobID, &a.Path, &a.Size, &a.ModTime, &a.Checksum); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, &a)
+	}
+	return artifacts, rows.Err()
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestJobArtifacts(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, err := CreateJob("train", "jr-train-1.service", "/tmp", []string{"python"}, nil, nil, "host", "user")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	rules := &ArtifactRules{Patterns: []string{"out/*.pt"}, SHA256: true}
+	if err := SetJobArtifactRules(id, rules); err != nil {
+		t.Fatalf("Failed to set artifact rules: %v", err)
+	}
+
+	job, _ := GetJobByID(id)
+	if job.ArtifactsJSON.String != `{"patterns":["out/*.pt"],"sha256":true}` || job.ArtifactsAtUTC.Valid {
+		t.Fatalf("Unexpected artifact columns: %+v", job)
+	}
+
+	artifacts := []*Artifact{
+		{Path: "/tmp/out/b.pt", Size: 2, ModTime: "2024-01-01T00:00:00Z"},
+		{Path: "/tmp/out/a.pt", Size: 1, ModTime: "2024-01-01T00:00:00Z", Checksum: sql.NullString{String: "abc", Valid: true}},
+	}
+	if err := RecordJobArtifacts(id, artifacts); err != nil {
+		t.Fatalf("Failed to record artifacts: %v", err)
+	}
+	// A second snapshot replaces the first
+	if err := RecordJobArtifacts(id, artifacts); err != nil {
+		t.Fatalf("Failed to record artifacts: %v", err)
+	}
+
+	got, err := ListJobArtifacts(id)
+	if err != nil {
+		t.Fatalf("Failed to list artifacts: %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/tmp/out/a.pt" || got[0].Checksum.String != "abc" || got[1].Checksum.Valid {
+		t.Fatalf("Expected both artifacts ordered by path, got %+v", got)
+	}
+	if job, _ := GetJobByID(id); !job.ArtifactsAtUTC.Valid {
+		t.Error("Expected the snapshot time to be recorded")
+	}
+
+	if err := DeleteJob(id); err != nil {
+		t.Fatalf("Failed to delete job: %v", err)
+	}
+	if got, _ := ListJobArtifacts(id); len(got) != 0 {
+		t.Errorf("Expected no artifacts after delete, got %d", len(got))
+	}
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -27,6 +29,30 @@ type Job struct {
 	Notes          sql.NullString
 	LastKnownState sql.NullString
 	LastStateAtUTC sql.NullString
+	ParamsJSON     sql.NullString
+	GroupName      sql.NullString
+	ExitStatus     sql.NullString
+	StartedAtUTC   sql.NullString
+	FinishedAtUTC  sql.NullString
+	StopSignal     sql.NullString
+	StopTimeout    sql.NullString
+	StopResult     sql.NullString
+	PausedAtUTC    sql.NullString
+	PauseMethod    sql.NullString
+	CkptSignal     sql.NullString
+	CkptPath       sql.NullString
+	LastCkptAtUTC  sql.NullString
+	TagsJSON       sql.NullString
+	LogFile        sql.NullString
+	ErrLogFile     sql.NullString
+	SuccessRules   sql.NullString
+	Verdict        sql.NullString
+	VerdictReason  sql.NullString
+	ArtifactsJSON  sql.NullString
+	ArtifactsAtUTC sql.NullString
+	SnapshotJSON   sql.NullString
+	CPUUsageNSec   sql.NullInt64
+	MemoryPeak     sql.NullInt64
 }
 
 type JobWithArgs struct {
@@ -35,25 +61,72 @@ type JobWithArgs struct {
 	Env  map[string]string
 }
 
-func InitDB() error {
+// StateDir returns the directory holding the database and per-job files.
+func StateDir() (string, error) {
 	dataDir := os.Getenv("XDG_DATA_HOME")
 	if dataDir == "" {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			return err
+			return "", err
 		}
 		dataDir = filepath.Join(home, ".local", "state")
 	}
 
-	jrDir := filepath.Join(dataDir, "jr")
-	if err := os.MkdirAll(jrDir, 0755); err != nil {
+	return filepath.Join(dataDir, "jr"), nil
+}
+
+// JobDir returns the private directory for files belonging to unit. It is
+// not created.
+func JobDir(unit string) (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "jobs", unit), nil
+}
+
+// TemplateSecretsPath returns the private file holding the secret env
+// values of template name, which are kept out of the database.
+func TemplateSecretsPath(name string) (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "templates", url.PathEscape(name)+".secrets.json"), nil
+}
+
+// Path returns the location of the database file.
+func Path() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "jr.db"), nil
+}
+
+func InitDB() error {
+	dbPath, err := Path()
+	if err != nil {
 		return err
 	}
+	return Open(dbPath)
+}
+
+// busyTimeout is how long, in milliseconds, a statement waits for another
+// process to release the database. The CLI, a job's wrapper and its
+// ExecStopPost= hook may all write at once.
+const busyTimeout = 5000
 
-	dbPath := filepath.Join(jrDir, "jr.db")
+// Open opens the database at dbPath, creating and migrating it as needed.
+// Code running inside a job uses it with the path jr run passed along,
+// since the job's environment may not locate the same state directory.
+func Open(dbPath string) error {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return err
+	}
 
 	var err error
-	DB, err = sql.Open("sqlite", dbPath)
+	DB, err = sql.Open("sqlite", fmt.Sprintf("%s?_pragma=busy_timeout(%d)", dbPath, busyTimeout))
 	if err != nil {
 		return err
 	}
@@ -61,6 +134,34 @@ func InitDB() error {
 	return createTables()
 }
 
+// UserVersion returns the schema version of the open database, to be
+// compared with SchemaVersion.
+func UserVersion() (int, error) {
+	var version int
+	err := DB.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+// IntegrityCheck runs SQLite's integrity check and returns the problems it
+// reports, none for a healthy database.
+func IntegrityCheck() ([]string, error) {
+	problems, err := queryStrings(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) == 1 && problems[0] == "ok" {
+		return nil, nil
+	}
+	return problems, nil
+}
+
+// Vacuum rebuilds the database file, returning the space of deleted rows
+// to the filesystem.
+func Vacuum() error {
+	_, err := DB.Exec("VACUUM")
+	return err
+}
+
 func Close() error {
 	if DB != nil {
 		return DB.Close()
@@ -91,10 +192,123 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_jobs_name ON jobs(name);
 	`
 
-	_, err := DB.Exec(query)
+	if _, err := DB.Exec(query); err != nil {
+		return err
+	}
+
+	return migrate()
+}
+
+// migrations upgrade the base schema created by createTables. Each entry
+// runs exactly once; the number applied is tracked in PRAGMA user_version.
+// Only ever append to this list.
+var migrations = []string{
+	`ALTER TABLE jobs ADD COLUMN params_json TEXT`,
+	`CREATE TABLE IF NOT EXISTS templates (
+		name TEXT PRIMARY KEY,
+		created_at_utc TEXT NOT NULL,
+		cwd TEXT NOT NULL,
+		argv_json TEXT NOT NULL,
+		env_json TEXT,
+		properties_json TEXT
+	)`,
+	`ALTER TABLE jobs ADD COLUMN group_name TEXT`,
+	`CREATE INDEX IF NOT EXISTS idx_jobs_group ON jobs(group_name)`,
+	`ALTER TABLE jobs ADD COLUMN exit_status TEXT`,
+	`ALTER TABLE jobs ADD COLUMN started_at_utc TEXT`,
+	`ALTER TABLE jobs ADD COLUMN finished_at_utc TEXT`,
+	`ALTER TABLE jobs ADD COLUMN stop_signal TEXT`,
+	`ALTER TABLE jobs ADD COLUMN stop_timeout TEXT`,
+	`ALTER TABLE jobs ADD COLUMN stop_result TEXT`,
+	`ALTER TABLE jobs ADD COLUMN paused_at_utc TEXT`,
+	`ALTER TABLE jobs ADD COLUMN pause_method TEXT`,
+	`ALTER TABLE jobs ADD COLUMN checkpoint_signal TEXT`,
+	`ALTER TABLE jobs ADD COLUMN checkpoint_path TEXT`,
+	`ALTER TABLE jobs ADD COLUMN last_checkpoint_at_utc TEXT`,
+	`ALTER TABLE jobs ADD COLUMN tags_json TEXT`,
+	`ALTER TABLE jobs ADD COLUMN log_file TEXT`,
+	`ALTER TABLE jobs ADD COLUMN err_log_file TEXT`,
+	`CREATE TABLE IF NOT EXISTS job_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id INTEGER NOT NULL,
+		at_utc TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		message TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_job_events_job ON job_events(job_id)`,
+	`ALTER TABLE jobs ADD COLUMN success_rules_json TEXT`,
+	`ALTER TABLE jobs ADD COLUMN verdict TEXT`,
+	`ALTER TABLE jobs ADD COLUMN verdict_reason TEXT`,
+	`ALTER TABLE jobs ADD COLUMN artifacts_json TEXT`,
+	`ALTER TABLE jobs ADD COLUMN artifacts_at_utc TEXT`,
+	`CREATE TABLE IF NOT EXISTS job_artifacts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		mtime_utc TEXT NOT NULL,
+		sha256 TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_job_artifacts_job ON job_artifacts(job_id)`,
+	`ALTER TABLE jobs ADD COLUMN snapshot_json TEXT`,
+	`ALTER TABLE jobs ADD COLUMN cpu_usage_nsec INTEGER`,
+	`ALTER TABLE jobs ADD COLUMN memory_peak_bytes INTEGER`,
+}
+
+// SchemaVersion is the user_version of a fully migrated database.
+var SchemaVersion = len(migrations)
+
+// migrate applies the pending migrations in one transaction. It takes the
+// write lock up front, so that of two processes opening an old database at
+// once, one migrates and the other then finds nothing left to do.
+func migrate() error {
+	version, err := UserVersion()
+	if err != nil || version >= len(migrations) {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+	rollback := func(err error) error {
+		conn.ExecContext(ctx, `ROLLBACK`)
+		return err
+	}
+
+	if err := conn.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return rollback(err)
+	}
+	for i := version; i < len(migrations); i++ {
+		if _, err := conn.ExecContext(ctx, migrations[i]); err != nil {
+			return rollback(fmt.Errorf("migration %d: %w", i+1, err))
+		}
+	}
+	if version < len(migrations) {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(migrations))); err != nil {
+			return rollback(err)
+		}
+	}
+
+	_, err = conn.ExecContext(ctx, `COMMIT`)
 	return err
 }
 
+// jobColumns lists the jobs columns in the order scanJob expects them.
+const jobColumns = `id, created_at_utc, name, unit, cwd, argv_json, env_json, properties_json,
+	host, user, notes, last_known_state, last_state_at_utc, params_json,
+	group_name, exit_status, started_at_utc, finished_at_utc, stop_signal,
+	stop_timeout, stop_result, paused_at_utc, pause_method, checkpoint_signal,
+	checkpoint_path, last_checkpoint_at_utc, tags_json, log_file,
+	err_log_file, success_rules_json, verdict, verdict_reason, artifacts_json,
+	artifacts_at_utc, snapshot_json, cpu_usage_nsec, memory_peak_bytes`
+
 func CreateJob(name, unit, cwd string, argv []string, env map[string]string, props map[string]string, host, user string) (int64, error) {
 	argvJSON, err := json.Marshal(argv)
 	if err != nil {
@@ -141,39 +355,25 @@ func CreateJob(name, unit, cwd string, argv []string, env map[string]string, pro
 }
 
 func GetJobByID(id int64) (*Job, error) {
-	query := `SELECT * FROM jobs WHERE id = ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
 	row := DB.QueryRow(query, id)
 
 	return scanJob(row)
 }
 
 func GetJobByUnit(unit string) (*Job, error) {
-	query := `SELECT * FROM jobs WHERE unit = ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE unit = ?`
 	row := DB.QueryRow(query, unit)
 
 	return scanJob(row)
 }
 
-func FindJobByPartial(partial string) (*Job, error) {
-	if id, err := parseInt(partial); err == nil {
-		return GetJobByID(id)
-	}
-
-	return GetJobByUnit(partial)
-}
-
-func parseInt(s string) (int64, error) {
-	var id int64
-	_, err := fmt.Sscanf(s, "%d", &id)
-	return id, err
-}
-
 func ListJobs(limit int, all bool) ([]*Job, error) {
 	var query string
 	if all {
-		query = `SELECT * FROM jobs ORDER BY created_at_utc DESC`
+		query = `SELECT ` + jobColumns + ` FROM jobs ORDER BY created_at_utc DESC`
 	} else {
-		query = `SELECT * FROM jobs ORDER BY created_at_utc DESC LIMIT ?`
+		query = `SELECT ` + jobColumns + ` FROM jobs ORDER BY created_at_utc DESC LIMIT ?`
 	}
 
 	var rows *sql.Rows
@@ -201,7 +401,7 @@ func ListJobs(limit int, all bool) ([]*Job, error) {
 }
 
 func ListJobsByName(name string, limit int) ([]*Job, error) {
-	query := `SELECT * FROM jobs WHERE name LIKE ? ORDER BY created_at_utc DESC LIMIT ?`
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE name LIKE ? ORDER BY created_at_utc DESC LIMIT ?`
 	rows, err := DB.Query(query, name+"%", limit)
 	if err != nil {
 		return nil, err
@@ -220,79 +420,364 @@ func ListJobsByName(name string, limit int) ([]*Job, error) {
 	return jobs, rows.Err()
 }
 
+func ListJobsByGroup(group string) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE group_name = ? ORDER BY id`
+	rows, err := DB.Query(query, group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func ListJobsByIDRange(start, end int64) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id BETWEEN ? AND ? ORDER BY id`
+	rows, err := DB.Query(query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ListJobsCreatedBetween returns the jobs created in [since, until),
+// oldest first. A zero since or until leaves that end open.
+func ListJobsCreatedBetween(since, until time.Time) ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE created_at_utc >= ?`
+	args := []interface{}{since.UTC().Format(time.RFC3339)}
+	if !until.IsZero() {
+		query += ` AND created_at_utc < ?`
+		args = append(args, until.UTC().Format(time.RFC3339))
+	}
+	rows, err := DB.Query(query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ListUnsettledJobs returns the jobs whose final state has not been
+// recorded yet, oldest first.
+func ListUnsettledJobs() ([]*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE last_known_state IS NULL OR last_known_state IN ('active', 'activating', 'deactivating', 'reloading', 'paused', 'stalled')
+		ORDER BY id`
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// ListGroups returns the distinct group names, most recently used first.
+func ListGroups() ([]string, error) {
+	return queryStrings(`SELECT group_name FROM jobs WHERE group_name IS NOT NULL
+		GROUP BY group_name ORDER BY MAX(created_at_utc) DESC`)
+}
+
+// ListNames returns the distinct job names, most recently used first.
+func ListNames() ([]string, error) {
+	return queryStrings(`SELECT name FROM jobs GROUP BY name ORDER BY MAX(created_at_utc) DESC`)
+}
+
+// ListTags returns the distinct tags of all jobs, sorted.
+func ListTags() ([]string, error) {
+	return queryStrings(`SELECT DISTINCT t.value FROM jobs, json_each(jobs.tags_json) AS t
+		WHERE jobs.tags_json IS NOT NULL ORDER BY t.value`)
+}
+
+func queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+
+	return result, rows.Err()
+}
+
 func DeleteJob(id int64) error {
+	for _, table := range []string{"job_events", "job_artifacts"} {
+		if _, err := DB.Exec(`DELETE FROM `+table+` WHERE job_id = ?`, id); err != nil {
+			return err
+		}
+	}
 	query := `DELETE FROM jobs WHERE id = ?`
 	_, err := DB.Exec(query, id)
 	return err
 }
 
-func PruneJobs(keep int, olderThan time.Duration, failedOnly bool) error {
-	var conditions []string
-	var args []interface{}
+func UpdateJobState(id int64, state string) error {
+	query := `UPDATE jobs SET last_known_state = ?, last_state_at_utc = ? WHERE id = ?`
+	_, err := DB.Exec(query, state, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// RecordJobOutcome stores the final state of a job. Empty exitStatus,
+// startedAt and finishedAt leave the recorded values unchanged.
+func RecordJobOutcome(id int64, state, exitStatus, startedAt, finishedAt string) error {
+	query := `UPDATE jobs SET last_known_state = ?, last_state_at_utc = ?,
+		exit_status = COALESCE(NULLIF(?, ''), exit_status),
+		started_at_utc = COALESCE(NULLIF(?, ''), started_at_utc),
+		finished_at_utc = COALESCE(NULLIF(?, ''), finished_at_utc)
+		WHERE id = ?`
+	_, err := DB.Exec(query, state, time.Now().UTC().Format(time.RFC3339), exitStatus, startedAt, finishedAt, id)
+	return err
+}
 
-	// Always keep the most recent N jobs
-	if keep > 0 {
-		conditions = append(conditions, "id NOT IN (SELECT id FROM jobs ORDER BY created_at_utc DESC LIMIT ?)")
-		args = append(args, keep)
+// SetJobUsage records the CPU time and peak memory a finished job used.
+// Zero values are unknown and leave what was recorded before.
+func SetJobUsage(id int64, cpuUsage time.Duration, memoryPeak int64) error {
+	query := `UPDATE jobs SET cpu_usage_nsec = COALESCE(NULLIF(?, 0), cpu_usage_nsec),
+		memory_peak_bytes = COALESCE(NULLIF(?, 0), memory_peak_bytes)
+		WHERE id = ?`
+	_, err := DB.Exec(query, cpuUsage.Nanoseconds(), memoryPeak, id)
+	return err
+}
+
+// SetJobCreated overrides the creation time of a job, for jobs recorded
+// after the fact.
+func SetJobCreated(id int64, created time.Time) error {
+	query := `UPDATE jobs SET created_at_utc = ? WHERE id = ?`
+	_, err := DB.Exec(query, created.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// SetJobStopPolicy records how jr stop asks the job to exit: the first
+// signal to send and how long to wait before escalating.
+func SetJobStopPolicy(id int64, signal, timeout string) error {
+	query := `UPDATE jobs SET stop_signal = ?, stop_timeout = ? WHERE id = ?`
+	_, err := DB.Exec(query, signal, timeout, id)
+	return err
+}
+
+// SetJobStopResult records how a jr stop ended: "graceful" or "killed".
+func SetJobStopResult(id int64, result string) error {
+	query := `UPDATE jobs SET stop_result = ? WHERE id = ?`
+	_, err := DB.Exec(query, result, id)
+	return err
+}
+
+// SetJobPaused records that a job was paused, and how: "freezer" or
+// "signal".
+func SetJobPaused(id int64, method string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	query := `UPDATE jobs SET last_known_state = 'paused', last_state_at_utc = ?,
+		paused_at_utc = ?, pause_method = ? WHERE id = ?`
+	_, err := DB.Exec(query, now, now, method, id)
+	return err
+}
+
+// SetJobResumed clears the paused state recorded by SetJobPaused.
+func SetJobResumed(id int64) error {
+	query := `UPDATE jobs SET last_known_state = 'active', last_state_at_utc = ?,
+		paused_at_utc = NULL, pause_method = NULL WHERE id = ?`
+	_, err := DB.Exec(query, time.Now().UTC().Format(time.RFC3339), id)
+	return err
+}
+
+// SetJobStalled marks the running job of unit as stalled. It reports false
+// if the job is not recorded as running, for example because it is paused.
+func SetJobStalled(unit string) (bool, error) {
+	query := `UPDATE jobs SET last_known_state = 'stalled', last_state_at_utc = ?
+		WHERE unit = ? AND (last_known_state IS NULL OR last_known_state IN ('active', 'activating'))`
+	result, err := DB.Exec(query, time.Now().UTC().Format(time.RFC3339), unit)
+	if err != nil {
+		return false, err
 	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// SetJobUnstalled clears the stalled state set by SetJobStalled.
+func SetJobUnstalled(unit string) error {
+	query := `UPDATE jobs SET last_known_state = 'active', last_state_at_utc = ?
+		WHERE unit = ? AND last_known_state = 'stalled'`
+	_, err := DB.Exec(query, time.Now().UTC().Format(time.RFC3339), unit)
+	return err
+}
+
+// SetJobCheckpointPolicy records the signal that makes a job checkpoint and
+// the path it writes to, which may be empty.
+func SetJobCheckpointPolicy(id int64, signal, path string) error {
+	query := `UPDATE jobs SET checkpoint_signal = ?, checkpoint_path = ? WHERE id = ?`
+	_, err := DB.Exec(query, signal, sql.NullString{String: path, Valid: path != ""}, id)
+	return err
+}
+
+// SetJobCheckpointed records when a job last wrote a checkpoint.
+func SetJobCheckpointed(id int64, at time.Time) error {
+	query := `UPDATE jobs SET last_checkpoint_at_utc = ? WHERE id = ?`
+	_, err := DB.Exec(query, at.UTC().Format(time.RFC3339), id)
+	return err
+}
 
-	// Filter by age
-	if olderThan > 0 {
-		cutoff := time.Now().UTC().Add(-olderThan).Format(time.RFC3339)
-		conditions = append(conditions, "created_at_utc < ?")
-		args = append(args, cutoff)
+func SetJobParams(id int64, params map[string]string) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
 	}
 
-	// Filter by failed state
-	if failedOnly {
-		conditions = append(conditions, "last_known_state = 'failed'")
+	query := `UPDATE jobs SET params_json = ? WHERE id = ?`
+	_, err = DB.Exec(query, string(paramsJSON), id)
+	return err
+}
+
+func SetJobTags(id int64, tags []string) error {
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return err
 	}
 
-	if len(conditions) == 0 {
-		return nil
+	query := `UPDATE jobs SET tags_json = ? WHERE id = ?`
+	_, err = DB.Exec(query, string(tagsJSON), id)
+	return err
+}
+
+// SetJobLogFiles records the files a job's output goes to. stderr is empty
+// when both streams share the stdout file.
+func SetJobLogFiles(id int64, stdout, stderr string) error {
+	query := `UPDATE jobs SET log_file = ?, err_log_file = ? WHERE id = ?`
+	_, err := DB.Exec(query, stdout, sql.NullString{String: stderr, Valid: stderr != ""}, id)
+	return err
+}
+
+// SuccessRules decide whether a finished job succeeded, beyond its exit
+// status being 0.
+type SuccessRules struct {
+	// ExitCodes are the exit statuses that count as success.
+	ExitCodes []int `json:"exitCodes,omitempty"`
+	// Output is a regular expression some line of output must match.
+	Output string `json:"output,omitempty"`
+	// Files are glob patterns, relative to the job's cwd, that must each
+	// match a file.
+	Files []string `json:"files,omitempty"`
+}
+
+func SetJobSuccessRules(id int64, rules *SuccessRules) error {
+	rulesJSON, err := json.Marshal(rules)
+	if err != nil {
+		return err
 	}
 
-	query := "DELETE FROM jobs WHERE " + conditions[0]
-	for i := 1; i < len(conditions); i++ {
-		query += " AND " + conditions[i]
+	query := `UPDATE jobs SET success_rules_json = ? WHERE id = ?`
+	_, err = DB.Exec(query, string(rulesJSON), id)
+	return err
+}
+
+// SetJobVerdict records whether a finished job succeeded, "success" or
+// "failure", and why not.
+func SetJobVerdict(id int64, verdict, reason string) error {
+	query := `UPDATE jobs SET verdict = ?, verdict_reason = ? WHERE id = ?`
+	_, err := DB.Exec(query, verdict, sql.NullString{String: reason, Valid: reason != ""}, id)
+	return err
+}
+
+// Snapshot records the code a job ran, so that an odd result can be traced
+// back to it later.
+type Snapshot struct {
+	// GitCommit and GitBranch are the HEAD of the git checkout holding the
+	// job's cwd, if any; GitBranch is empty on a detached HEAD.
+	GitCommit string `json:"gitCommit,omitempty"`
+	GitBranch string `json:"gitBranch,omitempty"`
+	// GitDiffSHA256 is the checksum of the uncommitted changes against
+	// HEAD, empty if there were none. The diff itself is kept in the job
+	// directory.
+	GitDiffSHA256 string `json:"gitDiffSha256,omitempty"`
+	// GitUntracked counts untracked files, which the diff leaves out.
+	GitUntracked int `json:"gitUntracked,omitempty"`
+	// Executable is the resolved path of the job's command.
+	Executable       string `json:"executable,omitempty"`
+	ExecutableSHA256 string `json:"executableSha256,omitempty"`
+}
+
+func SetJobSnapshot(id int64, snapshot *Snapshot) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
 	}
 
-	_, err := DB.Exec(query, args...)
+	query := `UPDATE jobs SET snapshot_json = ? WHERE id = ?`
+	_, err = DB.Exec(query, string(snapshotJSON), id)
 	return err
 }
 
-func UpdateJobState(id int64, state string) error {
-	query := `UPDATE jobs SET last_known_state = ?, last_state_at_utc = ? WHERE id = ?`
-	_, err := DB.Exec(query, state, time.Now().UTC().Format(time.RFC3339), id)
+func SetJobGroup(id int64, group string) error {
+	query := `UPDATE jobs SET group_name = ? WHERE id = ?`
+	_, err := DB.Exec(query, group, id)
 	return err
 }
 
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 func scanJob(row *sql.Row) (*Job, error) {
-	var j Job
-	err := row.Scan(
-		&j.ID,
-		&j.CreatedAtUTC,
-		&j.Name,
-		&j.Unit,
-		&j.Cwd,
-		&j.ArgvJSON,
-		&j.EnvJSON,
-		&j.PropertiesJSON,
-		&j.Host,
-		&j.User,
-		&j.Notes,
-		&j.LastKnownState,
-		&j.LastStateAtUTC,
-	)
+	j, err := scanJobFields(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return &j, err
+	return j, err
 }
 
 func scanJobRows(rows *sql.Rows) (*Job, error) {
+	return scanJobFields(rows)
+}
+
+func scanJobFields(s rowScanner) (*Job, error) {
 	var j Job
-	err := rows.Scan(
+	err := s.Scan(
 		&j.ID,
 		&j.CreatedAtUTC,
 		&j.Name,
@@ -306,6 +791,30 @@ func scanJobRows(rows *sql.Rows) (*Job, error) {
 		&j.Notes,
 		&j.LastKnownState,
 		&j.LastStateAtUTC,
+		&j.ParamsJSON,
+		&j.GroupName,
+		&j.ExitStatus,
+		&j.StartedAtUTC,
+		&j.FinishedAtUTC,
+		&j.StopSignal,
+		&j.StopTimeout,
+		&j.StopResult,
+		&j.PausedAtUTC,
+		&j.PauseMethod,
+		&j.CkptSignal,
+		&j.CkptPath,
+		&j.LastCkptAtUTC,
+		&j.TagsJSON,
+		&j.LogFile,
+		&j.ErrLogFile,
+		&j.SuccessRules,
+		&j.Verdict,
+		&j.VerdictReason,
+		&j.ArtifactsJSON,
+		&j.ArtifactsAtUTC,
+		&j.SnapshotJSON,
+		&j.CPUUsageNSec,
+		&j.MemoryPeak,
 	)
 	return &j, err
 }
@@ -1,8 +1,14 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -241,68 +247,412 @@ func TestUpdateJobState(t *testing.T) {
 	}
 }
 
-func TestPruneJobs(t *testing.T) {
+func TestMigrate(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
 
-	// Create 5 jobs
-	for i := 0; i < 5; i++ {
-		_, err := CreateJob("prune-job", "jr-prune-"+string(rune('0'+i))+".service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	var version int
+	if err := DB.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatalf("Failed to read user_version: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("Expected user_version=%d, got %d", SchemaVersion, version)
+	}
+
+	// Re-running migrations on an up-to-date database is a no-op
+	if err := migrate(); err != nil {
+		t.Fatalf("Failed to re-run migrations: %v", err)
+	}
+
+	if v, err := UserVersion(); err != nil || v != SchemaVersion {
+		t.Errorf("UserVersion() = %d, %v; want %d", v, err, SchemaVersion)
+	}
+	if problems, err := IntegrityCheck(); err != nil || len(problems) > 0 {
+		t.Errorf("IntegrityCheck() = %v, %v; want no problems", problems, err)
+	}
+}
+
+func TestOpenWaitsForLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "jr.db")
+
+	// Another process holding the write lock while the database is created
+	ctx := context.Background()
+	other, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer other.Close()
+	conn, err := other.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		t.Fatalf("Failed to lock database: %v", err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		conn.ExecContext(ctx, `COMMIT`)
+	}()
+
+	if err := Open(dbPath); err != nil {
+		t.Fatalf("Open() while locked: %v", err)
+	}
+	defer Close()
+
+	if v, err := UserVersion(); err != nil || v != SchemaVersion {
+		t.Errorf("UserVersion() = %d, %v; want %d", v, err, SchemaVersion)
+	}
+	var timeout int
+	if err := DB.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout); err != nil || timeout != busyTimeout {
+		t.Errorf("busy_timeout = %d, %v; want %d", timeout, err, busyTimeout)
+	}
+}
+
+func TestSetJobParams(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, err := CreateJob("params", "jr-params.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	if err := SetJobParams(id, map[string]string{"lr": "0.01"}); err != nil {
+		t.Fatalf("Failed to set params: %v", err)
+	}
+
+	job, err := GetJobByID(id)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.ParamsJSON.String != `{"lr":"0.01"}` {
+		t.Errorf("Expected params JSON, got %q", job.ParamsJSON.String)
+	}
+}
+
+func TestListJobsByGroup(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		id, err := CreateJob("sweep", "jr-sweep-"+string(rune('0'+i))+".service", "/tmp", []string{"echo"}, nil, nil, "", "")
 		if err != nil {
 			t.Fatalf("Failed to create job %d: %v", i, err)
 		}
-		time.Sleep(10 * time.Millisecond)
+		if i < 2 {
+			if err := SetJobGroup(id, "lr-search"); err != nil {
+				t.Fatalf("Failed to set group: %v", err)
+			}
+		}
 	}
 
-	// Prune keeping only 2
-	err := PruneJobs(2, 0, false)
+	jobs, err := ListJobsByGroup("lr-search")
 	if err != nil {
-		t.Fatalf("Failed to prune jobs: %v", err)
+		t.Fatalf("Failed to list jobs by group: %v", err)
 	}
 
-	jobs, err := ListJobs(0, true)
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 grouped jobs, got %d", len(jobs))
+	}
+	if jobs[0].GroupName.String != "lr-search" {
+		t.Errorf("Expected GroupName='lr-search', got %q", jobs[0].GroupName.String)
+	}
+}
+
+func TestListJobsByIDRange(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		if _, err := CreateJob("range", "jr-range-"+string(rune('0'+i))+".service", "/tmp", []string{"echo"}, nil, nil, "", ""); err != nil {
+			t.Fatalf("Failed to create job %d: %v", i, err)
+		}
+	}
+
+	jobs, err := ListJobsByIDRange(2, 4)
 	if err != nil {
-		t.Fatalf("Failed to list jobs after prune: %v", err)
+		t.Fatalf("Failed to list jobs by range: %v", err)
 	}
 
-	if len(jobs) != 2 {
-		t.Errorf("Expected 2 jobs after pruning, got %d", len(jobs))
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != 2 || jobs[2].ID != 4 {
+		t.Errorf("Expected ids 2..4 in order, got %d..%d", jobs[0].ID, jobs[2].ID)
+	}
+}
+
+func TestListGroupsAndNames(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id1, _ := CreateJob("train", "jr-train-1.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	id2, _ := CreateJob("train", "jr-train-2.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	CreateJob("eval", "jr-eval-1.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	SetJobGroup(id1, "sweep-a")
+	SetJobGroup(id2, "sweep-a")
+
+	groups, err := ListGroups()
+	if err != nil {
+		t.Fatalf("Failed to list groups: %v", err)
+	}
+	if len(groups) != 1 || groups[0] != "sweep-a" {
+		t.Errorf("Expected [sweep-a], got %v", groups)
+	}
+
+	names, err := ListNames()
+	if err != nil {
+		t.Fatalf("Failed to list names: %v", err)
+	}
+	if len(names) != 2 {
+		t.Errorf("Expected 2 distinct names, got %v", names)
 	}
 }
 
-func TestFindJobByPartial(t *testing.T) {
+func TestRecordJobOutcome(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
 
-	id, err := CreateJob("find-test", "jr-find.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	running, err := CreateJob("running", "jr-running.service", "/tmp", []string{"sleep"}, nil, nil, "", "")
 	if err != nil {
 		t.Fatalf("Failed to create job: %v", err)
 	}
+	done, err := CreateJob("done", "jr-done.service", "/tmp", []string{"true"}, nil, nil, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	if err := RecordJobOutcome(done, "failed", "3", "2024-01-06T14:00:00Z", "2024-01-06T15:00:00Z"); err != nil {
+		t.Fatalf("Failed to record outcome: %v", err)
+	}
+	// An empty exit status keeps the recorded one
+	if err := RecordJobOutcome(done, "failed", "", "", ""); err != nil {
+		t.Fatalf("Failed to record outcome: %v", err)
+	}
 
-	// Find by ID
-	job, err := FindJobByPartial("1")
+	job, err := GetJobByID(done)
 	if err != nil {
-		t.Fatalf("Failed to find job by ID: %v", err)
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.LastKnownState.String != "failed" || job.ExitStatus.String != "3" {
+		t.Errorf("Expected failed with status 3, got %q/%q", job.LastKnownState.String, job.ExitStatus.String)
 	}
-	if job == nil || job.ID != id {
-		t.Error("Failed to find job by ID")
+	if job.FinishedAtUTC.String != "2024-01-06T15:00:00Z" {
+		t.Errorf("Expected finish time to be kept, got %q", job.FinishedAtUTC.String)
 	}
 
-	// Find by unit
-	job, err = FindJobByPartial("jr-find.service")
+	unsettled, err := ListUnsettledJobs()
 	if err != nil {
-		t.Fatalf("Failed to find job by unit: %v", err)
+		t.Fatalf("Failed to list unsettled jobs: %v", err)
 	}
-	if job == nil || job.Unit != "jr-find.service" {
-		t.Error("Failed to find job by unit")
+	if len(unsettled) != 1 || unsettled[0].ID != running {
+		t.Errorf("Expected only the running job to be unsettled, got %d jobs", len(unsettled))
 	}
+}
+
+func TestSetJobPaused(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
 
-	// Find non-existent
-	job, err = FindJobByPartial("nonexistent")
+	id, err := CreateJob("pause", "jr-pause.service", "/tmp", []string{"sleep"}, nil, nil, "", "")
 	if err != nil {
-		t.Fatalf("Should not error for non-existent: %v", err)
+		t.Fatalf("Failed to create job: %v", err)
 	}
-	if job != nil {
-		t.Error("Expected nil for non-existent job")
+
+	if err := SetJobPaused(id, "freezer"); err != nil {
+		t.Fatalf("Failed to pause: %v", err)
+	}
+	job, _ := GetJobByID(id)
+	if job.LastKnownState.String != "paused" || job.PauseMethod.String != "freezer" || !job.PausedAtUTC.Valid {
+		t.Errorf("Expected paused via freezer, got %q/%q", job.LastKnownState.String, job.PauseMethod.String)
+	}
+
+	unsettled, _ := ListUnsettledJobs()
+	if len(unsettled) != 1 {
+		t.Errorf("Expected paused job to be unsettled, got %d jobs", len(unsettled))
+	}
+
+	if err := SetJobResumed(id); err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	job, _ = GetJobByID(id)
+	if job.LastKnownState.String != "active" || job.PauseMethod.Valid || job.PausedAtUTC.Valid {
+		t.Errorf("Expected pause to be cleared, got %q/%q", job.LastKnownState.String, job.PauseMethod.String)
+	}
+}
+
+func TestSetJobStalled(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, err := CreateJob("hang", "jr-hang.service", "/tmp", []string{"sleep"}, nil, nil, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	if ok, err := SetJobStalled("jr-hang.service"); !ok || err != nil {
+		t.Fatalf("Failed to mark stalled: %v, %v", ok, err)
+	}
+	job, _ := GetJobByID(id)
+	if job.LastKnownState.String != "stalled" {
+		t.Errorf("Expected stalled, got %q", job.LastKnownState.String)
+	}
+	if unsettled, _ := ListUnsettledJobs(); len(unsettled) != 1 {
+		t.Errorf("Expected stalled job to be unsettled, got %d jobs", len(unsettled))
+	}
+
+	if err := SetJobUnstalled("jr-hang.service"); err != nil {
+		t.Fatalf("Failed to clear stall: %v", err)
+	}
+	job, _ = GetJobByID(id)
+	if job.LastKnownState.String != "active" {
+		t.Errorf("Expected active after clearing the stall, got %q", job.LastKnownState.String)
+	}
+
+	// A paused job is silent on purpose
+	SetJobPaused(id, "signal")
+	if ok, _ := SetJobStalled("jr-hang.service"); ok {
+		t.Error("Expected a paused job not to be marked stalled")
+	}
+}
+
+func TestSetJobTags(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	a, _ := CreateJob("a", "jr-a.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	b, _ := CreateJob("b", "jr-b.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	CreateJob("c", "jr-c.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+
+	if err := SetJobTags(a, []string{"keep", "paper"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+	if err := SetJobTags(b, []string{"scratch", "paper"}); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+
+	job, _ := GetJobByID(a)
+	if job.TagsJSON.String != `["keep","paper"]` {
+		t.Errorf("Expected tags JSON, got %q", job.TagsJSON.String)
+	}
+
+	tags, err := ListTags()
+	if err != nil {
+		t.Fatalf("Failed to list tags: %v", err)
+	}
+	if strings.Join(tags, ",") != "keep,paper,scratch" {
+		t.Errorf("Expected distinct sorted tags, got %v", tags)
+	}
+}
+
+func TestSetJobLogFiles(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, _ := CreateJob("a", "jr-a.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	if job, _ := GetJobByID(id); job.LogFile.Valid {
+		t.Errorf("Expected no log file, got %q", job.LogFile.String)
+	}
+
+	if err := SetJobLogFiles(id, "/state/jobs/jr-a.service/output.log", ""); err != nil {
+		t.Fatalf("Failed to set log file: %v", err)
+	}
+	job, _ := GetJobByID(id)
+	if job.LogFile.String != "/state/jobs/jr-a.service/output.log" || job.ErrLogFile.Valid {
+		t.Errorf("Unexpected log files %q, %q", job.LogFile.String, job.ErrLogFile.String)
+	}
+
+	SetJobLogFiles(id, "/logs/a.out.log", "/logs/a.err.log")
+	if job, _ := GetJobByID(id); job.ErrLogFile.String != "/logs/a.err.log" {
+		t.Errorf("Unexpected stderr log file %q", job.ErrLogFile.String)
+	}
+}
+
+func TestSetJobVerdict(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, _ := CreateJob("a", "jr-a.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	rules := &SuccessRules{ExitCodes: []int{0, 2}, Output: "^done$", Files: []string{"out/*.csv"}}
+	if err := SetJobSuccessRules(id, rules); err != nil {
+		t.Fatalf("Failed to set success rules: %v", err)
+	}
+	if err := SetJobVerdict(id, "failure", "no output matched /^done$/"); err != nil {
+		t.Fatalf("Failed to set verdict: %v", err)
+	}
+
+	job, _ := GetJobByID(id)
+	var got SuccessRules
+	if err := json.Unmarshal([]byte(job.SuccessRules.String), &got); err != nil || !reflect.DeepEqual(&got, rules) {
+		t.Errorf("Expected rules %+v, got %+v (%v)", rules, got, err)
+	}
+	if job.Verdict.String != "failure" || job.VerdictReason.String != "no output matched /^done$/" {
+		t.Errorf("Unexpected verdict %q (%q)", job.Verdict.String, job.VerdictReason.String)
+	}
+
+	SetJobVerdict(id, "success", "")
+	if job, _ := GetJobByID(id); job.VerdictReason.Valid {
+		t.Errorf("Expected no reason for success, got %q", job.VerdictReason.String)
+	}
+}
+
+func TestSetJobSnapshot(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, _ := CreateJob("a", "jr-a.service", "/tmp", []string{"python"}, nil, nil, "", "")
+	snapshot := &Snapshot{GitCommit: "0123abc", GitBranch: "main", GitUntracked: 2, Executable: "/usr/bin/python3", ExecutableSHA256: "ff"}
+	if err := SetJobSnapshot(id, snapshot); err != nil {
+		t.Fatalf("Failed to set snapshot: %v", err)
+	}
+
+	job, _ := GetJobByID(id)
+	var got Snapshot
+	if err := json.Unmarshal([]byte(job.SnapshotJSON.String), &got); err != nil || !reflect.DeepEqual(&got, snapshot) {
+		t.Errorf("Expected snapshot %+v, got %+v (%v)", snapshot, got, err)
+	}
+}
+
+func TestSetJobUsage(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, _ := CreateJob("a", "jr-a.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	if err := SetJobUsage(id, 90*time.Second, 1<<30); err != nil {
+		t.Fatalf("Failed to set usage: %v", err)
+	}
+	// Unknown values keep what was recorded
+	if err := SetJobUsage(id, 0, 0); err != nil {
+		t.Fatalf("Failed to set usage: %v", err)
+	}
+
+	job, _ := GetJobByID(id)
+	if job.CPUUsageNSec.Int64 != int64(90*time.Second) || job.MemoryPeak.Int64 != 1<<30 {
+		t.Errorf("Unexpected usage %v, %v", job.CPUUsageNSec, job.MemoryPeak)
+	}
+}
+
+func TestListJobsCreatedBetween(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	for i, days := range []int{-10, -2, 0} {
+		id, _ := CreateJob("a", fmt.Sprintf("jr-a-%d.service", i), "/tmp", []string{"echo"}, nil, nil, "", "")
+		SetJobCreated(id, base.AddDate(0, 0, days))
+	}
+
+	jobs, err := ListJobsCreatedBetween(base.AddDate(0, 0, -3), time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list jobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Unit != "jr-a-1.service" {
+		t.Errorf("Expected the 2 newest jobs oldest first, got %d", len(jobs))
+	}
+
+	jobs, _ = ListJobsCreatedBetween(time.Time{}, base)
+	if len(jobs) != 2 || jobs[1].Unit != "jr-a-1.service" {
+		t.Errorf("Expected the 2 oldest jobs, got %d", len(jobs))
 	}
 }
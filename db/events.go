@@ -0,0 +1,47 @@
+package db
+
+import "time"
+
+// Event is something that happened to a job that its state alone does not
+// explain, such as jr stopping it for exceeding a limit.
+type Event struct {
+	ID      int64
+	JobID   int64
+	AtUTC   string
+	Kind    string
+	Message string
+}
+
+// AddJobEvent records an event against the job of unit. It reports false
+// if there is no such job.
+func AddJobEvent(unit, kind, message string) (bool, error) {
+	query := `INSERT INTO job_events (job_id, at_utc, kind, message)
+		SELECT id, ?, ?, ? FROM jobs WHERE unit = ?`
+	result, err := DB.Exec(query, time.Now().UTC().Format(time.RFC3339), kind, message, unit)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListJobEvents returns the events of a job, oldest first.
+func ListJobEvents(jobID int64) ([]*Event, error) {
+	query := `SELECT id, job_id, at_utc, kind, message FROM job_events
+		WHERE job_id = ? ORDER BY id`
+	rows, err := DB.Query(query, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.JobID, &e.AtUTC, &e.Kind, &e.Message); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
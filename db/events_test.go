@@ -0,0 +1,38 @@
+package db
+
+import "testing"
+
+func TestJobEvents(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if ok, err := AddJobEvent("jr-spam-1.service", "log-rate", "too much"); ok || err != nil {
+		t.Fatalf("Expected no event for an unknown unit, got %v, %v", ok, err)
+	}
+
+	id, err := CreateJob("spam", "jr-spam-1.service", "/tmp", []string{"yes"}, nil, nil, "host", "user")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	for _, kind := range []string{"log-rate", "log-bytes"} {
+		if ok, err := AddJobEvent("jr-spam-1.service", kind, "exceeded"); !ok || err != nil {
+			t.Fatalf("Failed to add event: %v, %v", ok, err)
+		}
+	}
+
+	events, err := ListJobEvents(id)
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != "log-rate" || events[1].Kind != "log-bytes" {
+		t.Fatalf("Expected both events in order, got %+v", events)
+	}
+
+	// Deleting the job drops its events
+	if err := DeleteJob(id); err != nil {
+		t.Fatalf("Failed to delete job: %v", err)
+	}
+	if events, _ := ListJobEvents(id); len(events) != 0 {
+		t.Errorf("Expected no events after delete, got %d", len(events))
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AmbiguousError is returned by ResolveJob when a reference matches more
+// than one job.
+type AmbiguousError struct {
+	Ref        string
+	Candidates []*Job
+}
+
+// maxListedCandidates caps how many candidates an AmbiguousError prints.
+const maxListedCandidates = 10
+
+func (e *AmbiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ambiguous job reference %q matches %d jobs:", e.Ref, len(e.Candidates))
+	for i, job := range e.Candidates {
+		if i == maxListedCandidates {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(e.Candidates)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %d\t%s\t%s", job.ID, job.Name, job.Unit)
+	}
+	return b.String()
+}
+
+var relativeRefPattern = regexp.MustCompile(`^@(last|failed)(?:~(\d+))?$`)
+
+// ResolveJob finds the job a user-supplied reference points at. In order of
+// precedence, ref may be:
+//
+//   - a relative reference: @last, @failed, optionally with ~N to go N jobs
+//     further back (@last~2 is the third most recent job)
+//   - an exact job id
+//   - an exact unit name, with or without the .service suffix
+//   - an exact job name, resolving to its most recent job
+//   - a unique unit prefix (the leading "jr-" may be omitted)
+//   - a unique suffix of the unit's ULID
+//
+// It returns nil if nothing matches and an *AmbiguousError if a prefix or
+// suffix matches several jobs.
+func ResolveJob(ref string) (*Job, error) {
+	if ref == "" {
+		return nil, nil
+	}
+
+	if m := relativeRefPattern.FindStringSubmatch(ref); m != nil {
+		offset := 0
+		if m[2] != "" {
+			offset, _ = strconv.Atoi(m[2])
+		}
+		return resolveRelative(m[1], offset)
+	}
+
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		job, err := GetJobByID(id)
+		if job != nil || err != nil {
+			return job, err
+		}
+	}
+
+	for _, unit := range []string{ref, ref + ".service"} {
+		job, err := GetJobByUnit(unit)
+		if job != nil || err != nil {
+			return job, err
+		}
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE name = ? ORDER BY created_at_utc DESC, id DESC LIMIT 1`
+	job, err := scanJob(DB.QueryRow(query, ref))
+	if job != nil || err != nil {
+		return job, err
+	}
+
+	pattern := likeEscape(strings.TrimSuffix(ref, ".service"))
+	query = `SELECT ` + jobColumns + ` FROM jobs
+		WHERE unit LIKE ? ESCAPE '\' OR unit LIKE ? ESCAPE '\' OR unit LIKE ? ESCAPE '\'
+		ORDER BY id`
+	candidates, err := queryJobs(query, pattern+"%", "jr-"+pattern+"%", "%"+pattern+".service")
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	}
+	return nil, &AmbiguousError{Ref: ref, Candidates: candidates}
+}
+
+func resolveRelative(kind string, offset int) (*Job, error) {
+	var query string
+	switch kind {
+	case "last":
+		query = `SELECT ` + jobColumns + ` FROM jobs ORDER BY created_at_utc DESC, id DESC LIMIT 1 OFFSET ?`
+	case "failed":
+		// By the verdict where there is one, so that success rules apply
+		query = `SELECT ` + jobColumns + ` FROM jobs
+			WHERE COALESCE(verdict = 'failure', last_known_state = 'failed')
+			ORDER BY created_at_utc DESC, id DESC LIMIT 1 OFFSET ?`
+	}
+
+	return scanJob(DB.QueryRow(query, offset))
+}
+
+func queryJobs(query string, args ...interface{}) ([]*Job, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJobRows(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// likeEscape escapes the LIKE wildcards in s for use with ESCAPE '\'.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveJob(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, err := CreateJob("find-test", "jr-find.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	// Find by ID
+	job, err := ResolveJob("1")
+	if err != nil {
+		t.Fatalf("Failed to find job by ID: %v", err)
+	}
+	if job == nil || job.ID != id {
+		t.Error("Failed to find job by ID")
+	}
+
+	// Find by unit
+	job, err = ResolveJob("jr-find.service")
+	if err != nil {
+		t.Fatalf("Failed to find job by unit: %v", err)
+	}
+	if job == nil || job.Unit != "jr-find.service" {
+		t.Error("Failed to find job by unit")
+	}
+
+	// Find non-existent
+	job, err = ResolveJob("nonexistent")
+	if err != nil {
+		t.Fatalf("Should not error for non-existent: %v", err)
+	}
+	if job != nil {
+		t.Error("Expected nil for non-existent job")
+	}
+}
+
+func TestResolveJobReferences(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	units := []string{
+		"jr-train-20240101-120000-01HQZX3K7M2ABCDE.service",
+		"jr-train-20240102-120000-01HQZX3K7M2FGHJK.service",
+		"jr-12abc-20240103-120000-01HQZX3K7M2MNPQR.service",
+		"jr-eval_a-20240104-120000-01HQZX3K7M2STVWX.service",
+	}
+	names := []string{"train", "train", "12abc", "eval_a"}
+	for i, unit := range units {
+		if _, err := CreateJob(names[i], unit, "/tmp", []string{"echo"}, nil, nil, "", ""); err != nil {
+			t.Fatalf("Failed to create job %d: %v", i, err)
+		}
+	}
+	if err := UpdateJobState(1, "failed"); err != nil {
+		t.Fatalf("Failed to update state: %v", err)
+	}
+	// The verdict decides where there is one
+	if err := UpdateJobState(2, "failed"); err != nil {
+		t.Fatalf("Failed to update state: %v", err)
+	}
+	if err := SetJobVerdict(2, "success", ""); err != nil {
+		t.Fatalf("Failed to set verdict: %v", err)
+	}
+	if err := UpdateJobState(3, "exited"); err != nil {
+		t.Fatalf("Failed to update state: %v", err)
+	}
+	if err := SetJobVerdict(3, "failure", "output did not match"); err != nil {
+		t.Fatalf("Failed to set verdict: %v", err)
+	}
+
+	tests := []struct {
+		ref      string
+		expected int64
+	}{
+		{"@last", 4},
+		{"@last~1", 3},
+		{"@last~3", 1},
+		{"@failed", 3},
+		{"@failed~1", 1},
+		{"2", 2},
+		{"train", 2},       // name: most recent
+		{"12abc", 3},       // name, not id 12
+		{"jr-12abc", 3},    // unit prefix
+		{"eval_a-2024", 4}, // prefix without "jr-"
+		{"M2FGHJK", 2},     // ULID suffix
+		{"m2fghjk", 2},     // case-insensitive
+		{units[0], 1},      // exact unit
+		{strings.TrimSuffix(units[0], ".service"), 1}, // without .service
+		{"@last~9", 0},
+		{"@failed~2", 0},
+		{"99", 0},
+		{"eval%", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			job, err := ResolveJob(tt.ref)
+			if err != nil {
+				t.Fatalf("ResolveJob(%q) error: %v", tt.ref, err)
+			}
+			var got int64
+			if job != nil {
+				got = job.ID
+			}
+			if got != tt.expected {
+				t.Errorf("ResolveJob(%q) = job %d, want %d", tt.ref, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveJobAmbiguous(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	CreateJob("a", "jr-train-1.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+	CreateJob("b", "jr-train-2.service", "/tmp", []string{"echo"}, nil, nil, "", "")
+
+	job, err := ResolveJob("jr-train")
+	if job != nil {
+		t.Errorf("Expected no job for ambiguous reference, got %d", job.ID)
+	}
+
+	var ambiguous *AmbiguousError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("Expected AmbiguousError, got %v", err)
+	}
+	if len(ambiguous.Candidates) != 2 {
+		t.Errorf("Expected 2 candidates, got %d", len(ambiguous.Candidates))
+	}
+	if !strings.Contains(err.Error(), "jr-train-1.service") || !strings.Contains(err.Error(), "jr-train-2.service") {
+		t.Errorf("Expected error to list candidates, got %q", err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Template is a saved command line whose argv, cwd, env and property
+// values may contain {{.param}} placeholders.
+type Template struct {
+	Name           string
+	CreatedAtUTC   string
+	Cwd            string
+	ArgvJSON       string
+	EnvJSON        sql.NullString
+	PropertiesJSON sql.NullString
+}
+
+const templateColumns = `name, created_at_utc, cwd, argv_json, env_json, properties_json`
+
+func SaveTemplate(name, cwd string, argv []string, env map[string]string, props map[string]string) error {
+	argvJSON, err := json.Marshal(argv)
+	if err != nil {
+		return err
+	}
+
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	propsJSON, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO templates (` + templateColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			created_at_utc = excluded.created_at_utc,
+			cwd = excluded.cwd,
+			argv_json = excluded.argv_json,
+			env_json = excluded.env_json,
+			properties_json = excluded.properties_json
+	`
+
+	_, err = DB.Exec(query,
+		name,
+		time.Now().UTC().Format(time.RFC3339),
+		cwd,
+		string(argvJSON),
+		string(envJSON),
+		string(propsJSON),
+	)
+	return err
+}
+
+func GetTemplate(name string) (*Template, error) {
+	query := `SELECT ` + templateColumns + ` FROM templates WHERE name = ?`
+	row := DB.QueryRow(query, name)
+
+	var t Template
+	err := row.Scan(&t.Name, &t.CreatedAtUTC, &t.Cwd, &t.ArgvJSON, &t.EnvJSON, &t.PropertiesJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &t, err
+}
+
+func ListTemplates() ([]*Template, error) {
+	query := `SELECT ` + templateColumns + ` FROM templates ORDER BY name`
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*Template
+	for rows.Next() {
+		var t Template
+		if err := rows.Scan(&t.Name, &t.CreatedAtUTC, &t.Cwd, &t.ArgvJSON, &t.EnvJSON, &t.PropertiesJSON); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &t)
+	}
+
+	return templates, rows.Err()
+}
+
+func DeleteTemplate(name string) (bool, error) {
+	query := `DELETE FROM templates WHERE name = ?`
+	result, err := DB.Exec(query, name)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
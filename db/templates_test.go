@@ -0,0 +1,77 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSaveAndGetTemplate(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	argv := []string{"python", "train.py", "--lr", "{{.lr}}"}
+	env := map[string]string{"SEED": "{{.seed}}"}
+
+	if err := SaveTemplate("train", "/home/user", argv, env, nil); err != nil {
+		t.Fatalf("Failed to save template: %v", err)
+	}
+
+	tmpl, err := GetTemplate("train")
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if tmpl == nil {
+		t.Fatal("Template should not be nil")
+	}
+
+	var gotArgv []string
+	if err := json.Unmarshal([]byte(tmpl.ArgvJSON), &gotArgv); err != nil {
+		t.Fatalf("Failed to unmarshal argv: %v", err)
+	}
+	if len(gotArgv) != 4 || gotArgv[3] != "{{.lr}}" {
+		t.Errorf("Unexpected argv %v", gotArgv)
+	}
+
+	// Saving again replaces the template
+	if err := SaveTemplate("train", "/tmp", argv, nil, nil); err != nil {
+		t.Fatalf("Failed to overwrite template: %v", err)
+	}
+	tmpl, err = GetTemplate("train")
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+	if tmpl.Cwd != "/tmp" {
+		t.Errorf("Expected Cwd='/tmp' after overwrite, got %q", tmpl.Cwd)
+	}
+}
+
+func TestListAndDeleteTemplates(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	SaveTemplate("b", "/tmp", []string{"echo"}, nil, nil)
+	SaveTemplate("a", "/tmp", []string{"echo"}, nil, nil)
+
+	templates, err := ListTemplates()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+	if len(templates) != 2 || templates[0].Name != "a" {
+		t.Fatalf("Expected templates sorted by name, got %d", len(templates))
+	}
+
+	deleted, err := DeleteTemplate("a")
+	if err != nil || !deleted {
+		t.Fatalf("Expected template to be deleted, got %v, %v", deleted, err)
+	}
+
+	deleted, err = DeleteTemplate("a")
+	if err != nil || deleted {
+		t.Errorf("Expected second delete to report nothing deleted, got %v, %v", deleted, err)
+	}
+
+	tmpl, err := GetTemplate("missing")
+	if err != nil || tmpl != nil {
+		t.Errorf("Expected nil for missing template, got %v, %v", tmpl, err)
+	}
+}
@@ -0,0 +1,115 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimum systemd versions for features jr relies on.
+const (
+	// VersionCollect added CollectMode=, used by systemd-run --collect.
+	VersionCollect = 236
+	// VersionLogRateLimit added LogRateLimitIntervalSec= and
+	// LogRateLimitBurst= for services.
+	VersionLogRateLimit = 240
+	// VersionFreeze added systemctl freeze and thaw.
+	VersionFreeze = 246
+)
+
+// Version returns the major version of the installed systemd.
+func Version() (int, error) {
+	output, err := exec.Command("systemctl", "--version").Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseVersion(string(output))
+}
+
+// parseVersion reads the first line of systemctl --version, e.g.
+// "systemd 252 (252.39-1~deb12u1)".
+func parseVersion(output string) (int, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0, fmt.Errorf("unexpected systemctl --version output")
+	}
+	return strconv.Atoi(fields[1])
+}
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// CgroupV2 reports whether the unified cgroup hierarchy is mounted, which
+// the freezer and resource limits of user units need.
+func CgroupV2() bool {
+	_, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	return err == nil
+}
+
+// DelegatedControllers returns the cgroup controllers available to the
+// calling user's service manager, and thus to jobs.
+func DelegatedControllers() ([]string, error) {
+	uid := strconv.Itoa(os.Getuid())
+	path := filepath.Join(cgroupRoot, "user.slice", "user-"+uid+".slice", "user@"+uid+".service", "cgroup.controllers")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// OwnCgroupCPU returns the CPU time used so far by the cgroup of the
+// calling process, which for a process of a unit is the whole unit's. It
+// needs the unified cgroup hierarchy.
+func OwnCgroupCPU() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0, err
+	}
+	var cgroup string
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			cgroup = path
+		}
+	}
+	if cgroup == "" {
+		return 0, fmt.Errorf("not in a unified cgroup")
+	}
+
+	data, err = os.ReadFile(filepath.Join(cgroupRoot, cgroup, "cpu.stat"))
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUStat(string(data))
+}
+
+// parseCPUStat reads usage_usec from a cgroup cpu.stat file.
+func parseCPUStat(stat string) (time.Duration, error) {
+	for _, line := range strings.Split(stat, "\n") {
+		if value, ok := strings.CutPrefix(line, "usage_usec "); ok {
+			usec, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(usec) * time.Microsecond, nil
+		}
+	}
+	return 0, fmt.Errorf("no usage_usec in cpu.stat")
+}
+
+// EnableLingering keeps the calling user's service manager running while
+// they are logged out. Depending on polkit policy it may ask for a
+// password or be refused.
+func EnableLingering() error {
+	output, err := exec.Command("loginctl", "enable-linger").CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package systemd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion("systemd 252 (252.39-1~deb12u1)\n+PAM +AUDIT default-hierarchy=unified\n")
+	if err != nil || v != 252 {
+		t.Errorf("parseVersion = %d, %v; want 252", v, err)
+	}
+
+	if _, err := parseVersion("not systemd"); err == nil {
+		t.Error("Expected unexpected output to fail")
+	}
+}
+
+func TestParseCPUStat(t *testing.T) {
+	usage, err := parseCPUStat("usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n")
+	if err != nil || usage != 2500*time.Millisecond {
+		t.Errorf("parseCPUStat = %s, %v; want 2.5s", usage, err)
+	}
+
+	if _, err := parseCPUStat("nr_periods 0\n"); err == nil {
+		t.Error("Expected a missing usage_usec to fail")
+	}
+}
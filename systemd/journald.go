@@ -0,0 +1,150 @@
+package systemd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JournaldConfig holds the journald.conf settings that decide whether job
+// output is kept.
+type JournaldConfig struct {
+	// Storage is volatile, persistent, auto or none.
+	Storage string
+	// RateLimitInterval and RateLimitBurst limit messages per service;
+	// a zero value of either disables rate limiting.
+	RateLimitInterval time.Duration
+	RateLimitBurst    int
+}
+
+// Defaults of journald.conf(5).
+const (
+	DefaultRateLimitInterval = 30 * time.Second
+	DefaultRateLimitBurst    = 10000
+)
+
+const persistentJournalDir = "/var/log/journal"
+
+// journaldDropInDirs are searched for journald.conf.d drop-ins, lowest
+// precedence first.
+var journaldDropInDirs = []string{
+	"/usr/lib/systemd/journald.conf.d",
+	"/usr/local/lib/systemd/journald.conf.d",
+	"/run/systemd/journald.conf.d",
+	"/etc/systemd/journald.conf.d",
+}
+
+// ReadJournaldConfig reads journald.conf and its drop-ins, starting from
+// the built-in defaults. Unreadable files are skipped.
+func ReadJournaldConfig() *JournaldConfig {
+	cfg := &JournaldConfig{
+		Storage:           "auto",
+		RateLimitInterval: DefaultRateLimitInterval,
+		RateLimitBurst:    DefaultRateLimitBurst,
+	}
+
+	files := []string{"/etc/systemd/journald.conf"}
+
+	// Drop-ins apply in filename order; a file in a later directory
+	// replaces one of the same name in an earlier one.
+	dropIns := make(map[string]string)
+	for _, dir := range journaldDropInDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.conf"))
+		for _, path := range matches {
+			dropIns[filepath.Base(path)] = path
+		}
+	}
+	names := make([]string, 0, len(dropIns))
+	for name := range dropIns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files = append(files, dropIns[name])
+	}
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		parseJournaldConfig(f, cfg)
+		f.Close()
+	}
+	return cfg
+}
+
+// parseJournaldConfig applies the [Journal] settings read from r to cfg.
+func parseJournaldConfig(r io.Reader, cfg *JournaldConfig) {
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		if section != "Journal" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch key {
+		case "Storage":
+			cfg.Storage = value
+		case "RateLimitIntervalSec", "RateLimitInterval":
+			if d, err := ParseTimespan(value); err == nil {
+				cfg.RateLimitInterval = d
+			}
+		case "RateLimitBurst":
+			if n, err := strconv.Atoi(value); err == nil {
+				cfg.RateLimitBurst = n
+			}
+		}
+	}
+}
+
+// Persistent reports whether journald writes logs to disk, where they
+// survive a reboot.
+func (c *JournaldConfig) Persistent() bool {
+	switch c.Storage {
+	case "persistent":
+		return true
+	case "auto":
+		return JournalPersistent()
+	}
+	return false
+}
+
+// JournalPersistent reports whether /var/log/journal exists, which makes
+// the default Storage=auto keep logs across reboots.
+func JournalPersistent() bool {
+	info, err := os.Stat(persistentJournalDir)
+	return err == nil && info.IsDir()
+}
+
+// UserJournalReadable reports whether journalctl --user can open any
+// journal files for the calling user. Without them, for example when
+// journald cannot split journals per user and the user is not in the
+// systemd-journal group, jr logs shows nothing.
+func UserJournalReadable() bool {
+	output, err := exec.Command("journalctl", "--user", "-n", "0", "--no-pager").CombinedOutput()
+	if err != nil {
+		return false
+	}
+	return !strings.Contains(string(output), "No journal files")
+}
@@ -0,0 +1,33 @@
+package systemd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJournaldConfig(t *testing.T) {
+	cfg := &JournaldConfig{Storage: "auto", RateLimitInterval: DefaultRateLimitInterval, RateLimitBurst: DefaultRateLimitBurst}
+
+	parseJournaldConfig(strings.NewReader(`[Journal]
+#Storage=persistent
+Storage=volatile
+RateLimitIntervalSec=10s
+`), cfg)
+	// A later drop-in overrides single settings
+	parseJournaldConfig(strings.NewReader(`[Journal]
+RateLimitBurst = 500
+[Other]
+Storage=persistent
+`), cfg)
+
+	if cfg.Storage != "volatile" {
+		t.Errorf("Expected Storage=volatile, got %q", cfg.Storage)
+	}
+	if cfg.RateLimitInterval != 10*time.Second || cfg.RateLimitBurst != 500 {
+		t.Errorf("Unexpected rate limit %s/%d", cfg.RateLimitInterval, cfg.RateLimitBurst)
+	}
+	if cfg.Persistent() {
+		t.Error("Expected volatile storage not to be persistent")
+	}
+}
@@ -0,0 +1,152 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GenerateScopeName returns a unit name like GenerateUnitName, for a scope.
+func GenerateScopeName(name string) string {
+	return strings.TrimSuffix(GenerateUnitName(name), ".service") + ".scope"
+}
+
+// StartScope moves pids into a new transient scope unit of the user
+// manager, as `systemd-run --user --scope` does for the processes it
+// starts. The kernel only allows this for processes the user manager may
+// manage; processes of a login session are usually refused.
+func StartScope(unit string, pids []int, desc string) error {
+	args := []string{"--user", "call",
+		"org.freedesktop.systemd1", "/org/freedesktop/systemd1", "org.freedesktop.systemd1.Manager",
+		"StartTransientUnit", "ssa(sv)a(sa(sv))", unit, "fail", "3",
+		"PIDs", "au", strconv.Itoa(len(pids)),
+	}
+	for _, pid := range pids {
+		args = append(args, strconv.Itoa(pid))
+	}
+	args = append(args, "Description", "s", desc, "CollectMode", "s", "inactive-or-failed", "0")
+
+	output, err := exec.Command("busctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ProcessUnit returns the unit whose cgroup pid is in, or "" if it is in
+// none (for example on a legacy cgroup hierarchy).
+func ProcessUnit(pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", fmt.Errorf("no such process: %d", pid)
+	}
+	return cgroupUnit(string(data)), nil
+}
+
+// cgroupUnit extracts the innermost service or scope unit from the unified
+// hierarchy line of /proc/<pid>/cgroup.
+func cgroupUnit(cgroup string) string {
+	for _, line := range strings.Split(cgroup, "\n") {
+		path, ok := strings.CutPrefix(line, "0::")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(path, "/")
+		for i := len(parts) - 1; i >= 0; i-- {
+			if strings.HasSuffix(parts[i], ".service") || strings.HasSuffix(parts[i], ".scope") {
+				return parts[i]
+			}
+		}
+	}
+	return ""
+}
+
+// Process is what can be read about a running process from /proc.
+type Process struct {
+	PID  int
+	Argv []string
+	Cwd  string
+	Env  map[string]string
+}
+
+// ReadProcess reads the command line, working directory and environment of
+// pid. The environment is the one the process started with.
+func ReadProcess(pid int) (*Process, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return nil, fmt.Errorf("no such process: %d", pid)
+	}
+
+	p := &Process{PID: pid, Argv: splitNul(cmdline), Env: make(map[string]string)}
+
+	if p.Cwd, err = os.Readlink(filepath.Join(dir, "cwd")); err != nil {
+		return nil, err
+	}
+
+	if environ, err := os.ReadFile(filepath.Join(dir, "environ")); err == nil {
+		for _, item := range splitNul(environ) {
+			if k, v, ok := strings.Cut(item, "="); ok {
+				p.Env[k] = v
+			}
+		}
+	}
+
+	return p, nil
+}
+
+func splitNul(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\x00")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
+
+// ProcessTree returns pid followed by all of its descendants.
+func ProcessTree(pid int) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, e := range entries {
+		child, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		if ppid, ok := parseStatPPID(string(stat)); ok {
+			children[ppid] = append(children[ppid], child)
+		}
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
+
+// parseStatPPID extracts the parent pid from /proc/<pid>/stat. The command
+// name in parentheses may itself contain spaces and parentheses.
+func parseStatPPID(stat string) (int, bool) {
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 2 {
+		return 0, false
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	return ppid, err == nil
+}
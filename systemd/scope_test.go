@@ -0,0 +1,75 @@
+package systemd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseStatPPID(t *testing.T) {
+	tests := []struct {
+		stat string
+		want int
+		ok   bool
+	}{
+		{"1234 (python) S 1000 1234 1234 0 -1", 1000, true},
+		{"1234 (my (odd) cmd) R 42 1234 1234 0 -1", 42, true},
+		{"garbage", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseStatPPID(tt.stat)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseStatPPID(%q) = %d, %v, want %d, %v", tt.stat, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadProcess(t *testing.T) {
+	proc, err := ReadProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to read own process: %v", err)
+	}
+
+	if len(proc.Argv) == 0 {
+		t.Error("Expected a command line")
+	}
+	wd, _ := os.Getwd()
+	if proc.Cwd != wd {
+		t.Errorf("Expected cwd %q, got %q", wd, proc.Cwd)
+	}
+
+	tree, err := ProcessTree(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to list process tree: %v", err)
+	}
+	if len(tree) == 0 || tree[0] != os.Getpid() {
+		t.Errorf("Expected tree to start with own pid, got %v", tree)
+	}
+}
+
+func TestGenerateScopeName(t *testing.T) {
+	unit := GenerateScopeName("train")
+	if !strings.HasPrefix(unit, "jr-train-") || !strings.HasSuffix(unit, ".scope") {
+		t.Errorf("Unexpected scope name %q", unit)
+	}
+}
+
+func TestCgroupUnit(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/jr-train-20240106-090000.scope\n", "jr-train-20240106-090000.scope"},
+		{"0::/user.slice/user-1000.slice/session-3.scope\n", "session-3.scope"},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/jr-eval.service/payload\n", "jr-eval.service"},
+		{"12:pids:/user.slice\n0::/\n", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cgroupUnit(tt.cgroup); got != tt.want {
+			t.Errorf("cgroupUnit(%q) = %q, want %q", tt.cgroup, got, tt.want)
+		}
+	}
+}
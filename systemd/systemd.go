@@ -3,9 +3,12 @@ package systemd
 import (
 	"bufio"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,12 +19,18 @@ const unitPrefix = "jr-"
 
 type UnitInfo struct {
 	Unit                   string
+	LoadState              string
 	ActiveState            string
 	SubState               string
 	ExecMainStatus         string
 	ExecMainPID            string
 	ExecMainStartTimestamp string
 	ExecMainExitTimestamp  string
+	FreezerState           string
+	// CPUUsageNSec and MemoryPeak are raw accounting values; see
+	// ParseAccounting.
+	CPUUsageNSec string
+	MemoryPeak   string
 }
 
 func GenerateUnitName(name string) string {
@@ -50,7 +59,10 @@ func sanitizeName(name string) string {
 	return result.String()
 }
 
-func StartUnit(unit, cwd string, argv []string, env map[string]string, props map[string]string, desc string) error {
+// StartUnit starts argv as a transient unit. A non-empty envFile is passed
+// as an EnvironmentFile= ahead of props, so one given in props is read after
+// it and wins for variables both set.
+func StartUnit(unit, cwd string, argv []string, env map[string]string, envFile string, props map[string]string, desc string) error {
 	args := []string{
 		"--user",
 		"--unit", unit,
@@ -66,6 +78,10 @@ func StartUnit(unit, cwd string, argv []string, env map[string]string, props map
 		args = append(args, "--setenv", fmt.Sprintf("%s=%s", k, v))
 	}
 
+	if envFile != "" {
+		args = append(args, "-p", "EnvironmentFile="+envFile)
+	}
+
 	for k, v := range props {
 		args = append(args, "-p", fmt.Sprintf("%s=%s", k, v))
 	}
@@ -85,11 +101,37 @@ func StopUnit(unit string) error {
 	return cmd.Run()
 }
 
+// StopUnitNoBlock queues a stop of unit without waiting for it, so a
+// process of the unit itself can ask for it.
+func StopUnitNoBlock(unit string) error {
+	cmd := exec.Command("systemctl", "--user", "stop", "--no-block", unit)
+	return cmd.Run()
+}
+
 func KillUnit(unit, signal string) error {
 	cmd := exec.Command("systemctl", "--user", "kill", "-s", signal, unit)
 	return cmd.Run()
 }
 
+// KillMainProcess sends signal to the main process of unit only, leaving
+// helper processes such as data loader workers alone.
+func KillMainProcess(unit, signal string) error {
+	cmd := exec.Command("systemctl", "--user", "kill", "--kill-who=main", "-s", signal, unit)
+	return cmd.Run()
+}
+
+// FreezeUnit suspends all processes of unit with the cgroup freezer. It
+// needs systemd 246 or later and the unified cgroup hierarchy.
+func FreezeUnit(unit string) error {
+	cmd := exec.Command("systemctl", "--user", "freeze", unit)
+	return cmd.Run()
+}
+
+func ThawUnit(unit string) error {
+	cmd := exec.Command("systemctl", "--user", "thaw", unit)
+	return cmd.Run()
+}
+
 func ResetFailedUnit(unit string) error {
 	cmd := exec.Command("systemctl", "--user", "reset-failed", unit)
 	return cmd.Run()
@@ -101,8 +143,9 @@ func ShowUnits(units []string) (map[string]*UnitInfo, error) {
 	}
 
 	args := append([]string{"--user", "show"}, units...)
-	args = append(args, "-p", "ActiveState", "-p", "SubState", "-p", "ExecMainStatus",
-		"-p", "ExecMainPID", "-p", "ExecMainStartTimestamp", "-p", "ExecMainExitTimestamp")
+	args = append(args, "-p", "LoadState", "-p", "ActiveState", "-p", "SubState", "-p", "ExecMainStatus",
+		"-p", "ExecMainPID", "-p", "ExecMainStartTimestamp", "-p", "ExecMainExitTimestamp",
+		"-p", "FreezerState", "-p", "CPUUsageNSec", "-p", "MemoryPeak")
 
 	cmd := exec.Command("systemctl", args...)
 	output, err := cmd.Output()
@@ -157,7 +200,9 @@ func parseShowOutput(output string, units []string) map[string]*UnitInfo {
 
 		info := result[units[unitIdx]]
 
-		if strings.HasPrefix(line, "ActiveState=") {
+		if strings.HasPrefix(line, "LoadState=") {
+			info.LoadState = strings.TrimPrefix(line, "LoadState=")
+		} else if strings.HasPrefix(line, "ActiveState=") {
 			info.ActiveState = strings.TrimPrefix(line, "ActiveState=")
 		} else if strings.HasPrefix(line, "SubState=") {
 			info.SubState = strings.TrimPrefix(line, "SubState=")
@@ -169,18 +214,38 @@ func parseShowOutput(output string, units []string) map[string]*UnitInfo {
 			info.ExecMainStartTimestamp = strings.TrimPrefix(line, "ExecMainStartTimestamp=")
 		} else if strings.HasPrefix(line, "ExecMainExitTimestamp=") {
 			info.ExecMainExitTimestamp = strings.TrimPrefix(line, "ExecMainExitTimestamp=")
+		} else if strings.HasPrefix(line, "FreezerState=") {
+			info.FreezerState = strings.TrimPrefix(line, "FreezerState=")
+		} else if strings.HasPrefix(line, "CPUUsageNSec=") {
+			info.CPUUsageNSec = strings.TrimPrefix(line, "CPUUsageNSec=")
+		} else if strings.HasPrefix(line, "MemoryPeak=") {
+			info.MemoryPeak = strings.TrimPrefix(line, "MemoryPeak=")
 		}
 	}
 
 	return result
 }
 
-func Logs(unit string, follow bool, lines int, since, until string, noColor bool, raw bool) error {
+// ParseAccounting parses a resource accounting property such as
+// CPUUsageNSec, returning 0 if accounting is off or the property unknown
+// to this systemd ("[not set]", or UINT64_MAX in the journal).
+func ParseAccounting(value string) int64 {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || n > math.MaxInt64 {
+		return 0
+	}
+	return int64(n)
+}
+
+func Logs(units []string, follow bool, lines int, since, until string, noColor bool, raw bool) error {
 	outputFormat := "short-iso"
 	if raw {
 		outputFormat = "cat"
 	}
-	args := []string{"--user", "-u", unit, "-o", outputFormat}
+	args := []string{"--user", "-o", outputFormat}
+	for _, unit := range units {
+		args = append(args, "-u", unit)
+	}
 
 	if follow {
 		args = append(args, "-f")
@@ -243,6 +308,12 @@ func CheckJournalctl() error {
 	return err
 }
 
+// Gone reports whether systemd no longer knows the unit, typically because
+// it was garbage-collected after finishing.
+func (info *UnitInfo) Gone() bool {
+	return info.LoadState == "not-found"
+}
+
 func GetStateString(info *UnitInfo) string {
 	if info.ActiveState == "active" {
 		return "active"
@@ -257,6 +328,59 @@ func GetStateString(info *UnitInfo) string {
 	return info.ActiveState
 }
 
+// ParseTimespan parses a systemd time span such as "90", "30s", "1min 30s"
+// or "500ms"; a bare number means seconds. "infinity" yields 0.
+func ParseTimespan(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty time span")
+	}
+	if s == "infinity" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(n * float64(time.Second)), nil
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ")
+		i := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid time span: %q", s)
+		}
+		n, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time span: %q", s)
+		}
+		rest = rest[i:]
+
+		j := strings.IndexFunc(rest, func(r rune) bool { return r == ' ' || (r >= '0' && r <= '9') })
+		if j < 0 {
+			j = len(rest)
+		}
+		unit, ok := timespanUnits[rest[:j]]
+		if !ok {
+			return 0, fmt.Errorf("invalid time span unit in %q", s)
+		}
+		total += time.Duration(n * float64(unit))
+		rest = rest[j:]
+	}
+
+	return total, nil
+}
+
+var timespanUnits = map[string]time.Duration{
+	"us": time.Microsecond, "usec": time.Microsecond,
+	"ms": time.Millisecond, "msec": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
 func CommandExists(cmd string) bool {
 	if strings.Contains(cmd, "/") {
 		_, err := os.Stat(cmd)
@@ -288,3 +412,39 @@ func ShortenCommand(argv []string, maxLen int) string {
 
 	return cmd
 }
+
+// quoteExecArg quotes s as a single argument of a systemd Exec*= line,
+// escaping variable expansion and specifiers so the shell sees s verbatim.
+func quoteExecArg(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"$", "$$",
+		"%", "%%",
+	)
+	return `"` + r.Replace(s) + `"`
+}
+
+// WriteEnvironmentFile writes env to path in EnvironmentFile= syntax,
+// readable only by the owner.
+func WriteEnvironmentFile(path string, env map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(formatEnvironmentFile(env)), 0600)
+}
+
+func formatEnvironmentFile(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", k, r.Replace(env[k]))
+	}
+	return b.String()
+}
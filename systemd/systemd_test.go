@@ -3,6 +3,7 @@ package systemd
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSanitizeName(t *testing.T) {
@@ -230,3 +231,43 @@ func TestCommandExists(t *testing.T) {
 		t.Error("Expected CommandExists to be false for non-existent command")
 	}
 }
+
+func TestFormatEnvironmentFile(t *testing.T) {
+	env := map[string]string{
+		"B_TOKEN": `a"b\c`,
+		"A_KEY":   "$HOME `x`",
+	}
+
+	expected := "A_KEY=\"\\$HOME \\`x\\`\"\nB_TOKEN=\"a\\\"b\\\\c\"\n"
+	if result := formatEnvironmentFile(env); result != expected {
+		t.Errorf("formatEnvironmentFile() = %q, want %q", result, expected)
+	}
+}
+
+func TestParseTimespan(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"90", 90 * time.Second},
+		{"30s", 30 * time.Second},
+		{"1min 30s", 90 * time.Second},
+		{"2h", 2 * time.Hour},
+		{"500ms", 500 * time.Millisecond},
+		{"1.5s", 1500 * time.Millisecond},
+		{"infinity", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimespan(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTimespan(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "abc", "10 parsecs"} {
+		if _, err := ParseTimespan(bad); err == nil {
+			t.Errorf("ParseTimespan(%q) should fail", bad)
+		}
+	}
+}
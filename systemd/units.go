@@ -0,0 +1,241 @@
+package systemd
+
+import (
+	"bufio"
+	"encoding/json"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unitNamePattern matches units created by GenerateUnitName.
+var unitNamePattern = regexp.MustCompile(`^jr-(.*)-(\d{8}-\d{6})-([0-9A-Z]{16})\.service$`)
+
+// ParseUnitName splits a unit created by GenerateUnitName into its
+// sanitized job name and creation time. Other jr-* units, such as helper
+// units, do not parse.
+func ParseUnitName(unit string) (name string, created time.Time, ok bool) {
+	m := unitNamePattern.FindStringSubmatch(unit)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+
+	created, err := time.Parse("20060102-150405", m[2])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return m[1], created, true
+}
+
+// ListJobUnits returns the jr-*.service units currently loaded in the user
+// manager, whatever their state.
+func ListJobUnits() ([]string, error) {
+	cmd := exec.Command("systemctl", "--user", "list-units", "--all", "--plain", "--no-legend",
+		"--type=service", unitPrefix+"*.service")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var units []string
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			units = append(units, fields[0])
+		}
+	}
+	return units, scanner.Err()
+}
+
+// UnitDetails is what can be recovered about how a unit was started.
+type UnitDetails struct {
+	Description      string
+	WorkingDirectory string
+	Argv             []string
+	Env              map[string]string
+}
+
+// ShowUnitDetails reads the command line, working directory and environment
+// of unit. Arguments containing whitespace cannot be told apart from
+// separate arguments, since systemd prints argv unquoted.
+func ShowUnitDetails(unit string) (*UnitDetails, error) {
+	cmd := exec.Command("systemctl", "--user", "show", unit,
+		"-p", "Description", "-p", "WorkingDirectory", "-p", "ExecStart", "-p", "Environment")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseUnitDetails(string(output)), nil
+}
+
+func parseUnitDetails(output string) *UnitDetails {
+	details := &UnitDetails{Env: make(map[string]string)}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Description":
+			details.Description = value
+		case "WorkingDirectory":
+			details.WorkingDirectory = strings.TrimLeft(value, "-!")
+		case "ExecStart":
+			details.Argv = parseExecStartArgv(value)
+		case "Environment":
+			for _, item := range splitEnvironment(value) {
+				if k, v, ok := strings.Cut(item, "="); ok {
+					details.Env[k] = v
+				}
+			}
+		}
+	}
+
+	return details
+}
+
+// parseExecStartArgv extracts argv from an ExecStart property such as
+// "{ path=/bin/sleep ; argv[]=/bin/sleep 10 ; ignore_errors=no ; ... }".
+func parseExecStartArgv(value string) []string {
+	_, rest, ok := strings.Cut(value, "argv[]=")
+	if !ok {
+		return nil
+	}
+	if i := strings.Index(rest, " ; "); i >= 0 {
+		rest = rest[:i]
+	}
+	return strings.Fields(rest)
+}
+
+// splitEnvironment splits an Environment property into its assignments.
+// systemd double-quotes assignments containing whitespace and escapes
+// quotes and backslashes inside them.
+func splitEnvironment(value string) []string {
+	var items []string
+	var cur strings.Builder
+	inQuotes, escaped, started := false, false, false
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && inQuotes:
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			started = true
+		case r == ' ' && !inQuotes:
+			if started {
+				items = append(items, cur.String())
+				cur.Reset()
+				started = false
+			}
+		default:
+			cur.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		items = append(items, cur.String())
+	}
+
+	return items
+}
+
+// ParseTimestamp parses a timestamp property as printed by systemctl show,
+// e.g. "Sat 2024-01-06 14:03:11 UTC". Empty and "n/a" values do not parse.
+func ParseTimestamp(s string) (time.Time, bool) {
+	t, err := time.Parse("Mon 2006-01-02 15:04:05 MST", s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Outcome is the result of a finished unit as recorded in the journal.
+type Outcome struct {
+	// State is "exited" or "failed".
+	State      string
+	ExitStatus string
+	// Finished is when the verdict was logged; zero if unknown.
+	Finished time.Time
+	// CPUUsage and MemoryPeak are the resources the unit consumed, as
+	// logged when it stopped; zero if unknown.
+	CPUUsage   time.Duration
+	MemoryPeak int64
+}
+
+// Journal message ids logged by the service manager.
+const (
+	messageUnitSucceeded = "7ad2d189f7e94e70a38c781354912448"
+	messageUnitFailed    = "d9b373ed55a64feb8242e02dbe79a49c"
+	messageUnitResources = "ae8f7b866b0347b9af31fe1c80b127c0"
+)
+
+// JournalOutcome looks up how unit ended from the messages the user manager
+// logged about it. It returns nil when the journal has no verdict, for
+// example because the unit is still running or the entries were rotated.
+func JournalOutcome(unit string) (*Outcome, error) {
+	cmd := exec.Command("journalctl", "--user", "-u", unit, "-o", "json", "-n", "100", "--no-pager")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseJournalOutcome(string(output)), nil
+}
+
+func parseJournalOutcome(output string) *Outcome {
+	var outcome *Outcome
+	exitStatus := ""
+	var cpuUsage, memoryPeak int64
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		if status, ok := entry["EXIT_STATUS"].(string); ok {
+			exitStatus = status
+		}
+
+		switch id, _ := entry["MESSAGE_ID"].(string); {
+		case id == messageUnitResources:
+			cpu, _ := entry["CPU_USAGE_NSEC"].(string)
+			peak, _ := entry["MEMORY_PEAK"].(string)
+			cpuUsage, memoryPeak = ParseAccounting(cpu), ParseAccounting(peak)
+			continue
+		case id == messageUnitSucceeded:
+			outcome = &Outcome{State: "exited"}
+		case id == messageUnitFailed || entry["UNIT_RESULT"] != nil:
+			outcome = &Outcome{State: "failed"}
+		default:
+			continue
+		}
+
+		if usec, ok := entry["__REALTIME_TIMESTAMP"].(string); ok {
+			if n, err := strconv.ParseInt(usec, 10, 64); err == nil {
+				outcome.Finished = time.UnixMicro(n).UTC()
+			}
+		}
+	}
+
+	if outcome != nil {
+		outcome.ExitStatus = exitStatus
+		outcome.CPUUsage = time.Duration(cpuUsage)
+		outcome.MemoryPeak = memoryPeak
+		if outcome.State == "exited" && exitStatus == "" {
+			outcome.ExitStatus = "0"
+		}
+	}
+	return outcome
+}
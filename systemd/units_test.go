@@ -0,0 +1,112 @@
+package systemd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseUnitName(t *testing.T) {
+	name, created, ok := ParseUnitName("jr-train-20240106-140311-01HKJ3M9X8Y7Z6W5.service")
+	if !ok {
+		t.Fatal("Expected generated unit name to parse")
+	}
+	if name != "train" {
+		t.Errorf("Expected name train, got %q", name)
+	}
+	if created.Format("2006-01-02 15:04:05") != "2024-01-06 14:03:11" {
+		t.Errorf("Unexpected creation time %v", created)
+	}
+
+	for _, unit := range []string{"jr-maintenance.service", "jr-train.service", "other.service"} {
+		if _, _, ok := ParseUnitName(unit); ok {
+			t.Errorf("Expected %q not to parse", unit)
+		}
+	}
+
+	unit := GenerateUnitName("round trip")
+	if name, _, ok := ParseUnitName(unit); !ok || name != "round_trip" {
+		t.Errorf("ParseUnitName(%q) = %q, %v", unit, name, ok)
+	}
+}
+
+func TestParseUnitDetails(t *testing.T) {
+	output := `Description=jr job: train
+WorkingDirectory=!/home/user/project
+ExecStart={ path=/usr/bin/python ; argv[]=/usr/bin/python train.py --lr 0.1 ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }
+Environment=LR=0.1 "MSG=hello world" "Q=say \"hi\""
+`
+
+	details := parseUnitDetails(output)
+
+	if details.Description != "jr job: train" {
+		t.Errorf("Unexpected description %q", details.Description)
+	}
+	if details.WorkingDirectory != "/home/user/project" {
+		t.Errorf("Unexpected working directory %q", details.WorkingDirectory)
+	}
+	if want := []string{"/usr/bin/python", "train.py", "--lr", "0.1"}; !reflect.DeepEqual(details.Argv, want) {
+		t.Errorf("Argv = %q, want %q", details.Argv, want)
+	}
+	want := map[string]string{"LR": "0.1", "MSG": "hello world", "Q": `say "hi"`}
+	if !reflect.DeepEqual(details.Env, want) {
+		t.Errorf("Env = %v, want %v", details.Env, want)
+	}
+}
+
+func TestParseJournalOutcome(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *Outcome
+	}{
+		{
+			name:   "no verdict",
+			output: `{"MESSAGE":"epoch 3"}`,
+			want:   nil,
+		},
+		{
+			name: "succeeded",
+			output: `{"MESSAGE":"done"}
+{"MESSAGE":"Deactivated successfully.","MESSAGE_ID":"7ad2d189f7e94e70a38c781354912448","__REALTIME_TIMESTAMP":"1704549791000000"}`,
+			want: &Outcome{State: "exited", ExitStatus: "0", Finished: time.Unix(1704549791, 0).UTC()},
+		},
+		{
+			name: "failed",
+			output: `{"MESSAGE":"Main process exited, code=exited, status=2/INVALIDARGUMENT","EXIT_CODE":"exited","EXIT_STATUS":"2"}
+{"MESSAGE":"Failed with result 'exit-code'.","MESSAGE_ID":"d9b373ed55a64feb8242e02dbe79a49c","UNIT_RESULT":"exit-code"}`,
+			want: &Outcome{State: "failed", ExitStatus: "2"},
+		},
+		{
+			name: "resources",
+			output: `{"MESSAGE":"Deactivated successfully.","MESSAGE_ID":"7ad2d189f7e94e70a38c781354912448"}
+{"MESSAGE":"Consumed 1.500s CPU time, 2M memory peak.","MESSAGE_ID":"ae8f7b866b0347b9af31fe1c80b127c0","CPU_USAGE_NSEC":"1500000000","MEMORY_PEAK":"2097152"}`,
+			want: &Outcome{State: "exited", ExitStatus: "0", CPUUsage: 1500 * time.Millisecond, MemoryPeak: 2 << 20},
+		},
+		{
+			name: "no memory accounting",
+			output: `{"MESSAGE_ID":"ae8f7b866b0347b9af31fe1c80b127c0","CPU_USAGE_NSEC":"1000","MEMORY_PEAK":"18446744073709551615"}
+{"MESSAGE_ID":"d9b373ed55a64feb8242e02dbe79a49c","UNIT_RESULT":"signal"}`,
+			want: &Outcome{State: "failed", CPUUsage: time.Microsecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseJournalOutcome(tt.output)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJournalOutcome() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	ts, ok := ParseTimestamp("Sat 2024-01-06 14:03:11 UTC")
+	if !ok || ts.UTC().Format("15:04:05") != "14:03:11" {
+		t.Errorf("ParseTimestamp() = %v, %v", ts, ok)
+	}
+	if _, ok := ParseTimestamp("n/a"); ok {
+		t.Error("Expected n/a not to parse")
+	}
+}
@@ -0,0 +1,184 @@
+package systemd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// MaintenanceUnit is the name, without suffix, of the service and timer
+// installed by `jr maintenance install`.
+const MaintenanceUnit = unitPrefix + "maintenance"
+
+// IsHelperUnit reports whether unit is one of jr's own units rather than a
+// job, so that sync can ignore it.
+func IsHelperUnit(unit string) bool {
+	return strings.TrimSuffix(unit, filepath.Ext(unit)) == MaintenanceUnit
+}
+
+// UserUnitDir returns the directory the user manager loads unit files from.
+func UserUnitDir() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// WriteUserUnit writes a unit file named name into UserUnitDir and returns
+// its path. Run DaemonReload afterwards.
+func WriteUserUnit(name, content string) (string, error) {
+	dir, err := UserUnitDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, []byte(content), 0644)
+}
+
+// RemoveUserUnit deletes a unit file written by WriteUserUnit. A missing
+// file is not an error.
+func RemoveUserUnit(name string) error {
+	dir, err := UserUnitDir()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func DaemonReload() error {
+	return systemctl("daemon-reload")
+}
+
+// EnableUnit enables unit and starts it right away.
+func EnableUnit(unit string) error {
+	return systemctl("enable", "--now", unit)
+}
+
+// DisableUnit disables unit and stops it.
+func DisableUnit(unit string) error {
+	return systemctl("disable", "--now", unit)
+}
+
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// ValidateCalendar checks an OnCalendar= expression with systemd-analyze,
+// when it is available.
+func ValidateCalendar(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty calendar expression")
+	}
+	if !CommandExistsInPath("systemd-analyze") {
+		return nil
+	}
+	output, err := exec.Command("systemd-analyze", "calendar", expr).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// TimerInfo is the state of a timer unit.
+type TimerInfo struct {
+	LoadState     string
+	ActiveState   string
+	UnitFileState string
+	// NextElapse and LastTrigger are systemctl timestamps, empty if unset.
+	NextElapse  string
+	LastTrigger string
+}
+
+func ShowTimer(unit string) (*TimerInfo, error) {
+	cmd := exec.Command("systemctl", "--user", "show", unit,
+		"-p", "LoadState", "-p", "ActiveState", "-p", "UnitFileState",
+		"-p", "NextElapseUSecRealtime", "-p", "LastTriggerUSec")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseTimerInfo(string(output)), nil
+}
+
+func parseTimerInfo(output string) *TimerInfo {
+	info := &TimerInfo{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "LoadState":
+			info.LoadState = value
+		case "ActiveState":
+			info.ActiveState = value
+		case "UnitFileState":
+			info.UnitFileState = value
+		case "NextElapseUSecRealtime":
+			info.NextElapse = value
+		case "LastTriggerUSec":
+			info.LastTrigger = value
+		}
+	}
+	return info
+}
+
+// ExecLine formats argv as the value of an Exec*= setting, quoting every
+// argument so that it reaches the process verbatim.
+func ExecLine(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = quoteExecArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// EnvironmentLine formats one Environment= assignment of a unit file.
+func EnvironmentLine(key, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+	return `Environment="` + r.Replace(key+"="+value) + `"`
+}
+
+// HasJournal reports whether the journal still holds output of unit.
+func HasJournal(unit string) bool {
+	output, err := exec.Command("journalctl", "--user", "-u", unit, "-n", "1", "-q", "-o", "cat", "--no-pager").Output()
+	return err == nil && len(output) > 0
+}
+
+// ExportJournal writes the journal output of unit to w, in the format of
+// `jr logs`.
+func ExportJournal(unit string, w io.Writer) error {
+	cmd := exec.Command("journalctl", "--user", "-u", unit, "-o", "short-iso", "-q", "--no-pager")
+	cmd.Stdout = w
+	return cmd.Run()
+}
+
+// WriteJournalMessages writes the output the processes of unit logged to
+// the journal to w, one message per line and without the service
+// manager's own messages about the unit.
+func WriteJournalMessages(unit string, w io.Writer) error {
+	cmd := exec.Command("journalctl", "--user", "_SYSTEMD_USER_UNIT="+unit, "-o", "cat", "-q", "--no-pager")
+	cmd.Stdout = w
+	return cmd.Run()
+}
@@ -0,0 +1,46 @@
+package systemd
+
+import "testing"
+
+func TestIsHelperUnit(t *testing.T) {
+	for unit, want := range map[string]bool{
+		"jr-maintenance.service":                                  true,
+		"jr-maintenance.timer":                                    true,
+		"jr-train-20240106-140311-01HKJ3M9X8Y7Z6W5.service":       false,
+		"jr-maintenance-20240106-140311-01HKJ3M9X8Y7Z6W5.service": false,
+	} {
+		if got := IsHelperUnit(unit); got != want {
+			t.Errorf("IsHelperUnit(%q) = %v, want %v", unit, got, want)
+		}
+	}
+}
+
+func TestExecLine(t *testing.T) {
+	got := ExecLine([]string{"/opt/my tools/jr", "maintenance", "run"})
+	want := `"/opt/my tools/jr" "maintenance" "run"`
+	if got != want {
+		t.Errorf("ExecLine = %s, want %s", got, want)
+	}
+}
+
+func TestEnvironmentLine(t *testing.T) {
+	got := EnvironmentLine("XDG_DATA_HOME", `/data/100%"x"`)
+	want := `Environment="XDG_DATA_HOME=/data/100%%\"x\""`
+	if got != want {
+		t.Errorf("EnvironmentLine = %s, want %s", got, want)
+	}
+}
+
+func TestParseTimerInfo(t *testing.T) {
+	info := parseTimerInfo("LoadState=loaded\nActiveState=active\nUnitFileState=enabled\n" +
+		"NextElapseUSecRealtime=Sun 2026-10-19 00:07:12 UTC\nLastTriggerUSec=n/a\n")
+	if info.LoadState != "loaded" || info.ActiveState != "active" || info.UnitFileState != "enabled" {
+		t.Errorf("Unexpected states %+v", info)
+	}
+	if _, ok := ParseTimestamp(info.NextElapse); !ok {
+		t.Errorf("Expected NextElapse %q to parse", info.NextElapse)
+	}
+	if _, ok := ParseTimestamp(info.LastTrigger); ok {
+		t.Errorf("Expected n/a LastTrigger not to parse")
+	}
+}